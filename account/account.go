@@ -2,56 +2,88 @@ package account
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/big"
 	"net/http"
-	"strings"
 	"time"
 
 	"banking-backend/auth"
+	"banking-backend/currency"
+	"banking-backend/store"
+
+	"github.com/lib/pq"
 )
 
 // --- Models ---
 
 type Account struct {
-	ID            string    `json:"id"`
-	UserID        string    `json:"user_id"`
-	AccountNumber string    `json:"account_number"`
-	Balance       float64   `json:"balance"`
-	Currency      string    `json:"currency"`
-	AccountType   string    `json:"account_type"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string             `json:"id"`
+	UserID        string             `json:"user_id"`
+	AccountNumber string             `json:"account_number"`
+	Balance       float64            `json:"balance"`
+	Currency      string             `json:"currency"`
+	AccountType   string             `json:"account_type"`
+	Pockets       map[string]float64 `json:"pockets,omitempty"` // Per-currency balances of multi-currency accounts
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
 }
 
 type CreateAccountRequest struct {
-	AccountType string `json:"account_type"`
-	Currency    string `json:"currency"`
+	AccountType    string  `json:"account_type"`
+	Currency       string  `json:"currency"`
+	InitialDeposit float64 `json:"initial_deposit"` // Must cover the minimum balance of the product
 }
 
 // --- Database ---
 
+// ErrDuplicateAccountNumber is returned when the generated account number
+// collides with an existing one.
+var ErrDuplicateAccountNumber = errors.New("account number already exists")
+
+// Repository stores accounts and the pockets of multi-currency accounts.
+// Lookups return nil, nil when nothing matches. The ForUpdate variants lock
+// what they return until the enclosing unit of work ends.
+type Repository interface {
+	CreateAccount(ctx context.Context, account *Account) (string, error)
+	GetAccountsByUserID(ctx context.Context, userID string) ([]*Account, error)
+	GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*Account, error)
+	GetAccountForUpdate(ctx context.Context, accountNumber string) (*Account, error)
+	GetAccountByIDForUpdate(ctx context.Context, id string) (*Account, error)
+	UpdateAccountBalance(ctx context.Context, accountID string, newBalance float64) error
+
+	// Pockets only hold the currencies other than the account's own; see
+	// GetPocketBalanceForUpdate and SetPocketBalance.
+	GetPocketForUpdate(ctx context.Context, accountID, cur string) (float64, error)
+	SetPocket(ctx context.Context, accountID, cur string, balance float64) error
+	GetPockets(ctx context.Context, accountIDs []string) (map[string]map[string]float64, error)
+}
+
+// DB is the Repository backed by Postgres.
 type DB struct {
 	*sql.DB
 }
 
+const accountColumns = `id, user_id, account_number, balance, currency, account_type, created_at, updated_at`
+
 func (db *DB) CreateAccount(ctx context.Context, account *Account) (string, error) {
 	var id string
 	query := `INSERT INTO accounts (user_id, account_number, balance, currency, account_type)
 			  VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := db.QueryRowContext(ctx, query, account.UserID, account.AccountNumber, account.Balance, account.Currency, account.AccountType).Scan(&id)
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, account.UserID, account.AccountNumber, account.Balance, account.Currency, account.AccountType).Scan(&id)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "accounts_account_number_key" {
+			return "", ErrDuplicateAccountNumber
+		}
 		return "", fmt.Errorf("could not create account: %w", err)
 	}
 	return id, nil
 }
 
-func (db *DB) GetAccountsByUserID(userID string) ([]*Account, error) {
-	rows, err := db.Query(`SELECT id, user_id, account_number, balance, currency, account_type, created_at, updated_at
-					   FROM accounts WHERE user_id = $1`, userID)
+func (db *DB) GetAccountsByUserID(ctx context.Context, userID string) ([]*Account, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE user_id = $1 ORDER BY created_at, id`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get accounts by user id: %w", err)
 	}
@@ -59,8 +91,7 @@ func (db *DB) GetAccountsByUserID(userID string) ([]*Account, error) {
 
 	var accounts []*Account
 	for rows.Next() {
-		account := &Account{}
-		err := rows.Scan(&account.ID, &account.UserID, &account.AccountNumber, &account.Balance, &account.Currency, &account.AccountType, &account.CreatedAt, &account.UpdatedAt)
+		account, err := scanAccount(rows)
 		if err != nil {
 			return nil, fmt.Errorf("could not scan account: %w", err)
 		}
@@ -74,11 +105,8 @@ func (db *DB) GetAccountsByUserID(userID string) ([]*Account, error) {
 	return accounts, nil
 }
 
-func (db *DB) GetAccountByAccountNumber(accountNumber string) (*Account, error) {
-	account := &Account{}
-	query := `SELECT id, user_id, account_number, balance, currency, account_type, created_at, updated_at
-			   FROM accounts WHERE account_number = $1`
-	err := db.QueryRow(query, accountNumber).Scan(&account.ID, &account.UserID, &account.AccountNumber, &account.Balance, &account.Currency, &account.AccountType, &account.CreatedAt, &account.UpdatedAt)
+func (db *DB) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*Account, error) {
+	account, err := scanAccount(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE account_number = $1`, accountNumber))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -88,19 +116,62 @@ func (db *DB) GetAccountByAccountNumber(accountNumber string) (*Account, error)
 	return account, nil
 }
 
-func (db *DB) UpdateAccountBalance(accountID string, newBalance float64) error {
+// GetAccountForUpdate loads an account and locks its row until the
+// transaction carried by ctx ends.
+func (db *DB) GetAccountForUpdate(ctx context.Context, accountNumber string) (*Account, error) {
+	account, err := scanAccount(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE account_number = $1 FOR UPDATE`, accountNumber))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not lock account: %w", err)
+	}
+	return account, nil
+}
+
+// GetAccountByIDForUpdate is like GetAccountForUpdate but looks the account up by ID.
+func (db *DB) GetAccountByIDForUpdate(ctx context.Context, id string) (*Account, error) {
+	account, err := scanAccount(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not lock account: %w", err)
+	}
+	return account, nil
+}
+
+func (db *DB) UpdateAccountBalance(ctx context.Context, accountID string, newBalance float64) error {
 	query := `UPDATE accounts SET balance = $1, updated_at = NOW() WHERE id = $2`
-	_, err := db.Exec(query, newBalance, accountID)
+	_, err := store.Conn(ctx, db.DB).ExecContext(ctx, query, newBalance, accountID)
 	if err != nil {
 		return fmt.Errorf("could not update account balance: %w", err)
 	}
 	return nil
 }
 
+func scanAccount(row interface{ Scan(...interface{}) error }) (*Account, error) {
+	account := &Account{}
+	err := row.Scan(&account.ID, &account.UserID, &account.AccountNumber, &account.Balance, &account.Currency, &account.AccountType, &account.CreatedAt, &account.UpdatedAt)
+	return account, err
+}
+
 // --- Handlers ---
 
+// maxAccountNumberAttempts bounds the retries on account number collisions.
+const maxAccountNumberAttempts = 5
+
 type Env struct {
-	DB *sql.DB
+	Accounts Repository
+	IBAN     *IBANGenerator
+	Tx       store.Transactor
+	Funder   Funder // Optional; accounts can only be opened empty when nil
+}
+
+// Funder posts the opening deposit of a new account, inside the unit of work
+// that creates it.
+type Funder interface {
+	FundNewAccount(ctx context.Context, acc *Account, amount float64) error
 }
 
 func (env *Env) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
@@ -117,34 +188,78 @@ func (env *Env) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.AccountType == "" {
-		req.AccountType = "checking"
+		req.AccountType = TypeChecking
+	}
+
+	product, err := GetProduct(req.AccountType)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	if req.Currency == "" {
-		req.Currency = "USD"
+		req.Currency = product.DefaultCurrency()
 	}
-
-	accountNumber, err := generateAccountNumber()
+	cur, err := currency.LookupSupported(req.Currency)
 	if err != nil {
-		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to generate account number")
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Currency = cur.Code
+	if !product.AllowsCurrency(req.Currency) {
+		auth.RespondWithError(w, http.StatusBadRequest, ErrCurrencyNotAllowed.Error())
+		return
+	}
+
+	req.InitialDeposit = currency.Round(req.InitialDeposit, req.Currency)
+	if req.InitialDeposit < 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Initial deposit must not be negative")
+		return
+	}
+	if req.InitialDeposit < product.MinimumBalance {
+		auth.RespondWithError(w, http.StatusBadRequest,
+			"Initial deposit must cover the minimum balance of "+cur.Format(product.MinimumBalance))
+		return
+	}
+	if req.InitialDeposit > 0 && env.Funder == nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Initial deposits are not available")
 		return
 	}
 
-	db := &DB{env.DB}
 	account := &Account{
-		UserID:        userID,
-		AccountNumber: accountNumber,
-		Balance:       0,
-		Currency:      req.Currency,
-		AccountType:   req.AccountType,
+		UserID:      userID,
+		Balance:     0,
+		Currency:    req.Currency,
+		AccountType: req.AccountType,
 	}
 
-	accountID, err := db.CreateAccount(r.Context(), account)
+	for attempt := 0; attempt < maxAccountNumberAttempts; attempt++ {
+		account.AccountNumber, err = env.IBAN.Generate()
+		if err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to generate account number")
+			return
+		}
+
+		// The account is only opened with its initial deposit
+		err = env.Tx.WithinTx(r.Context(), func(ctx context.Context) error {
+			var err error
+			if account.ID, err = env.Accounts.CreateAccount(ctx, account); err != nil {
+				return err
+			}
+			if req.InitialDeposit > 0 {
+				return env.Funder.FundNewAccount(ctx, account, req.InitialDeposit)
+			}
+			return nil
+		})
+		if !errors.Is(err, ErrDuplicateAccountNumber) {
+			break
+		}
+	}
 	if err != nil {
 		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to create account")
 		return
 	}
 
-	auth.JSON(w, http.StatusCreated, map[string]string{"account_id": accountID, "account_number": accountNumber})
+	auth.JSON(w, http.StatusCreated, map[string]string{"account_id": account.ID, "account_number": account.AccountNumber})
 }
 
 func (env *Env) GetAccountsHandler(w http.ResponseWriter, r *http.Request) {
@@ -154,13 +269,17 @@ func (env *Env) GetAccountsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := &DB{env.DB}
-	accounts, err := db.GetAccountsByUserID(userID)
+	accounts, err := env.Accounts.GetAccountsByUserID(r.Context(), userID)
 	if err != nil {
 		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get accounts")
 		return
 	}
 
+	if err := LoadPockets(r.Context(), env.Accounts, accounts); err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get account balances")
+		return
+	}
+
 	if len(accounts) == 0 {
 		auth.JSON(w, http.StatusOK, []*Account{})
 		return
@@ -168,16 +287,3 @@ func (env *Env) GetAccountsHandler(w http.ResponseWriter, r *http.Request) {
 
 	auth.JSON(w, http.StatusOK, accounts)
 }
-
-func generateAccountNumber() (string, error) {
-	// Generate a random 10-digit account number
-	var builder strings.Builder
-	for i := 0; i < 10; i++ {
-		n, err := rand.Int(rand.Reader, big.NewInt(10))
-		if err != nil {
-			return "", err
-		}
-		builder.WriteString(n.String())
-	}
-	return builder.String(), nil
-}
@@ -0,0 +1,198 @@
+package account
+
+import (
+	"banking-backend/config"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// --- IBAN ---
+
+var (
+	ErrInvalidIBAN       = errors.New("invalid IBAN")
+	ErrUnsupportedIBAN   = errors.New("unsupported IBAN country")
+	ErrIBANCheckDigits   = errors.New("invalid IBAN check digits")
+	ErrIBANNationalCheck = errors.New("invalid IBAN national check digits")
+)
+
+// ibanLengths holds the total IBAN length for the countries we accept.
+var ibanLengths = map[string]int{
+	"AD": 24, "AT": 20, "BE": 16, "CH": 21, "CY": 28, "CZ": 24, "DE": 22,
+	"DK": 18, "EE": 20, "ES": 24, "FI": 18, "FR": 27, "GB": 22, "GR": 27,
+	"HR": 21, "HU": 28, "IE": 22, "IT": 27, "LT": 20, "LU": 20, "LV": 21,
+	"MT": 31, "NL": 18, "NO": 15, "PL": 28, "PT": 25, "RO": 24, "SE": 24,
+	"SI": 19, "SK": 24,
+}
+
+// IBANGenerator issues IBANs for one bank branch. It is built validated by
+// NewIBANGenerator and is safe for concurrent use.
+type IBANGenerator struct {
+	countryCode string
+	bankCode    string
+	branchCode  string
+}
+
+// NewIBANGenerator builds a generator for the bank and branch codes of cfg.
+func NewIBANGenerator(cfg config.IBAN) (*IBANGenerator, error) {
+	g := &IBANGenerator{
+		countryCode: strings.ToUpper(cfg.CountryCode),
+		bankCode:    cfg.BankCode,
+		branchCode:  cfg.BranchCode,
+	}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *IBANGenerator) validate() error {
+	length, ok := ibanLengths[g.countryCode]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedIBAN, g.countryCode)
+	}
+	if !isDigits(g.bankCode) || !isDigits(g.branchCode) {
+		return fmt.Errorf("bank and branch codes must be numeric")
+	}
+	if g.countryCode == "ES" && (len(g.bankCode) != 4 || len(g.branchCode) != 4) {
+		return fmt.Errorf("spanish bank and branch codes must have 4 digits")
+	}
+	// Leave room for at least 6 random account digits
+	if len(g.bankCode)+len(g.branchCode)+6 > length-4 {
+		return fmt.Errorf("bank and branch codes are too long for %s IBANs", g.countryCode)
+	}
+	return nil
+}
+
+// Generate returns a new random IBAN in electronic format (no spaces).
+func (g *IBANGenerator) Generate() (string, error) {
+	// The zero value is not usable
+	if _, ok := ibanLengths[g.countryCode]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedIBAN, g.countryCode)
+	}
+
+	var bban string
+	if g.countryCode == "ES" {
+		accountDigits, err := randomDigits(10)
+		if err != nil {
+			return "", err
+		}
+		bban = g.bankCode + g.branchCode + spanishControlDigits(g.bankCode, g.branchCode, accountDigits) + accountDigits
+	} else {
+		bbanLength := ibanLengths[g.countryCode] - 4
+		accountDigits, err := randomDigits(bbanLength - len(g.bankCode) - len(g.branchCode))
+		if err != nil {
+			return "", err
+		}
+		bban = g.bankCode + g.branchCode + accountDigits
+	}
+
+	return g.countryCode + ibanCheckDigits(g.countryCode, bban) + bban, nil
+}
+
+// NormalizeIBAN strips spaces and upper-cases an IBAN.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// ValidateIBAN checks the country length, the mod-97 check digits and, for
+// Spanish IBANs, the national control digits. The IBAN must be normalized.
+func ValidateIBAN(iban string) error {
+	if len(iban) < 5 {
+		return ErrInvalidIBAN
+	}
+	for _, c := range iban {
+		if !(c >= '0' && c <= '9') && !(c >= 'A' && c <= 'Z') {
+			return ErrInvalidIBAN
+		}
+	}
+
+	country := iban[:2]
+	length, ok := ibanLengths[country]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedIBAN, country)
+	}
+	if len(iban) != length || !isDigits(iban[2:4]) {
+		return ErrInvalidIBAN
+	}
+
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return ErrIBANCheckDigits
+	}
+
+	if country == "ES" {
+		bban := iban[4:]
+		if !isDigits(bban) || bban[8:10] != spanishControlDigits(bban[0:4], bban[4:8], bban[10:]) {
+			return ErrIBANNationalCheck
+		}
+	}
+
+	return nil
+}
+
+func ibanCheckDigits(country, bban string) string {
+	return fmt.Sprintf("%02d", 98-mod97(bban+country+"00"))
+}
+
+// mod97 computes the ISO 7064 MOD 97-10 remainder, expanding letters to
+// their two-digit values (A=10 ... Z=35).
+func mod97(s string) int {
+	remainder := 0
+	for _, c := range s {
+		var v int
+		if c >= 'A' && c <= 'Z' {
+			v = int(c-'A') + 10
+			remainder = (remainder*100 + v) % 97
+			continue
+		}
+		v = int(c - '0')
+		remainder = (remainder*10 + v) % 97
+	}
+	return remainder
+}
+
+// spanishControlDigits computes the two "DC" digits of a Spanish CCC.
+func spanishControlDigits(bank, branch, accountDigits string) string {
+	weights := []int{1, 2, 4, 8, 5, 10, 9, 7, 3, 6}
+	digit := func(s string) int {
+		sum := 0
+		for i, c := range s {
+			sum += int(c-'0') * weights[i]
+		}
+		d := 11 - sum%11
+		switch d {
+		case 11:
+			return 0
+		case 10:
+			return 1
+		}
+		return d
+	}
+	return fmt.Sprintf("%d%d", digit("00"+bank+branch), digit(accountDigits))
+}
+
+func randomDigits(n int) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < n; i++ {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(d.String())
+	}
+	return builder.String(), nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package account
+
+import (
+	"banking-backend/config"
+	"errors"
+	"testing"
+)
+
+func TestMod97(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"0", 0},
+		{"97", 0},
+		{"98", 1},
+		{"A", 10},
+		{"Z", 35},
+		{"ZZ", 43},
+		{"3214282912345698765432161182", 1},
+		// DE89 3704 0044 0532 0130 00 rearranged
+		{"370400440532013000DE89", 1},
+		// GB29 NWBK 6016 1331 9268 19 rearranged, letters expanded
+		{"NWBK60161331926819GB29", 1},
+	}
+	for _, tt := range tests {
+		if got := mod97(tt.s); got != tt.want {
+			t.Errorf("mod97(%s) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSpanishControlDigits(t *testing.T) {
+	tests := []struct {
+		name                        string
+		bank, branch, accountDigits string
+		want                        string
+	}{
+		{"CaixaBank example", "2100", "0418", "0200051332", "45"},
+		{"another account", "2100", "0813", "0123456789", "61"},
+		{"remainder 0 gives 0", "0000", "0000", "0000000000", "00"},
+		{"remainder 1 gives 1", "0000", "0000", "0000000002", "01"},
+		{"plain digit", "0000", "0000", "0000000001", "05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spanishControlDigits(tt.bank, tt.branch, tt.accountDigits); got != tt.want {
+				t.Errorf("spanishControlDigits(%s, %s, %s) = %s, want %s", tt.bank, tt.branch, tt.accountDigits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIBAN(t *testing.T) {
+	tests := []struct {
+		name string
+		iban string
+		want error // nil when valid
+	}{
+		{"Spanish", "ES9121000418450200051332", nil},
+		{"another Spanish", "ES7921000813610123456789", nil},
+		{"German", "DE89370400440532013000", nil},
+		{"British with letters", "GB29NWBK60161331926819", nil},
+		{"French with a letter in the account", "FR1420041010050500013M02606", nil},
+		{"Dutch", "NL91ABNA0417164300", nil},
+		{"Belgian", "BE68539007547034", nil},
+		{"Swiss", "CH9300762011623852957", nil},
+		{"bad check digits", "DE88370400440532013000", ErrIBANCheckDigits},
+		{"transposed digits", "ES9121000418450200051323", ErrIBANCheckDigits},
+		{"bad Spanish control digits", "ES5621000418440200051332", ErrIBANNationalCheck},
+		{"too short", "ES912100041845020005133", ErrInvalidIBAN},
+		{"too long", "DE893704004405320130000", ErrInvalidIBAN},
+		{"letters as check digits", "DEAB370400440532013000", ErrInvalidIBAN},
+		{"not normalized", "es9121000418450200051332", ErrInvalidIBAN},
+		{"spaces", "ES91 2100 0418 4502 0005 1332", ErrInvalidIBAN},
+		{"shorter than a country and check digits", "ES91", ErrInvalidIBAN},
+		{"unsupported country", "US64SVBKUS6S3300958879", ErrUnsupportedIBAN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIBAN(tt.iban)
+			if tt.want == nil && err != nil {
+				t.Errorf("ValidateIBAN(%s) = %v, want valid", tt.iban, err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ValidateIBAN(%s) = %v, want %v", tt.iban, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratedIBANsAreValid(t *testing.T) {
+	for _, cfg := range []config.IBAN{
+		{CountryCode: "ES", BankCode: "2100", BranchCode: "0418"},
+		{CountryCode: "de", BankCode: "37040044", BranchCode: "0"},
+	} {
+		generator, err := NewIBANGenerator(cfg)
+		if err != nil {
+			t.Fatalf("NewIBANGenerator(%+v): %v", cfg, err)
+		}
+		for range 100 {
+			iban, err := generator.Generate()
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if err := ValidateIBAN(iban); err != nil {
+				t.Fatalf("generated %s: %v", iban, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"banking-backend/auth"
+)
+
+// --- Product Catalog ---
+
+const (
+	TypeChecking         = "checking"
+	TypeSavings          = "savings"
+	TypeFixedTermDeposit = "fixed_term_deposit"
+	TypeMultiCurrency    = "multi_currency"
+)
+
+var (
+	ErrUnknownProduct          = errors.New("unknown account type")
+	ErrCurrencyNotAllowed      = errors.New("currency not allowed for this account type")
+	ErrInsufficientFunds       = errors.New("insufficient funds")
+	ErrWithdrawalsNotAllowed   = errors.New("withdrawals are not allowed for this account type")
+	ErrWithdrawalLimitExceeded = errors.New("monthly withdrawal limit reached")
+)
+
+type Product struct {
+	Type                   string   `json:"type"`
+	Name                   string   `json:"name"`
+	AllowedCurrencies      []string `json:"allowed_currencies"` // Empty means any supported currency
+	MinimumBalance         float64  `json:"minimum_balance"`
+	OverdraftLimit         float64  `json:"overdraft_limit"`
+	WithdrawalsAllowed     bool     `json:"withdrawals_allowed"`
+	MonthlyWithdrawalLimit int      `json:"monthly_withdrawal_limit"` // 0 means unlimited
+	InterestRate           float64  `json:"interest_rate"`            // Annual rate, e.g. 0.015 for 1.5%
+	MultiCurrency          bool     `json:"multi_currency"`           // Holds a pocket per currency instead of converting
+}
+
+var products = map[string]*Product{
+	TypeChecking: {
+		Type:               TypeChecking,
+		Name:               "Checking account",
+		AllowedCurrencies:  []string{"EUR", "USD", "GBP"},
+		OverdraftLimit:     500,
+		WithdrawalsAllowed: true,
+	},
+	TypeSavings: {
+		Type:                   TypeSavings,
+		Name:                   "Savings account",
+		AllowedCurrencies:      []string{"EUR", "USD", "GBP"},
+		WithdrawalsAllowed:     true,
+		MonthlyWithdrawalLimit: 3,
+		InterestRate:           0.015,
+	},
+	TypeFixedTermDeposit: {
+		Type:              TypeFixedTermDeposit,
+		Name:              "Fixed-term deposit",
+		AllowedCurrencies: []string{"EUR"},
+		MinimumBalance:    1000,
+		InterestRate:      0.03,
+	},
+	TypeMultiCurrency: {
+		Type:               TypeMultiCurrency,
+		Name:               "Multi-currency wallet",
+		WithdrawalsAllowed: true,
+		MultiCurrency:      true,
+	},
+}
+
+func GetProduct(accountType string) (*Product, error) {
+	product, ok := products[accountType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProduct, accountType)
+	}
+	return product, nil
+}
+
+// Products returns the catalog sorted by account type.
+func Products() []*Product {
+	list := make([]*Product, 0, len(products))
+	for _, product := range products {
+		list = append(list, product)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// DefaultCurrency is used when an account is opened without a currency.
+func (p *Product) DefaultCurrency() string {
+	if p.AllowsCurrency("USD") || len(p.AllowedCurrencies) == 0 {
+		return "USD"
+	}
+	return p.AllowedCurrencies[0]
+}
+
+func (p *Product) AllowsCurrency(currency string) bool {
+	if len(p.AllowedCurrencies) == 0 {
+		return true
+	}
+	for _, c := range p.AllowedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDebit verifies that debiting amount from an account holding balance
+// respects the product rules. withdrawalsThisMonth is the number of debits
+// already posted in the current calendar month.
+func (p *Product) CheckDebit(balance, amount float64, withdrawalsThisMonth int) error {
+	if !p.WithdrawalsAllowed {
+		return ErrWithdrawalsNotAllowed
+	}
+	if p.MonthlyWithdrawalLimit > 0 && withdrawalsThisMonth >= p.MonthlyWithdrawalLimit {
+		return ErrWithdrawalLimitExceeded
+	}
+	if balance-amount < p.MinimumBalance-p.OverdraftLimit {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// CheckFee verifies that a fee can be charged on balance. Fees are not
+// withdrawals, so they only need the funds.
+func (p *Product) CheckFee(balance, fee float64) error {
+	if balance-fee < p.MinimumBalance-p.OverdraftLimit {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// --- Handlers ---
+
+func (env *Env) GetProductsHandler(w http.ResponseWriter, r *http.Request) {
+	auth.JSON(w, http.StatusOK, Products())
+}
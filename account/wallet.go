@@ -0,0 +1,121 @@
+package account
+
+import (
+	"banking-backend/store"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// --- Multi-Currency Pockets ---
+
+// A multi-currency account keeps its base currency balance in the accounts
+// table, like any other account, and every other currency in its own pocket
+// in account_balances.
+
+// GetPocketBalanceForUpdate returns the balance of acc in cur, locking the
+// pocket until the unit of work ends. Pockets that were never funded hold zero.
+func GetPocketBalanceForUpdate(ctx context.Context, repo Repository, acc *Account, cur string) (float64, error) {
+	if cur == acc.Currency {
+		return acc.Balance, nil
+	}
+	return repo.GetPocketForUpdate(ctx, acc.ID, cur)
+}
+
+// SetPocketBalance stores the balance of acc in cur, creating the pocket if needed.
+func SetPocketBalance(ctx context.Context, repo Repository, acc *Account, cur string, balance float64) error {
+	if cur == acc.Currency {
+		if err := repo.UpdateAccountBalance(ctx, acc.ID, balance); err != nil {
+			return err
+		}
+		acc.Balance = balance
+		return nil
+	}
+	return repo.SetPocket(ctx, acc.ID, cur, balance)
+}
+
+// LoadPockets fills the Pockets of every multi-currency account in accounts.
+func LoadPockets(ctx context.Context, repo Repository, accounts []*Account) error {
+	byID := make(map[string]*Account)
+	var ids []string
+	for _, acc := range accounts {
+		if acc.IsMultiCurrency() {
+			acc.Pockets = map[string]float64{acc.Currency: acc.Balance}
+			byID[acc.ID] = acc
+			ids = append(ids, acc.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pockets, err := repo.GetPockets(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for accountID, balances := range pockets {
+		for cur, balance := range balances {
+			byID[accountID].Pockets[cur] = balance
+		}
+	}
+	return nil
+}
+
+// IsMultiCurrency reports whether the account holds per-currency pockets.
+func (a *Account) IsMultiCurrency() bool {
+	product, err := GetProduct(a.AccountType)
+	return err == nil && product.MultiCurrency
+}
+
+// --- Database ---
+
+func (db *DB) GetPocketForUpdate(ctx context.Context, accountID, cur string) (float64, error) {
+	var balance float64
+	query := `SELECT balance FROM account_balances WHERE account_id = $1 AND currency = $2 FOR UPDATE`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, accountID, cur).Scan(&balance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("could not get pocket balance: %w", err)
+	}
+	return balance, nil
+}
+
+func (db *DB) SetPocket(ctx context.Context, accountID, cur string, balance float64) error {
+	query := `INSERT INTO account_balances (account_id, currency, balance) VALUES ($1, $2, $3)
+			  ON CONFLICT (account_id, currency) DO UPDATE SET balance = EXCLUDED.balance, updated_at = NOW()`
+	if _, err := store.Conn(ctx, db.DB).ExecContext(ctx, query, accountID, cur, balance); err != nil {
+		return fmt.Errorf("could not update pocket balance: %w", err)
+	}
+	return nil
+}
+
+// GetPockets returns the pocket balances of the given accounts by account ID
+// and currency.
+func (db *DB) GetPockets(ctx context.Context, accountIDs []string) (map[string]map[string]float64, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `SELECT account_id, currency, balance FROM account_balances WHERE account_id = ANY($1)`, pq.Array(accountIDs))
+	if err != nil {
+		return nil, fmt.Errorf("could not get pockets: %w", err)
+	}
+	defer rows.Close()
+
+	pockets := make(map[string]map[string]float64)
+	for rows.Next() {
+		var accountID, cur string
+		var balance float64
+		if err := rows.Scan(&accountID, &cur, &balance); err != nil {
+			return nil, fmt.Errorf("could not scan pocket: %w", err)
+		}
+		if pockets[accountID] == nil {
+			pockets[accountID] = make(map[string]float64)
+		}
+		pockets[accountID][cur] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pockets: %w", err)
+	}
+	return pockets, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/clock"
+	"banking-backend/config"
+	"banking-backend/currency"
+	"banking-backend/fees"
+	"banking-backend/health"
+	"banking-backend/interest"
+	"banking-backend/limits"
+	"banking-backend/notifications"
+	"banking-backend/payments"
+	"banking-backend/store"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"database/sql"
+	"time"
+)
+
+// repositories are the stores the application runs on.
+type repositories struct {
+	Tx           store.Transactor
+	Users        auth.UserRepository
+	Accounts     account.Repository
+	Transactions transactions.Repository
+	Overrides    limits.Repository
+	Orders       payments.Repository
+	Accruals     interest.Repository
+}
+
+// newApp wires the API and its background jobs. Everything is stored in db,
+// or in memory when db is nil. FX quotes, beneficiaries and notifications
+// only exist in Postgres: without a database they are left out, transfers can
+// only reach the user's own accounts and notifications go to the log.
+func newApp(cfg *config.Config, db *sql.DB, c clock.Clock) (*app, error) {
+	// Account numbers are IBANs built from the configured bank and branch codes
+	ibanGenerator, err := account.NewIBANGenerator(cfg.IBAN)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exchange rates come from Frankfurter (or a static file) through a cache
+	fxSources, err := currency.NewSources(db, cfg.FX)
+	if err != nil {
+		return nil, err
+	}
+	feeSchedule, err := fees.NewSchedule(cfg.Fees)
+	if err != nil {
+		return nil, err
+	}
+	dayCount, err := interest.ParseDayCount(cfg.Interest.DayCount)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter, err := auth.NewRateLimiterFromConfig(db, cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos repositories
+	if db != nil {
+		repos = repositories{
+			Tx:           store.Postgres{DB: db},
+			Users:        &auth.DB{DB: db},
+			Accounts:     &account.DB{DB: db},
+			Transactions: &transactions.DB{DB: db},
+			Overrides:    &limits.DB{DB: db},
+			Orders:       &payments.DB{DB: db},
+			Accruals:     &interest.DB{DB: db},
+		}
+	} else {
+		s := memory.New()
+		s.Clock = c
+		repos = repositories{Tx: s, Users: s, Accounts: s, Transactions: s, Overrides: s, Orders: s, Accruals: s}
+	}
+
+	limitsEngine, err := limits.NewEngine(limits.Stores{
+		Tx:           repos.Tx,
+		Overrides:    repos.Overrides,
+		Accounts:     repos.Accounts,
+		Transactions: repos.Transactions,
+	}, fxSources.Rates, c, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+	transactionsEnv := &transactions.Env{
+		Tx:           repos.Tx,
+		Clock:        c,
+		Accounts:     repos.Accounts,
+		Transactions: repos.Transactions,
+		Rates:        fxSources.Rates,
+		Limits:       limitsEngine,
+		Fees:         feeSchedule,
+	}
+	paymentsEnv := &payments.Env{Orders: repos.Orders, Accounts: repos.Accounts, Clock: c}
+	checks := []health.Check{{Name: "fx_provider", Func: fxSources.Ping}}
+	var notifier notifications.Notifier = notifications.LogNotifier{}
+
+	a := &app{
+		Auth:         auth.NewEnv(repos.Users, cfg.Auth),
+		Accounts:     &account.Env{Accounts: repos.Accounts, IBAN: ibanGenerator, Tx: repos.Tx, Funder: transactionsEnv},
+		Transactions: transactionsEnv,
+		Limits:       limitsEngine,
+		Currency:     currency.NewEnv(db, fxSources, cfg.FX),
+		Payments:     paymentsEnv,
+		RateLimiter:  rateLimiter,
+		RateLimits:   cfg.RateLimit,
+	}
+	if db != nil {
+		payees := &beneficiaries.Payees{DB: db}
+		transactionsEnv.Quotes = &currency.QuoteStore{DB: db}
+		transactionsEnv.Payees = payees
+		paymentsEnv.Payees = payees
+
+		notificationStore := &notifications.Store{DB: db}
+		notifier = notificationStore
+		a.Notifications = &notifications.Env{Store: notificationStore}
+		a.Beneficiaries = beneficiaries.NewEnv(db, notifications.LogCodeSender{}, c, cfg.Beneficiaries)
+		checks = append([]health.Check{{Name: "database", Critical: true, Func: db.PingContext}}, checks...)
+	}
+	a.Health = health.NewChecker(2*time.Second, checks...)
+
+	a.Interest = interest.NewEngine(interest.Stores{
+		Tx:           repos.Tx,
+		Accruals:     repos.Accruals,
+		Accounts:     repos.Accounts,
+		Transactions: repos.Transactions,
+	}, c, dayCount)
+	a.Scheduler = payments.NewScheduler(repos.Orders, transactionsEnv, notifier, c)
+	return a, nil
+}
@@ -1,27 +1,40 @@
 package auth
 
 import (
+	"banking-backend/config"
+	"banking-backend/metrics"
+	"banking-backend/store"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // --- Models ---
 
+// User roles. Customers are the default; support and admin staff can run
+// back-office operations such as reversals.
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
 	ID               string    `json:"id"`
 	DNI              string    `json:"dni"`
 	GeneratedPinHash string    `json:"-"`
 	FullName         string    `json:"full_name"`
 	Email            string    `json:"email"`
+	Role             string    `json:"role"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
 
@@ -48,38 +61,41 @@ type Claims struct {
 
 // --- Database ---
 
+// ErrUserExists is returned when the DNI or the email is already registered.
+var ErrUserExists = errors.New("user already exists")
+
+// UserRepository stores users. Lookups return nil, nil when nothing matches.
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *User, pinHash string) (string, error)
+	GetUserByDNI(ctx context.Context, dni string) (*User, error)
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	UpdatePinHash(ctx context.Context, userID, newPinHash string) error
+}
+
+// DB is the UserRepository backed by Postgres.
 type DB struct {
 	*sql.DB
 }
 
 func (db *DB) CreateUser(ctx context.Context, user *User, pinHash string) (string, error) {
 	var id string
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return "", fmt.Errorf("could not begin transaction: %w", err)
-	}
-	defer func(tx *sql.Tx) {
-		_ = tx.Rollback()
-	}(tx) // Rollback in case of an error
-
 	query := `INSERT INTO users (dni, generated_pin_hash, full_name, email)
 			  VALUES ($1, $2, $3, $4) RETURNING id`
-	err = tx.QueryRowContext(ctx, query, user.DNI, pinHash, user.FullName, user.Email).Scan(&id)
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, user.DNI, pinHash, user.FullName, user.Email).Scan(&id)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return "", ErrUserExists
+		}
 		return "", fmt.Errorf("could not create user: %w", err)
 	}
-
-	if err := tx.Commit(); err != nil {
-		return "", fmt.Errorf("could not commit transaction: %w", err)
-	}
-
 	return id, nil
 }
 
-func (db *DB) GetUserByDNI(dni string) (*User, error) {
+func (db *DB) GetUserByDNI(ctx context.Context, dni string) (*User, error) {
 	user := &User{}
-	query := `SELECT id, dni, generated_pin_hash, full_name, email, updated_at FROM users WHERE dni = $1`
-	err := db.QueryRow(query, dni).Scan(&user.ID, &user.DNI, &user.GeneratedPinHash, &user.FullName, &user.Email, &user.UpdatedAt)
+	query := `SELECT id, dni, generated_pin_hash, full_name, email, role, updated_at FROM users WHERE dni = $1`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, dni).Scan(&user.ID, &user.DNI, &user.GeneratedPinHash, &user.FullName, &user.Email, &user.Role, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -89,10 +105,10 @@ func (db *DB) GetUserByDNI(dni string) (*User, error) {
 	return user, nil
 }
 
-func (db *DB) GetUserByID(id string) (*User, error) {
+func (db *DB) GetUserByID(ctx context.Context, id string) (*User, error) {
 	user := &User{}
-	query := `SELECT id, dni, generated_pin_hash, full_name, email, updated_at FROM users WHERE id = $1`
-	err := db.QueryRow(query, id).Scan(&user.ID, &user.DNI, &user.GeneratedPinHash, &user.FullName, &user.Email, &user.UpdatedAt)
+	query := `SELECT id, dni, generated_pin_hash, full_name, email, role, updated_at FROM users WHERE id = $1`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, id).Scan(&user.ID, &user.DNI, &user.GeneratedPinHash, &user.FullName, &user.Email, &user.Role, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -102,9 +118,9 @@ func (db *DB) GetUserByID(id string) (*User, error) {
 	return user, nil
 }
 
-func (db *DB) UpdatePinHash(userID, newPinHash string) error {
+func (db *DB) UpdatePinHash(ctx context.Context, userID, newPinHash string) error {
 	query := `UPDATE users SET generated_pin_hash = $1, updated_at = NOW() WHERE id = $2`
-	_, err := db.Exec(query, newPinHash, userID)
+	_, err := store.Conn(ctx, db.DB).ExecContext(ctx, query, newPinHash, userID)
 	if err != nil {
 		return fmt.Errorf("could not update pin hash: %w", err)
 	}
@@ -113,24 +129,23 @@ func (db *DB) UpdatePinHash(userID, newPinHash string) error {
 
 // --- JWT ---
 
-func getJWTKey() []byte {
-	key := os.Getenv("JWT_SECRET")
-	if key == "" {
+func (env *Env) jwtKey() []byte {
+	if env.Tokens.JWTSecret == "" {
 		return []byte("my_secret_key") // Default key for development
 	}
-	return []byte(key)
+	return []byte(env.Tokens.JWTSecret)
 }
 
-func GenerateTokens(userID string) (string, string, error) {
+func (env *Env) GenerateTokens(userID string) (string, string, error) {
 	// Generate access token
 	accessTokenClaims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)), // Access token expires in 15 minutes
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(env.Tokens.AccessTokenTTL)),
 		},
 	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString(getJWTKey())
+	accessTokenString, err := accessToken.SignedString(env.jwtKey())
 	if err != nil {
 		return "", "", err
 	}
@@ -139,11 +154,11 @@ func GenerateTokens(userID string) (string, string, error) {
 	refreshTokenClaims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // Refresh token expires in 7 days
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(env.Tokens.RefreshTokenTTL)),
 		},
 	}
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	refreshTokenString, err := refreshToken.SignedString(getJWTKey())
+	refreshTokenString, err := refreshToken.SignedString(env.jwtKey())
 	if err != nil {
 		return "", "", err
 	}
@@ -151,10 +166,10 @@ func GenerateTokens(userID string) (string, string, error) {
 	return accessTokenString, refreshTokenString, nil
 }
 
-func ValidateJWT(tokenStr string) (*Claims, error) {
+func (env *Env) ValidateJWT(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return getJWTKey(), nil
+		return env.jwtKey(), nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("token has expired, please log in again")
@@ -168,7 +183,13 @@ func ValidateJWT(tokenStr string) (*Claims, error) {
 // --- Handlers ---
 
 type Env struct {
-	DB *sql.DB
+	Users  UserRepository
+	Tokens config.Auth // Signs and expires the tokens
+}
+
+// NewEnv takes the JWT secret and the token lifetimes from cfg.
+func NewEnv(users UserRepository, cfg config.Auth) *Env {
+	return &Env{Users: users, Tokens: cfg}
 }
 
 type TokenResponse struct {
@@ -189,9 +210,12 @@ func (env *Env) SignupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := &DB{env.DB}
 	user := &User{DNI: req.DNI, FullName: req.FullName, Email: req.Email}
-	userID, err := db.CreateUser(r.Context(), user, pinHash)
+	userID, err := env.Users.CreateUser(r.Context(), user, pinHash)
+	if errors.Is(err, ErrUserExists) {
+		RespondWithError(w, http.StatusConflict, "A user with this DNI or email already exists")
+		return
+	}
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
 		return
@@ -207,20 +231,22 @@ func (env *Env) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := &DB{env.DB}
-	user, err := db.GetUserByDNI(req.DNI)
+	user, err := env.Users.GetUserByDNI(r.Context(), req.DNI)
 	if err != nil || user == nil {
+		metrics.ObserveLogin(metrics.LoginFailure)
 		RespondWithError(w, http.StatusUnauthorized, "Invalid DNI or PIN")
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.GeneratedPinHash), []byte(req.Pin))
 	if err != nil {
+		metrics.ObserveLogin(metrics.LoginFailure)
 		RespondWithError(w, http.StatusUnauthorized, "Invalid DNI or PIN")
 		return
 	}
+	metrics.ObserveLogin(metrics.LoginSuccess)
 
-	accessToken, refreshToken, err := GenerateTokens(user.ID)
+	accessToken, refreshToken, err := env.GenerateTokens(user.ID)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to generate tokens")
 		return
@@ -245,13 +271,13 @@ func (env *Env) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := ValidateJWT(req.RefreshToken)
+	claims, err := env.ValidateJWT(req.RefreshToken)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	}
 
-	accessToken, refreshToken, err := GenerateTokens(claims.UserID)
+	accessToken, refreshToken, err := env.GenerateTokens(claims.UserID)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to generate tokens")
 		return
@@ -290,8 +316,7 @@ func (env *Env) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := &DB{env.DB}
-	user, err := db.GetUserByID(userID)
+	user, err := env.Users.GetUserByID(r.Context(), userID)
 	if err != nil || user == nil {
 		RespondWithError(w, http.StatusNotFound, "User not found")
 		return
@@ -303,7 +328,7 @@ func (env *Env) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = db.UpdatePinHash(userID, pinHash)
+	err = env.Users.UpdatePinHash(r.Context(), userID, pinHash)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to update PIN")
 		return
@@ -314,7 +339,7 @@ func (env *Env) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 
 // --- Middleware ---
 
-func AuthenticationMiddleware(next http.Handler) http.Handler {
+func (env *Env) AuthenticationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -328,13 +353,43 @@ func AuthenticationMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		claims, err := ValidateJWT(tokenString)
+		claims, err := env.ValidateJWT(tokenString)
 		if err != nil {
 			RespondWithError(w, http.StatusUnauthorized, "Token has expired, please log in again")
 			return
 		}
 
+		logUserID(r, claims.UserID)
 		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole only lets through users holding one of roles. It must run after
+// AuthenticationMiddleware. The role is read from the database on every
+// request so revoking it takes effect immediately.
+func (env *Env) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromContext(r)
+			if err != nil {
+				RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			user, err := env.Users.GetUserByID(r.Context(), userID)
+			if err != nil || user == nil {
+				RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			RespondWithError(w, http.StatusForbidden, "Insufficient permissions")
+		})
+	}
+}
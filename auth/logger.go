@@ -1,24 +1,162 @@
 package auth
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"banking-backend/server"
 )
 
 // --- Logger ---
 
+const RequestIDHeader = "X-Request-ID"
+
+const requestLogKey contextKey = "requestLog"
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are log attributes and query parameters whose values are
+// never written, compared case-insensitively.
+var sensitiveKeys = map[string]bool{
+	"pin":               true,
+	"new_pin":           true,
+	"password":          true,
+	"token":             true,
+	"access_token":      true,
+	"refresh_token":     true,
+	"authorization":     true,
+	"cvv":               true,
+	"card_number":       true,
+	"verification_code": true,
+}
+
+// requestLog is shared through the request context so inner middleware can
+// add fields to the access log written by Logger.
+type requestLog struct {
+	id     string
+	userID string
+}
+
+// NewLogger returns a JSON logger that redacts sensitive attributes.
+func NewLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if sensitiveKeys[strings.ToLower(a.Key)] {
+				return slog.String(a.Key, redacted)
+			}
+			return a
+		},
+	}))
+}
+
+// Logger writes an access log entry per request. It reuses the X-Request-ID
+// of the request when it is well formed, generates one otherwise, and echoes
+// it in the response.
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		next.ServeHTTP(w, r)
+		entry := &requestLog{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(entry.id) {
+			entry.id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, entry.id)
+
+		sw := &server.StatusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestLogKey, entry)))
+
+		status := sw.StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
 
-		log.Printf(
-			"%s %s %s",
-			r.Method,
-			r.RequestURI,
-			time.Since(start),
-		)
+		attrs := []slog.Attr{
+			slog.String("request_id", entry.id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", sw.Bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if r.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", redactQuery(r.URL.Query())))
+		}
+		if entry.userID != "" {
+			attrs = append(attrs, slog.String("user_id", entry.userID))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
+
+// RequestIDFromContext returns the ID Logger assigned to the request, or ""
+// outside of it.
+func RequestIDFromContext(ctx context.Context) string {
+	if entry, ok := ctx.Value(requestLogKey).(*requestLog); ok {
+		return entry.id
+	}
+	return ""
+}
+
+// LoggerFromContext returns the default logger with the request_id and, once
+// authenticated, the user_id of the request ctx belongs to, so handlers and
+// the stores they call can be correlated with the access log. Outside of a
+// request it returns the default logger.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	entry, ok := ctx.Value(requestLogKey).(*requestLog)
+	if !ok {
+		return slog.Default()
+	}
+	logger := slog.Default().With(slog.String("request_id", entry.id))
+	if entry.userID != "" {
+		logger = logger.With(slog.String("user_id", entry.userID))
+	}
+	return logger
+}
+
+// logUserID adds the authenticated user to the access log of the request.
+func logUserID(r *http.Request, userID string) {
+	if entry, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
+func redactQuery(query url.Values) string {
+	for key := range query {
+		if sensitiveKeys[strings.ToLower(key)] {
+			query[key] = []string{redacted}
+		}
+	}
+	return query.Encode()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
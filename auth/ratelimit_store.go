@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"banking-backend/clock"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// --- Rate Limit Stores ---
+
+// Store counts hits per key in fixed windows.
+type Store interface {
+	// Hit records a hit for key in the window starting at windowStart and
+	// returns the hits of that window, including this one, and of the
+	// previous window.
+	Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (current, previous int, err error)
+}
+
+// MemoryStore keeps the counters in process. Each replica counts on its own.
+type MemoryStore struct {
+	Clock clock.Clock // Times the sweeps
+
+	mutex     sync.Mutex
+	counters  map[string]map[time.Time]int
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Clock: clock.System{}, counters: make(map[string]map[time.Time]int)}
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (int, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	windows, ok := s.counters[key]
+	if !ok {
+		windows = make(map[time.Time]int)
+		s.counters[key] = windows
+	}
+	windows[windowStart]++
+	previousStart := windowStart.Add(-window)
+	for start := range windows {
+		if start.Before(previousStart) {
+			delete(windows, start)
+		}
+	}
+
+	s.sweep(s.Clock.Now())
+	return windows[windowStart], windows[previousStart], nil
+}
+
+// sweep drops the keys that were not hit for an hour, at most once a minute.
+// Windows longer than an hour lose their previous window after a quiet hour,
+// which only makes the limiter more lenient.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, windows := range s.counters {
+		stale := true
+		for start := range windows {
+			if now.Sub(start) < time.Hour {
+				stale = false
+				break
+			}
+		}
+		if stale {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// PostgresStore keeps the counters in the rate_limit_counters table so every
+// replica shares them.
+type PostgresStore struct {
+	DB *sql.DB
+
+	mutex       sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+func (s *PostgresStore) Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (int, int, error) {
+	var current, previous int
+	err := s.DB.QueryRowContext(ctx, `
+		WITH hit AS (
+			INSERT INTO rate_limit_counters (key, window_start, count) VALUES ($1, $2, 1)
+			ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+			RETURNING count
+		)
+		SELECT hit.count, COALESCE((SELECT count FROM rate_limit_counters WHERE key = $1 AND window_start = $3), 0)
+		FROM hit`,
+		key, windowStart, windowStart.Add(-window)).Scan(&current, &previous)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not count hit: %w", err)
+	}
+
+	s.cleanup(windowStart)
+	return current, previous, nil
+}
+
+// cleanup deletes the counters older than a day, at most once a minute per
+// replica.
+func (s *PostgresStore) cleanup(now time.Time) {
+	s.mutex.Lock()
+	if now.Sub(s.lastCleanup) < time.Minute {
+		s.mutex.Unlock()
+		return
+	}
+	s.lastCleanup = now
+	s.mutex.Unlock()
+
+	go func() {
+		_, err := s.DB.Exec(`DELETE FROM rate_limit_counters WHERE window_start < $1`, now.Add(-24*time.Hour))
+		if err != nil {
+			slog.Error("could not clean up rate limit counters", "error", err)
+		}
+	}()
+}
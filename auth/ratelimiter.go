@@ -1,54 +1,255 @@
 package auth
 
 import (
+	"banking-backend/clock"
+	"banking-backend/config"
+	"banking-backend/metrics"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // --- Rate Limiter ---
 
+// The limiter uses a sliding-window counter: hits are counted in fixed
+// windows and the previous window is weighted by how much of it still
+// overlaps the sliding window ending now.
+
+// KeyFunc identifies the client a request is counted against.
+type KeyFunc func(rl *RateLimiter, r *http.Request) string
+
+// Policy allows Limit requests per Window for each key.
+type Policy struct {
+	Name   string // Namespaces the counters, e.g. "login"
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
 type RateLimiter struct {
-	requests map[string]int
-	mutex    sync.Mutex
+	Store          Store
+	TrustedProxies []*net.IPNet // Proxies whose X-Forwarded-For is trusted
+	Clock          clock.Clock
 }
 
-func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string]int),
+// NewPolicy builds a policy from a configured rate.
+func NewPolicy(name string, rate config.Rate, key KeyFunc) Policy {
+	return Policy{Name: name, Limit: rate.Limit, Window: rate.Window, Key: key}
+}
+
+func NewRateLimiter(store Store, trustedProxies []*net.IPNet) *RateLimiter {
+	return &RateLimiter{Store: store, TrustedProxies: trustedProxies, Clock: clock.System{}}
+}
+
+// NewRateLimiterFromConfig selects the store ("memory", or "postgres" to
+// share counters between replicas) and parses the trusted proxies.
+func NewRateLimiterFromConfig(db *sql.DB, cfg config.RateLimit) (*RateLimiter, error) {
+	var store Store
+	switch cfg.Store {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		if db == nil {
+			return nil, errors.New("the postgres rate limit store needs a database")
+		}
+		store = NewPostgresStore(db)
+	default:
+		return nil, fmt.Errorf("invalid rate limit store %q", cfg.Store)
+	}
+
+	proxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
 	}
+	return NewRateLimiter(store, proxies), nil
 }
 
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ipAddress := r.RemoteAddr
+// ParseTrustedProxies parses a list of IPs and CIDRs.
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 128
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
 
-		rl.mutex.Lock()
-		count, exists := rl.requests[ipAddress]
-		if !exists {
-			rl.requests[ipAddress] = 1
-			rl.mutex.Unlock()
-			go rl.resetCount(ipAddress)
+// Limit enforces every policy on the wrapped handler. Responses carry the
+// X-RateLimit-* headers of the most restrictive policy, and Retry-After when
+// the request is rejected. Store failures are logged and let the request
+// through.
+func (rl *RateLimiter) Limit(policies ...Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := rl.Clock.Now()
+			remaining := math.MaxInt
+			for _, policy := range policies {
+				result, err := rl.hit(r.Context(), policy, policy.Key(rl, r), now)
+				if err != nil {
+					LoggerFromContext(r.Context()).Error("rate limiter store failed", "policy", policy.Name, "error", err)
+					continue
+				}
+				if result.remaining > remaining {
+					continue
+				}
+				remaining = result.remaining
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(policy.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(result.remaining, 0)))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(result.reset)))
+				if result.remaining < 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(seconds(result.retryAfter)))
+					metrics.ObserveRateLimitRejection(policy.Name)
+					RespondWithError(w, http.StatusTooManyRequests, "Too many requests")
+					return
+				}
+			}
 			next.ServeHTTP(w, r)
-			return
-		}
+		})
+	}
+}
 
-		if count >= 5 { // Allow 5 requests per minute
-			rl.mutex.Unlock()
-			RespondWithError(w, http.StatusTooManyRequests, "Too many requests")
-			return
+type limitResult struct {
+	remaining  int           // Negative once the limit is exceeded
+	reset      time.Duration // Until the current window ends
+	retryAfter time.Duration // Until one more request would be allowed
+}
+
+func (rl *RateLimiter) hit(ctx context.Context, policy Policy, key string, now time.Time) (*limitResult, error) {
+	windowStart := now.Truncate(policy.Window)
+	current, previous, err := rl.Store.Hit(ctx, policy.Name+":"+key, windowStart, policy.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := now.Sub(windowStart)
+	overlap := 1 - float64(elapsed)/float64(policy.Window)
+	estimate := float64(previous)*overlap + float64(current)
+
+	result := &limitResult{
+		remaining: policy.Limit - int(math.Ceil(estimate)),
+		reset:     policy.Window - elapsed,
+	}
+	if result.remaining < 0 {
+		// The retry is one more hit. Within the current window the weight of
+		// the previous one decays linearly; if the current hits alone leave no
+		// room, the retry waits until they decay in turn as the previous
+		// window of the next one.
+		limit := float64(policy.Limit)
+		if float64(current+1) <= limit {
+			excess := estimate + 1 - limit
+			result.retryAfter = time.Duration(excess / float64(previous) * float64(policy.Window))
+		} else {
+			result.retryAfter = result.reset + time.Duration((1-(limit-1)/float64(current))*float64(policy.Window))
 		}
+	}
+	return result, nil
+}
+
+func seconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
 
-		rl.requests[ipAddress] = count + 1
-		rl.mutex.Unlock()
+// --- Keys ---
 
-		next.ServeHTTP(w, r)
-	})
+// KeyByIP counts requests per client IP.
+func KeyByIP(rl *RateLimiter, r *http.Request) string {
+	return "ip:" + rl.ClientIP(r)
+}
+
+// KeyByUser counts requests per authenticated user. It must run after
+// AuthenticationMiddleware; anonymous requests are counted per IP.
+func KeyByUser(rl *RateLimiter, r *http.Request) string {
+	if userID, err := GetUserIDFromContext(r); err == nil {
+		return "user:" + userID
+	}
+	return KeyByIP(rl, r)
 }
 
-func (rl *RateLimiter) resetCount(ipAddress string) {
-	time.Sleep(1 * time.Minute)
-	rl.mutex.Lock()
-	delete(rl.requests, ipAddress)
-	rl.mutex.Unlock()
+// maxKeyBodySize bounds the body read to extract the DNI.
+const maxKeyBodySize = 1 << 16
+
+// KeyByDNI counts requests per DNI in the JSON body, so credential stuffing
+// against one user is limited across IPs. Requests without one are counted
+// per IP. The body is restored for the handler.
+func KeyByDNI(rl *RateLimiter, r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodySize))
+	if err != nil {
+		return KeyByIP(rl, r)
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	var req struct {
+		DNI string `json:"dni"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.DNI == "" {
+		return KeyByIP(rl, r)
+	}
+	return "dni:" + strings.ToUpper(strings.TrimSpace(req.DNI))
+}
+
+// ClientIP returns the IP of the client. X-Forwarded-For is only honoured
+// when the connection comes from a trusted proxy; it is then walked from the
+// right, skipping trusted proxies, so clients cannot spoof it.
+func (rl *RateLimiter) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !rl.trusted(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !rl.trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (rl *RateLimiter) trusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range rl.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"banking-backend/clock"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counts is a store reporting fixed hit counts.
+type counts struct {
+	current, previous int
+}
+
+func (c counts) Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (int, int, error) {
+	return c.current, c.previous, nil
+}
+
+func TestHit(t *testing.T) {
+	windowStart := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	policy := Policy{Name: "test", Limit: 10, Window: time.Minute, Key: KeyByIP}
+
+	tests := []struct {
+		name              string
+		elapsed           time.Duration
+		current, previous int
+		remaining         int
+		retryAfter        time.Duration
+	}{
+		{"only current hits", 30 * time.Second, 4, 0, 6, 0},
+		{"previous window weighs its overlap", 15 * time.Second, 3, 8, 1, 0},
+		{"estimate rounds up", 20 * time.Second, 2, 3, 6, 0},
+		{"exactly at the limit", 30 * time.Second, 8, 4, 0, 0},
+		// 8*0.75+5 = 11; with the retry, 8*0.5+6 = 10 at 30s
+		{"over while the previous window decays", 15 * time.Second, 5, 8, -1, 15 * time.Second},
+		// 10+1 = 11; with the retry, 10*0.8+2 = 10 at 12s
+		{"over at the window start", 0, 1, 10, -1, 12 * time.Second},
+		// The retry finds no room until the 12 hits decay to 9 as the
+		// previous window, a quarter into the next one
+		{"current hits alone over", 30 * time.Second, 12, 0, -2, 45 * time.Second},
+		{"current hits alone at the limit", 30 * time.Second, 10, 4, -2, 30*time.Second + 6*time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &RateLimiter{Store: counts{tt.current, tt.previous}}
+			result, err := rl.hit(context.Background(), policy, "key", windowStart.Add(tt.elapsed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.remaining != tt.remaining {
+				t.Errorf("remaining = %d, want %d", result.remaining, tt.remaining)
+			}
+			if want := policy.Window - tt.elapsed; result.reset != want {
+				t.Errorf("reset = %v, want %v", result.reset, want)
+			}
+			if diff := result.retryAfter - tt.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("retryAfter = %v, want %v", result.retryAfter, tt.retryAfter)
+			}
+		})
+	}
+}
+
+// TestRetryAfter retries exactly when told to and expects to be let through.
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		bursts []time.Duration // Offsets into the minute at which bursts of limit+1 requests arrive
+	}{
+		{"first window", 2, []time.Duration{10 * time.Second}},
+		{"after a previous window", 5, []time.Duration{50 * time.Second, 70 * time.Second}},
+		{"single request", 1, []time.Duration{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewFixed(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+			store := NewMemoryStore()
+			store.Clock = c
+			rl := &RateLimiter{Store: store, Clock: c}
+			handler := rl.Limit(Policy{Name: "test", Limit: tt.limit, Window: time.Minute, Key: KeyByIP})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			request := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+				return w
+			}
+
+			start := c.Now()
+			var w *httptest.ResponseRecorder
+			for _, offset := range tt.bursts {
+				c.Set(start.Add(offset))
+				for range tt.limit + 1 {
+					w = request()
+				}
+			}
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("request over the limit = %d, want 429", w.Code)
+			}
+			retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil || retryAfter < 1 {
+				t.Fatalf("Retry-After = %q, want a positive number of seconds", w.Header().Get("Retry-After"))
+			}
+
+			c.Advance(time.Duration(retryAfter) * time.Second)
+			if w := request(); w.Code != http.StatusOK {
+				t.Errorf("request after Retry-After (%ds) = %d, want 200", retryAfter, w.Code)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := &RateLimiter{TrustedProxies: proxies}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:4321", nil, "203.0.113.7"},
+		{"untrusted peer cannot forward", "198.51.100.1:4321", []string{"203.0.113.7"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.1:4321", nil, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:4321", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed leftmost hop", "10.0.0.1:4321", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of trusted proxies", "10.0.0.1:4321", []string{"203.0.113.7, 10.0.0.3, 10.0.0.2"}, "203.0.113.7"},
+		{"only trusted hops", "10.0.0.1:4321", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop stops the walk", "10.0.0.1:4321", []string{"bogus, 10.0.0.2"}, "10.0.0.2"},
+		{"several headers", "10.0.0.1:4321", []string{"198.51.100.1", "203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"address without port", "10.0.0.1", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"IPv6 proxy", "[::1]:4321", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := rl.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyByDNI(t *testing.T) {
+	large := `{"dni": "12345678Z", "padding": "` + strings.Repeat("x", maxKeyBodySize) + `"}`
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"DNI", `{"dni": "12345678Z", "password": "secret"}`, "dni:12345678Z"},
+		{"DNI is normalized", `{"dni": " 12345678z "}`, "dni:12345678Z"},
+		{"no DNI", `{"password": "secret"}`, "ip:192.0.2.1"},
+		{"invalid JSON", `{"dni": `, "ip:192.0.2.1"},
+		{"body over the read limit", large, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/login", strings.NewReader(tt.body))
+			r.RemoteAddr = "192.0.2.1:4321"
+			if got := KeyByDNI(&RateLimiter{}, r); got != tt.want {
+				t.Errorf("KeyByDNI = %s, want %s", got, tt.want)
+			}
+			// The handler still reads the whole body
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("handler read %d bytes of the body, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+// TestMemoryStoreSweep hits a new key at each step and checks which keys are
+// kept: keys without a window in the last hour go, at most once a minute.
+func TestMemoryStoreSweep(t *testing.T) {
+	steps := []struct {
+		advance  time.Duration
+		key      string
+		wantKeys []string
+	}{
+		{0, "a", []string{"a"}},
+		{30 * time.Minute, "b", []string{"a", "b"}},
+		{31 * time.Minute, "c", []string{"b", "c"}},
+		{59*time.Minute + 30*time.Second, "d", []string{"c", "d"}},
+		// c is an hour old, but the last sweep was 30 seconds ago
+		{30 * time.Second, "e", []string{"c", "d", "e"}},
+		{time.Minute, "f", []string{"d", "e", "f"}},
+	}
+
+	c := clock.NewFixed(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	s := NewMemoryStore()
+	s.Clock = c
+	for _, step := range steps {
+		c.Advance(step.advance)
+		now := c.Now()
+		if _, _, err := s.Hit(context.Background(), step.key, now.Truncate(time.Minute), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range s.counters {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, step.wantKeys) {
+			t.Errorf("at %s the store keeps %v, want %v", now.Format(time.TimeOnly), keys, step.wantKeys)
+		}
+	}
+}
@@ -11,8 +11,7 @@ func (env *Env) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := &DB{env.DB}
-	user, err := db.GetUserByID(userID)
+	user, err := env.Users.GetUserByID(r.Context(), userID)
 	if err != nil || user == nil {
 		RespondWithError(w, http.StatusNotFound, "User not found")
 		return
@@ -23,10 +22,12 @@ func (env *Env) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		DNI      string `json:"dni"`
 		FullName string `json:"full_name"`
 		Email    string `json:"email"`
+		Role     string `json:"role"`
 	}{
 		DNI:      user.DNI,
 		FullName: user.FullName,
 		Email:    user.Email,
+		Role:     user.Role,
 	}
 
 	JSON(w, http.StatusOK, publicUser)
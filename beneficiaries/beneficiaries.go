@@ -0,0 +1,483 @@
+package beneficiaries
+
+import (
+	"banking-backend/config"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/notifications"
+	"banking-backend/store"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- Models ---
+
+const (
+	StatusPendingVerification = "pending_verification"
+	StatusCoolingOff          = "cooling_off"
+	StatusActive              = "active"
+)
+
+// maxVerificationAttempts bounds the wrong codes accepted before the payee
+// has to be added again.
+const maxVerificationAttempts = 5
+
+// Beneficiary is a saved payee. It can receive funds once verified (when 2FA
+// is required) and after its cooling-off period has passed.
+type Beneficiary struct {
+	ID                   string     `json:"id"`
+	UserID               string     `json:"-"`
+	Name                 string     `json:"name"`
+	AccountNumber        string     `json:"account_number"`
+	Nickname             string     `json:"nickname,omitempty"`
+	Status               string     `json:"status"`
+	VerifiedAt           *time.Time `json:"verified_at,omitempty"`
+	ActiveFrom           *time.Time `json:"active_from,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	verificationCodeHash string
+	verificationAttempts int
+}
+
+type BeneficiaryRequest struct {
+	Name          string `json:"name"`
+	AccountNumber string `json:"account_number"`
+	Nickname      string `json:"nickname"`
+}
+
+// UpdateBeneficiaryRequest edits the display fields of a payee. The account
+// number cannot change; the payee must be added again instead.
+type UpdateBeneficiaryRequest struct {
+	Name     *string `json:"name"`
+	Nickname *string `json:"nickname"`
+}
+
+type VerifyRequest struct {
+	Code string `json:"code"`
+}
+
+var (
+	ErrBeneficiaryNotFound  = errors.New("beneficiary not found")
+	ErrDuplicateBeneficiary = errors.New("beneficiary already exists")
+	ErrPayeeRequired        = errors.New("transfers to third parties require a saved beneficiary")
+	ErrPayeeNotActive       = errors.New("beneficiary cannot receive funds yet")
+)
+
+func (b *Beneficiary) refreshStatus(now time.Time) {
+	switch {
+	case b.ActiveFrom == nil:
+		b.Status = StatusPendingVerification
+	case now.Before(*b.ActiveFrom):
+		b.Status = StatusCoolingOff
+	default:
+		b.Status = StatusActive
+	}
+}
+
+// --- Database ---
+
+type DB struct {
+	*sql.DB
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+const beneficiaryColumns = `id, user_id, name, account_number, COALESCE(nickname, ''), verified_at, active_from,
+	COALESCE(verification_code_hash, ''), verification_attempts, created_at, updated_at`
+
+func scanBeneficiary(row interface{ Scan(...interface{}) error }) (*Beneficiary, error) {
+	b := &Beneficiary{}
+	err := row.Scan(&b.ID, &b.UserID, &b.Name, &b.AccountNumber, &b.Nickname, &b.VerifiedAt, &b.ActiveFrom,
+		&b.verificationCodeHash, &b.verificationAttempts, &b.CreatedAt, &b.UpdatedAt)
+	return b, err
+}
+
+func (db *DB) CreateBeneficiary(ctx context.Context, b *Beneficiary) error {
+	query := `INSERT INTO beneficiaries (user_id, name, account_number, nickname, verified_at, active_from, verification_code_hash)
+			  VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, '')) RETURNING id, created_at, updated_at`
+	err := db.QueryRowContext(ctx, query, b.UserID, b.Name, b.AccountNumber, b.Nickname, b.VerifiedAt, b.ActiveFrom,
+		b.verificationCodeHash).Scan(&b.ID, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDuplicateBeneficiary
+		}
+		return fmt.Errorf("could not create beneficiary: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetBeneficiary(ctx context.Context, id string) (*Beneficiary, error) {
+	b, err := scanBeneficiary(db.QueryRowContext(ctx, `SELECT `+beneficiaryColumns+` FROM beneficiaries WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get beneficiary: %w", err)
+	}
+	return b, nil
+}
+
+func (db *DB) GetBeneficiariesByUserID(ctx context.Context, userID string) ([]*Beneficiary, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+beneficiaryColumns+` FROM beneficiaries WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get beneficiaries: %w", err)
+	}
+	defer rows.Close()
+
+	beneficiaries := []*Beneficiary{}
+	for rows.Next() {
+		b, err := scanBeneficiary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan beneficiary: %w", err)
+		}
+		beneficiaries = append(beneficiaries, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating beneficiaries: %w", err)
+	}
+	return beneficiaries, nil
+}
+
+// UpdateBeneficiary saves the display fields of b.
+func (db *DB) UpdateBeneficiary(ctx context.Context, b *Beneficiary) error {
+	query := `UPDATE beneficiaries SET name = $1, nickname = NULLIF($2, ''), updated_at = NOW()
+			  WHERE id = $3 RETURNING updated_at`
+	err := db.QueryRowContext(ctx, query, b.Name, b.Nickname, b.ID).Scan(&b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("could not update beneficiary: %w", err)
+	}
+	return nil
+}
+
+// RecordFailedVerification counts a wrong code against b and returns the
+// number of wrong codes so far.
+func (db *DB) RecordFailedVerification(ctx context.Context, b *Beneficiary) (int, error) {
+	query := `UPDATE beneficiaries SET verification_attempts = verification_attempts + 1, updated_at = NOW()
+			  WHERE id = $1 RETURNING verification_attempts, updated_at`
+	err := db.QueryRowContext(ctx, query, b.ID).Scan(&b.verificationAttempts, &b.UpdatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("could not update beneficiary: %w", err)
+	}
+	return b.verificationAttempts, nil
+}
+
+// MarkVerified records the verification of b and the start of its cooling-off
+// period. It returns false when b was verified meanwhile or ran out of
+// attempts.
+func (db *DB) MarkVerified(ctx context.Context, b *Beneficiary) (bool, error) {
+	query := `UPDATE beneficiaries SET verified_at = $1, active_from = $2, verification_code_hash = NULL, updated_at = NOW()
+			  WHERE id = $3 AND verified_at IS NULL AND verification_attempts < $4 RETURNING updated_at`
+	err := db.QueryRowContext(ctx, query, b.VerifiedAt, b.ActiveFrom, b.ID, maxVerificationAttempts).Scan(&b.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not update beneficiary: %w", err)
+	}
+	b.verificationCodeHash = ""
+	return true, nil
+}
+
+func (db *DB) DeleteBeneficiary(ctx context.Context, id string) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM beneficiaries WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("could not delete beneficiary: %w", err)
+	}
+	return nil
+}
+
+// CheckPayee verifies that userID may send funds to accountNumber through a
+// saved beneficiary. It returns ErrPayeeRequired when there is none and
+// ErrPayeeNotActive while it is unverified or cooling off.
+func CheckPayee(ctx context.Context, q Querier, userID, accountNumber string, now time.Time) error {
+	var activeFrom sql.NullTime
+	query := `SELECT active_from FROM beneficiaries WHERE user_id = $1 AND account_number = $2`
+	err := q.QueryRowContext(ctx, query, userID, accountNumber).Scan(&activeFrom)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPayeeRequired
+		}
+		return fmt.Errorf("could not check beneficiary: %w", err)
+	}
+	if !activeFrom.Valid || now.Before(activeFrom.Time) {
+		return ErrPayeeNotActive
+	}
+	return nil
+}
+
+// GetAccountNumber resolves the account number of a beneficiary owned by userID.
+func GetAccountNumber(ctx context.Context, q Querier, userID, id string) (string, error) {
+	var accountNumber string
+	query := `SELECT account_number FROM beneficiaries WHERE id = $1 AND user_id = $2`
+	if err := q.QueryRowContext(ctx, query, id, userID).Scan(&accountNumber); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrBeneficiaryNotFound
+		}
+		// Malformed IDs are reported as missing beneficiaries as well
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "22P02" {
+			return "", ErrBeneficiaryNotFound
+		}
+		return "", fmt.Errorf("could not get beneficiary: %w", err)
+	}
+	return accountNumber, nil
+}
+
+// Payees exposes CheckPayee and GetAccountNumber to the ledger, inside the
+// unit of work carried by the context when there is one.
+type Payees struct {
+	DB *sql.DB
+}
+
+func (p *Payees) CheckPayee(ctx context.Context, userID, accountNumber string, now time.Time) error {
+	return CheckPayee(ctx, store.Conn(ctx, p.DB), userID, accountNumber, now)
+}
+
+func (p *Payees) GetAccountNumber(ctx context.Context, userID, id string) (string, error) {
+	return GetAccountNumber(ctx, store.Conn(ctx, p.DB), userID, id)
+}
+
+// --- Handlers ---
+
+type Env struct {
+	DB         *sql.DB
+	Codes      notifications.CodeSender // Delivers the 2FA codes out of band
+	Clock      clock.Clock
+	CoolingOff time.Duration // Delay between adding (or verifying) a payee and paying it
+	Require2FA bool          // Whether new payees must be confirmed with a one-time code
+}
+
+// NewEnv takes the cooling-off period and the 2FA requirement from cfg.
+func NewEnv(db *sql.DB, codes notifications.CodeSender, c clock.Clock, cfg config.Beneficiaries) *Env {
+	return &Env{DB: db, Codes: codes, Clock: c, CoolingOff: cfg.CoolingOff, Require2FA: cfg.Require2FA}
+}
+
+func (env *Env) CreateBeneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req BeneficiaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Name) < 3 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Name must be at least 3 characters long")
+		return
+	}
+	req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+	if err := account.ValidateIBAN(req.AccountNumber); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
+		return
+	}
+
+	now := env.Clock.Now()
+	beneficiary := &Beneficiary{
+		UserID:        userID,
+		Name:          req.Name,
+		AccountNumber: req.AccountNumber,
+		Nickname:      req.Nickname,
+	}
+
+	var code string
+	if env.Require2FA {
+		code, beneficiary.verificationCodeHash, err = auth.GeneratePINAndHash()
+		if err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to generate verification code")
+			return
+		}
+	} else {
+		activeFrom := now.Add(env.CoolingOff)
+		beneficiary.ActiveFrom = &activeFrom
+	}
+
+	db := &DB{env.DB}
+	if err := db.CreateBeneficiary(r.Context(), beneficiary); err != nil {
+		if errors.Is(err, ErrDuplicateBeneficiary) {
+			auth.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to create beneficiary")
+		return
+	}
+
+	if code != "" {
+		purpose := fmt.Sprintf("confirm beneficiary %s (%s)", beneficiary.Name, beneficiary.AccountNumber)
+		if err := env.Codes.SendCode(r.Context(), userID, purpose, code); err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to send verification code")
+			return
+		}
+	}
+
+	beneficiary.refreshStatus(now)
+	auth.JSON(w, http.StatusCreated, beneficiary)
+}
+
+func (env *Env) GetBeneficiariesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	db := &DB{env.DB}
+	beneficiaries, err := db.GetBeneficiariesByUserID(r.Context(), userID)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get beneficiaries")
+		return
+	}
+
+	now := env.Clock.Now()
+	for _, b := range beneficiaries {
+		b.refreshStatus(now)
+	}
+	auth.JSON(w, http.StatusOK, beneficiaries)
+}
+
+func (env *Env) GetBeneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiary, ok := env.loadOwnedBeneficiary(w, r)
+	if !ok {
+		return
+	}
+	auth.JSON(w, http.StatusOK, beneficiary)
+}
+
+func (env *Env) UpdateBeneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiary, ok := env.loadOwnedBeneficiary(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateBeneficiaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		if len(*req.Name) < 3 {
+			auth.RespondWithError(w, http.StatusBadRequest, "Name must be at least 3 characters long")
+			return
+		}
+		beneficiary.Name = *req.Name
+	}
+	if req.Nickname != nil {
+		beneficiary.Nickname = *req.Nickname
+	}
+
+	db := &DB{env.DB}
+	if err := db.UpdateBeneficiary(r.Context(), beneficiary); err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update beneficiary")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, beneficiary)
+}
+
+func (env *Env) DeleteBeneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiary, ok := env.loadOwnedBeneficiary(w, r)
+	if !ok {
+		return
+	}
+
+	db := &DB{env.DB}
+	if err := db.DeleteBeneficiary(r.Context(), beneficiary.ID); err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to delete beneficiary")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyBeneficiaryHandler confirms a new payee with the one-time code sent
+// to the user. The cooling-off period starts once the payee is verified.
+func (env *Env) VerifyBeneficiaryHandler(w http.ResponseWriter, r *http.Request) {
+	beneficiary, ok := env.loadOwnedBeneficiary(w, r)
+	if !ok {
+		return
+	}
+	if beneficiary.Status != StatusPendingVerification {
+		auth.RespondWithError(w, http.StatusConflict, "Beneficiary is already verified")
+		return
+	}
+	if beneficiary.verificationAttempts >= maxVerificationAttempts {
+		auth.RespondWithError(w, http.StatusForbidden, "Too many wrong codes, please add the beneficiary again")
+		return
+	}
+
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	db := &DB{env.DB}
+	if bcrypt.CompareHashAndPassword([]byte(beneficiary.verificationCodeHash), []byte(req.Code)) != nil {
+		// Concurrent guesses are all counted
+		attempts, err := db.RecordFailedVerification(r.Context(), beneficiary)
+		if err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update beneficiary")
+			return
+		}
+		if attempts >= maxVerificationAttempts {
+			auth.RespondWithError(w, http.StatusForbidden, "Too many wrong codes, please add the beneficiary again")
+			return
+		}
+		auth.RespondWithError(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	now := env.Clock.Now()
+	activeFrom := now.Add(env.CoolingOff)
+	beneficiary.VerifiedAt = &now
+	beneficiary.ActiveFrom = &activeFrom
+	verified, err := db.MarkVerified(r.Context(), beneficiary)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update beneficiary")
+		return
+	}
+	if !verified {
+		auth.RespondWithError(w, http.StatusConflict, "Beneficiary was verified or locked by another request")
+		return
+	}
+
+	beneficiary.refreshStatus(now)
+	auth.JSON(w, http.StatusOK, beneficiary)
+}
+
+// loadOwnedBeneficiary loads the {id} beneficiary of the authenticated user,
+// writing the error response itself when it cannot.
+func (env *Env) loadOwnedBeneficiary(w http.ResponseWriter, r *http.Request) (*Beneficiary, bool) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	db := &DB{env.DB}
+	beneficiary, err := db.GetBeneficiary(r.Context(), r.PathValue("id"))
+	if err != nil || beneficiary == nil || beneficiary.UserID != userID {
+		auth.RespondWithError(w, http.StatusNotFound, ErrBeneficiaryNotFound.Error())
+		return nil, false
+	}
+
+	beneficiary.refreshStatus(env.Clock.Now())
+	return beneficiary, true
+}
@@ -0,0 +1,122 @@
+package cards
+
+import (
+	"banking-backend/store"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Models ---
+
+const (
+	TypeDebit  = "debit"
+	TypeCredit = "credit"
+)
+
+const (
+	StatusActive  = "active"
+	StatusBlocked = "blocked"
+)
+
+// Card numbers are stored tokenized; the CVV is only kept as a hash.
+type Card struct {
+	ID         string    `json:"id"`
+	AccountID  string    `json:"account_id"`
+	CardNumber string    `json:"card_number"`
+	CardType   string    `json:"card_type"`
+	ExpiryDate time.Time `json:"expiry_date"`
+	CVVHash    string    `json:"-"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// --- Database ---
+
+// ErrDuplicateCardNumber is returned when the card number is already issued.
+var ErrDuplicateCardNumber = errors.New("card number already exists")
+
+// Repository stores the cards of accounts. Lookups return nil, nil when
+// nothing matches.
+type Repository interface {
+	CreateCard(ctx context.Context, card *Card) (string, error)
+	GetCardByID(ctx context.Context, id string) (*Card, error)
+	GetCardsByAccountID(ctx context.Context, accountID string) ([]*Card, error)
+	UpdateCardStatus(ctx context.Context, id, status string) error
+}
+
+// DB is the Repository backed by Postgres.
+type DB struct {
+	*sql.DB
+}
+
+const cardColumns = `id, account_id, card_number, card_type, expiry_date, cvv_hash, status, created_at, updated_at`
+
+func (db *DB) CreateCard(ctx context.Context, card *Card) (string, error) {
+	if card.Status == "" {
+		card.Status = StatusActive
+	}
+	var id string
+	query := `INSERT INTO cards (account_id, card_number, card_type, expiry_date, cvv_hash, status)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, card.AccountID, card.CardNumber, card.CardType, card.ExpiryDate, card.CVVHash, card.Status).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "cards_card_number_key" {
+			return "", ErrDuplicateCardNumber
+		}
+		return "", fmt.Errorf("could not create card: %w", err)
+	}
+	return id, nil
+}
+
+func (db *DB) GetCardByID(ctx context.Context, id string) (*Card, error) {
+	card, err := scanCard(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+cardColumns+` FROM cards WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get card: %w", err)
+	}
+	return card, nil
+}
+
+func (db *DB) GetCardsByAccountID(ctx context.Context, accountID string) ([]*Card, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `SELECT `+cardColumns+` FROM cards WHERE account_id = $1 ORDER BY created_at, id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get cards: %w", err)
+	}
+	defer rows.Close()
+
+	var cards []*Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan card: %w", err)
+		}
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cards: %w", err)
+	}
+	return cards, nil
+}
+
+func (db *DB) UpdateCardStatus(ctx context.Context, id, status string) error {
+	query := `UPDATE cards SET status = $1 WHERE id = $2`
+	if _, err := store.Conn(ctx, db.DB).ExecContext(ctx, query, status, id); err != nil {
+		return fmt.Errorf("could not update card status: %w", err)
+	}
+	return nil
+}
+
+func scanCard(row interface{ Scan(...interface{}) error }) (*Card, error) {
+	card := &Card{}
+	err := row.Scan(&card.ID, &card.AccountID, &card.CardNumber, &card.CardType, &card.ExpiryDate, &card.CVVHash, &card.Status, &card.CreatedAt, &card.UpdatedAt)
+	return card, err
+}
@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time.Now so background jobs can be driven deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the wall clock.
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Fixed is a manually controlled clock.
+type Fixed struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func NewFixed(now time.Time) *Fixed {
+	return &Fixed{now: now}
+}
+
+func (f *Fixed) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *Fixed) Set(now time.Time) {
+	f.mutex.Lock()
+	f.now = now
+	f.mutex.Unlock()
+}
+
+func (f *Fixed) Advance(d time.Duration) {
+	f.mutex.Lock()
+	f.now = f.now.Add(d)
+	f.mutex.Unlock()
+}
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Models ---
+
+// Config is the whole application configuration. Values come from the
+// defaults, then the optional YAML file, then the environment variables
+// named in the env tags; empty variables are ignored. Fields tagged secret
+// are redacted when the configuration is printed.
+type Config struct {
+	Database      Database      `yaml:"database"`
+	HTTP          HTTP          `yaml:"http"`
+	Auth          Auth          `yaml:"auth"`
+	RateLimit     RateLimit     `yaml:"rate_limit"`
+	FX            FX            `yaml:"fx"`
+	IBAN          IBAN          `yaml:"iban"`
+	Limits        Limits        `yaml:"limits"`
+	Fees          Fees          `yaml:"fees"`
+	Beneficiaries Beneficiaries `yaml:"beneficiaries"`
+	Interest      Interest      `yaml:"interest"`
+	Tracing       Tracing       `yaml:"tracing"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host" env:"DATABASE_HOST"`
+	Port            int           `yaml:"port" env:"DATABASE_PORT"`
+	User            string        `yaml:"user" env:"POSTGRES_USER"`
+	Password        string        `yaml:"password" env:"POSTGRES_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"POSTGRES_DB"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DATABASE_SSLMODE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS"` // 0 means unlimited
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME"` // 0 means forever
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DATABASE_CONN_MAX_IDLE_TIME"`
+	AutoMigrate     bool          `yaml:"auto_migrate" env:"DATABASE_AUTO_MIGRATE"` // Apply pending migrations at startup
+}
+
+type HTTP struct {
+	Addr              string        `yaml:"addr" env:"HTTP_ADDR"`
+	MetricsAddr       string        `yaml:"metrics_addr" env:"METRICS_ADDR"` // Admin listener serving /metrics; empty disables it
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	DrainDelay        time.Duration `yaml:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`  // Between failing readiness and closing the listener
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"` // Shared by in-flight requests and workers to finish
+}
+
+type Auth struct {
+	JWTSecret       string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"` // Empty falls back to a development key
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+}
+
+type RateLimit struct {
+	Store          string   `yaml:"store" env:"RATE_LIMIT_STORE"`          // "memory" or "postgres"
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"` // IPs or CIDRs
+	Global         Rate     `yaml:"global" env:"RATE_LIMIT_GLOBAL"`
+	LoginIP        Rate     `yaml:"login_ip" env:"RATE_LIMIT_LOGIN_IP"`
+	LoginDNI       Rate     `yaml:"login_dni" env:"RATE_LIMIT_LOGIN_DNI"`
+	Signup         Rate     `yaml:"signup" env:"RATE_LIMIT_SIGNUP"`
+	Refresh        Rate     `yaml:"refresh" env:"RATE_LIMIT_REFRESH"`
+	Payments       Rate     `yaml:"payments" env:"RATE_LIMIT_PAYMENTS"`
+}
+
+type FX struct {
+	BaseURL         string        `yaml:"base_url" env:"FX_BASE_URL"`
+	StaticRatesFile string        `yaml:"static_rates_file" env:"FX_STATIC_RATES_FILE"` // Replaces the API when set
+	Timeout         time.Duration `yaml:"timeout" env:"FX_TIMEOUT"`
+	CacheTTL        time.Duration `yaml:"cache_ttl" env:"FX_CACHE_TTL"`
+	BaseCurrency    string        `yaml:"base_currency" env:"FX_BASE_CURRENCY"`
+	Spread          float64       `yaml:"spread" env:"FX_SPREAD"` // Fraction taken from the mid-market rate
+	QuoteTTL        time.Duration `yaml:"quote_ttl" env:"FX_QUOTE_TTL"`
+}
+
+type IBAN struct {
+	CountryCode string `yaml:"country_code" env:"IBAN_COUNTRY_CODE"`
+	BankCode    string `yaml:"bank_code" env:"IBAN_BANK_CODE"`
+	BranchCode  string `yaml:"branch_code" env:"IBAN_BRANCH_CODE"`
+}
+
+type Limits struct {
+	Currency string   `yaml:"currency" env:"LIMITS_CURRENCY"`
+	Account  LimitSet `yaml:"account" env:"LIMITS_ACCOUNT_"` // Bank defaults per account
+	User     LimitSet `yaml:"user" env:"LIMITS_USER_"`       // Bank defaults across the accounts of a user
+}
+
+type LimitSet struct {
+	PerTransaction float64 `yaml:"per_transaction" env:"PER_TRANSACTION"`
+	Daily          float64 `yaml:"daily" env:"DAILY"`
+	Monthly        float64 `yaml:"monthly" env:"MONTHLY"`
+	HourlyCount    int     `yaml:"hourly_count" env:"HOURLY_COUNT"`
+}
+
+type Fees struct {
+	RulesFile string `yaml:"rules_file" env:"FEE_RULES_FILE"` // No fees when empty
+}
+
+type Beneficiaries struct {
+	CoolingOff time.Duration `yaml:"cooling_off" env:"BENEFICIARY_COOLING_OFF"`
+	Require2FA bool          `yaml:"require_2fa" env:"BENEFICIARY_REQUIRE_2FA"`
+}
+
+type Interest struct {
+	DayCount string `yaml:"day_count" env:"INTEREST_DAY_COUNT"`
+}
+
+type Tracing struct {
+	Exporter     string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"` // "none", "otlp" or "stdout"
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName  string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// Rate allows Limit requests per Window. It is written as "300/1m".
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	limit, window, ok := strings.Cut(string(text), "/")
+	if !ok {
+		return fmt.Errorf("rate %q must look like 300/1m", text)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil {
+		return fmt.Errorf("rate %q has an invalid limit", text)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil {
+		return fmt.Errorf("rate %q has an invalid window", text)
+	}
+	*r = Rate{Limit: n, Window: d}
+	return nil
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// DSN returns the lib/pq connection string.
+func (d *Database) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSN(d.Host), d.Port, quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.Name), quoteDSN(d.SSLMode))
+}
+
+// quoteDSN quotes a connection string value so spaces and quotes in
+// passwords survive.
+func quoteDSN(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+	return "'" + v + "'"
+}
+
+// --- Loading ---
+
+// Default returns the configuration used for anything left unset.
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			AutoMigrate:     true,
+		},
+		HTTP: HTTP{
+			Addr:              ":8080",
+			MetricsAddr:       ":9090",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+		},
+		RateLimit: RateLimit{
+			Store:    "memory",
+			Global:   Rate{Limit: 300, Window: time.Minute},
+			LoginIP:  Rate{Limit: 5, Window: time.Minute},
+			LoginDNI: Rate{Limit: 10, Window: 15 * time.Minute},
+			Signup:   Rate{Limit: 5, Window: time.Hour},
+			Refresh:  Rate{Limit: 30, Window: time.Minute},
+			Payments: Rate{Limit: 30, Window: time.Minute},
+		},
+		FX: FX{
+			BaseURL:      "http://frankfurter:8080",
+			Timeout:      5 * time.Second,
+			CacheTTL:     10 * time.Minute,
+			BaseCurrency: "EUR",
+			Spread:       0.005,
+			QuoteTTL:     time.Minute,
+		},
+		IBAN: IBAN{CountryCode: "ES", BankCode: "9000", BranchCode: "0001"},
+		Limits: Limits{
+			Currency: "EUR",
+			Account:  LimitSet{PerTransaction: 5000, Daily: 10000, Monthly: 50000, HourlyCount: 10},
+			User:     LimitSet{PerTransaction: 10000, Daily: 20000, Monthly: 100000, HourlyCount: 20},
+		},
+		Beneficiaries: Beneficiaries{CoolingOff: 24 * time.Hour},
+		Interest:      Interest{DayCount: "ACT/365"},
+		Tracing:       Tracing{Exporter: "none", ServiceName: "banking-backend"},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// any) and the environment, and validates it.
+func Load(path string) (*Config, error) {
+	config := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil {
+			return nil, fmt.Errorf("could not decode config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// --- Validation ---
+
+var (
+	sslModes  = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	stores    = []string{"memory", "postgres"}
+	exporters = []string{"none", "otlp", "stdout"}
+)
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	db := c.Database
+	check(db.Host != "", "database.host", "is required")
+	check(db.User != "", "database.user", "is required")
+	check(db.Name != "", "database.name", "is required")
+	check(db.Port > 0 && db.Port <= 65535, "database.port", "must be between 1 and 65535")
+	check(slices.Contains(sslModes, db.SSLMode), "database.ssl_mode", "must be one of %s", strings.Join(sslModes, ", "))
+	check(db.MaxOpenConns >= 0, "database.max_open_conns", "must not be negative")
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns, "database.max_idle_conns", "must not exceed max_open_conns")
+	check(db.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	check(db.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "must not be negative")
+
+	h := c.HTTP
+	check(h.Addr != "", "http.addr", "is required")
+	check(h.MetricsAddr != h.Addr, "http.metrics_addr", "must differ from http.addr")
+	check(h.ReadHeaderTimeout >= 0 && h.ReadTimeout >= 0 && h.WriteTimeout >= 0 && h.IdleTimeout >= 0, "http", "timeouts must not be negative")
+	check(h.DrainDelay >= 0, "http.drain_delay", "must not be negative")
+	check(h.ShutdownTimeout > 0, "http.shutdown_timeout", "must be positive")
+
+	a := c.Auth
+	check(a.AccessTokenTTL > 0, "auth.access_token_ttl", "must be positive")
+	check(a.RefreshTokenTTL > a.AccessTokenTTL, "auth.refresh_token_ttl", "must be longer than access_token_ttl")
+
+	rl := c.RateLimit
+	check(slices.Contains(stores, rl.Store), "rate_limit.store", "must be one of %s", strings.Join(stores, ", "))
+	for name, rate := range map[string]Rate{
+		"global": rl.Global, "login_ip": rl.LoginIP, "login_dni": rl.LoginDNI,
+		"signup": rl.Signup, "refresh": rl.Refresh, "payments": rl.Payments,
+	} {
+		check(rate.Limit > 0 && rate.Window > 0, "rate_limit."+name, "limit and window must be positive")
+	}
+
+	fx := c.FX
+	check(fx.BaseURL != "" || fx.StaticRatesFile != "", "fx.base_url", "is required without fx.static_rates_file")
+	check(fx.Timeout > 0, "fx.timeout", "must be positive")
+	check(fx.CacheTTL >= 0, "fx.cache_ttl", "must not be negative")
+	check(len(fx.BaseCurrency) == 3, "fx.base_currency", "must be an ISO 4217 code")
+	check(fx.Spread >= 0 && fx.Spread < 1, "fx.spread", "must be in [0, 1)")
+	check(fx.QuoteTTL > 0, "fx.quote_ttl", "must be positive")
+
+	check(len(c.Limits.Currency) == 3, "limits.currency", "must be an ISO 4217 code")
+	for name, set := range map[string]LimitSet{"limits.account": c.Limits.Account, "limits.user": c.Limits.User} {
+		check(set.PerTransaction > 0 && set.Daily > 0 && set.Monthly > 0 && set.HourlyCount > 0, name, "limits must be positive")
+	}
+
+	check(c.Beneficiaries.CoolingOff >= 0, "beneficiaries.cooling_off", "must not be negative")
+	check(slices.Contains(exporters, c.Tracing.Exporter), "tracing.exporter", "must be one of %s", strings.Join(exporters, ", "))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Warnings lists settings that are valid but unsafe in production.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.Auth.JWTSecret == "" {
+		warnings = append(warnings, "JWT_SECRET is not set; tokens are signed with a development key")
+	}
+	return warnings
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Environment ---
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// applyEnv overrides the fields of config whose variable is set. A struct
+// field's env tag is a prefix for the variables of its fields.
+func applyEnv(config *Config) error {
+	return walk(reflect.ValueOf(config).Elem(), "", func(field reflect.Value, name string, _ reflect.StructField) error {
+		v := os.Getenv(name)
+		if v == "" {
+			return nil
+		}
+		if err := setValue(field, v); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, v, err)
+		}
+		return nil
+	})
+}
+
+// walk calls fn for every leaf field of v that has an env tag.
+func walk(v reflect.Value, prefix string, fn func(field reflect.Value, name string, sf reflect.StructField) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		field := v.Field(i)
+		tag := sf.Tag.Get("env")
+		if isGroup(field) {
+			if err := walk(field, prefix+tag, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+		if err := fn(field, prefix+tag, sf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isGroup tells nested sections apart from struct values such as Rate.
+func isGroup(field reflect.Value) bool {
+	return field.Kind() == reflect.Struct && !field.Addr().Type().Implements(textUnmarshalerType)
+}
+
+func setValue(field reflect.Value, v string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(v))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(v)
+	case reflect.Int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// --- Printing ---
+
+const redacted = "[REDACTED]"
+
+// Redacted returns the effective configuration keyed like the YAML file,
+// with secrets replaced, ready to be logged.
+func (c *Config) Redacted() map[string]any {
+	return redact(reflect.ValueOf(c).Elem())
+}
+
+func redact(v reflect.Value) map[string]any {
+	out := make(map[string]any, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		field := v.Field(i)
+		key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+
+		switch {
+		case isGroup(field):
+			out[key] = redact(field)
+		case sf.Tag.Get("secret") == "true":
+			if field.String() != "" {
+				out[key] = redacted
+			} else {
+				out[key] = ""
+			}
+		case field.Type() == durationType:
+			out[key] = time.Duration(field.Int()).String()
+		case field.Type().Implements(textMarshalerType):
+			text, _ := field.Interface().(encoding.TextMarshaler).MarshalText()
+			out[key] = string(text)
+		default:
+			out[key] = field.Interface()
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package currency
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-backend/auth"
+)
+
+// --- Models ---
+
+type ConversionResult struct {
+	Amount    float64 `json:"amount"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Rate      float64 `json:"rate"`
+	Converted float64 `json:"converted"`
+	RateDate  string  `json:"rate_date"`
+}
+
+// --- Handlers ---
+
+// ConvertHandler serves GET /convert?from=USD&to=EUR&amount=100 at the
+// mid-market rate. Several targets can be requested at once, either as a
+// comma-separated list or by repeating the to parameter. The response is
+// always an array with one result per target, in the order requested.
+func (env *Env) ConvertHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	amountStr := query.Get("amount")
+	if query.Get("from") == "" || len(query["to"]) == 0 || amountStr == "" {
+		auth.RespondWithError(w, http.StatusBadRequest, "Missing required query parameters: from, to, amount")
+		return
+	}
+
+	amount, err := strconv.ParseFloat(amountStr, 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	if amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+
+	from, err := LookupSupported(query.Get("from"))
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var targets []*Currency
+	seen := make(map[string]bool)
+	for _, param := range query["to"] {
+		for _, code := range strings.Split(param, ",") {
+			to, err := LookupSupported(code)
+			if err != nil {
+				auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if !seen[to.Code] {
+				seen[to.Code] = true
+				targets = append(targets, to)
+			}
+		}
+	}
+
+	results := make([]ConversionResult, 0, len(targets))
+	for _, to := range targets {
+		rate, err := env.Rates.GetRate(r.Context(), from.Code, to.Code)
+		if err != nil {
+			auth.LoggerFromContext(r.Context()).Error("could not get exchange rate", "from", from.Code, "to", to.Code, "error", err)
+			auth.RespondWithError(w, http.StatusBadGateway, "Failed to get exchange rate")
+			return
+		}
+		results = append(results, ConversionResult{
+			Amount:    from.Round(amount),
+			From:      from.Code,
+			To:        to.Code,
+			Rate:      rate.Rate,
+			Converted: to.Round(from.Round(amount) * rate.Rate),
+			RateDate:  rate.Date,
+		})
+	}
+
+	auth.JSON(w, http.StatusOK, results)
+}
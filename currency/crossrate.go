@@ -0,0 +1,111 @@
+package currency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --- Cross Rates ---
+
+// CrossRateProvider derives every pair from the table of a single base
+// currency, so one upstream call serves all conversions.
+type CrossRateProvider struct {
+	Base   string
+	Source RateTableSource
+}
+
+func (p *CrossRateProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	if rate, ok := identityRate(from, to); ok {
+		return rate, nil
+	}
+
+	table, err := p.Source.LatestRates(ctx, p.Base)
+	if err != nil {
+		return nil, err
+	}
+	return rateFromTable(table, from, to)
+}
+
+// --- Cache ---
+
+type cacheEntry struct {
+	rate      *Rate
+	expiresAt time.Time
+}
+
+// CachedProvider keeps rates for TTL, keyed by currency pair.
+type CachedProvider struct {
+	Provider RateProvider
+	TTL      time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+func NewCachedProvider(provider RateProvider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		Provider: provider,
+		TTL:      ttl,
+		entries:  make(map[string]cacheEntry),
+		now:      time.Now,
+	}
+}
+
+func (p *CachedProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	key := from + "/" + to
+
+	p.mutex.Lock()
+	entry, ok := p.entries[key]
+	p.mutex.Unlock()
+	// Callers get their own copy so they cannot alter the cached rate
+	if ok && p.now().Before(entry.expiresAt) {
+		rate := *entry.rate
+		return &rate, nil
+	}
+
+	rate, err := p.Provider.GetRate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := *rate
+	p.mutex.Lock()
+	p.entries[key] = cacheEntry{rate: &cached, expiresAt: p.now().Add(p.TTL)}
+	p.mutex.Unlock()
+
+	return rate, nil
+}
+
+// --- Tracing ---
+
+var tracer = otel.Tracer("banking-backend/currency")
+
+// TracedProvider records a span per rate lookup, whether it is served from
+// the cache or fetched upstream.
+type TracedProvider struct {
+	Provider RateProvider
+}
+
+func (p *TracedProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	ctx, span := tracer.Start(ctx, "currency.GetRate", trace.WithAttributes(
+		attribute.String("fx.from", from),
+		attribute.String("fx.to", to),
+	))
+	defer span.End()
+
+	rate, err := p.Provider.GetRate(ctx, from, to)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Float64("fx.rate", rate.Rate))
+	return rate, nil
+}
@@ -0,0 +1,116 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingProvider serves rate, or err, and counts the lookups.
+type countingProvider struct {
+	rate  float64
+	err   error
+	calls int
+}
+
+func (p *countingProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Rate{From: from, To: to, Rate: p.rate, Date: "2025-01-02"}, nil
+}
+
+func newTestCache(upstream RateProvider, ttl time.Duration) (*CachedProvider, *time.Time) {
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	cache := NewCachedProvider(upstream, ttl)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestCachedProviderTTL(t *testing.T) {
+	upstream := &countingProvider{rate: 1.1}
+	cache, now := newTestCache(upstream, time.Minute)
+	ctx := context.Background()
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		from, to  string
+		wantCalls int
+	}{
+		{"first lookup is fetched", 0, "EUR", "USD", 1},
+		{"served from the cache", 30 * time.Second, "EUR", "USD", 1},
+		{"pairs are cached separately", 0, "USD", "EUR", 2},
+		{"served until the TTL ends", 29 * time.Second, "EUR", "USD", 2},
+		{"fetched again once expired", time.Second, "EUR", "USD", 3},
+		{"cached again after the refresh", 59 * time.Second, "EUR", "USD", 3},
+	}
+	for _, step := range steps {
+		*now = now.Add(step.advance)
+		rate, err := cache.GetRate(ctx, step.from, step.to)
+		if err != nil {
+			t.Fatalf("%s: GetRate: %v", step.name, err)
+		}
+		if rate.From != step.from || rate.To != step.to || rate.Rate != 1.1 {
+			t.Errorf("%s: GetRate = %+v", step.name, rate)
+		}
+		if upstream.calls != step.wantCalls {
+			t.Errorf("%s: %d upstream lookups, want %d", step.name, upstream.calls, step.wantCalls)
+		}
+	}
+}
+
+func TestCachedProviderWithoutTTL(t *testing.T) {
+	upstream := &countingProvider{rate: 1.1}
+	cache, _ := newTestCache(upstream, 0)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetRate(context.Background(), "EUR", "USD"); err != nil {
+			t.Fatalf("GetRate: %v", err)
+		}
+	}
+	if upstream.calls != 3 {
+		t.Errorf("%d upstream lookups, want every lookup fetched", upstream.calls)
+	}
+}
+
+func TestCachedProviderDoesNotCacheErrors(t *testing.T) {
+	upstream := &countingProvider{err: errors.New("provider down")}
+	cache, _ := newTestCache(upstream, time.Minute)
+	ctx := context.Background()
+
+	if _, err := cache.GetRate(ctx, "EUR", "USD"); err == nil {
+		t.Fatal("GetRate succeeded while the provider is down")
+	}
+	upstream.err, upstream.rate = nil, 1.1
+	rate, err := cache.GetRate(ctx, "EUR", "USD")
+	if err != nil || rate.Rate != 1.1 {
+		t.Errorf("GetRate after recovery = %+v, %v, want 1.1", rate, err)
+	}
+}
+
+func TestCachedProviderReturnsCopies(t *testing.T) {
+	cache, _ := newTestCache(&countingProvider{rate: 1.1}, time.Minute)
+	ctx := context.Background()
+
+	fetched, err := cache.GetRate(ctx, "EUR", "USD")
+	if err != nil {
+		t.Fatalf("GetRate: %v", err)
+	}
+	fetched.Rate = 99
+	cached, err := cache.GetRate(ctx, "EUR", "USD")
+	if err != nil {
+		t.Fatalf("GetRate: %v", err)
+	}
+	cached.Rate = 98
+
+	again, err := cache.GetRate(ctx, "EUR", "USD")
+	if err != nil {
+		t.Fatalf("GetRate: %v", err)
+	}
+	if again.Rate != 1.1 {
+		t.Errorf("cached rate = %v after callers changed their copies, want 1.1", again.Rate)
+	}
+}
@@ -1,11 +1,19 @@
 package currency
 
 import (
-	"encoding/json"
+	"banking-backend/config"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"net/http"
+	"log/slog"
+	"strings"
+	"time"
 )
 
+// --- Models ---
+
+// ExchangeRate is a table of rates against Base as published on Date.
 type ExchangeRate struct {
 	Amount float64            `json:"amount"`
 	Base   string             `json:"base"`
@@ -13,23 +21,165 @@ type ExchangeRate struct {
 	Rates  map[string]float64 `json:"rates"`
 }
 
-func GetRate(from, to string) (float64, error) {
-	url := fmt.Sprintf("http://frankfurter:8080/v1/latest?from=%s&to=%s", from, to)
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0, err
+func (t *ExchangeRate) clone() *ExchangeRate {
+	c := *t
+	c.Rates = make(map[string]float64, len(t.Rates))
+	for code, rate := range t.Rates {
+		c.Rates[code] = rate
+	}
+	return &c
+}
+
+// Rate is the price of one unit of From expressed in To.
+type Rate struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+	Date string  `json:"date"`
+}
+
+var ErrRateNotFound = errors.New("rate not found")
+
+// --- Providers ---
+
+// RateProvider returns the latest exchange rate between two currencies.
+type RateProvider interface {
+	GetRate(ctx context.Context, from, to string) (*Rate, error)
+}
+
+// RateTableSource returns every rate published against a base currency,
+// either the latest ones or those published on a given date.
+type RateTableSource interface {
+	LatestRates(ctx context.Context, base string) (*ExchangeRate, error)
+	HistoricalRates(ctx context.Context, base string, date time.Time) (*ExchangeRate, error)
+}
+
+// Pinger is implemented by sources that can check they are reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// CurrencyLister is implemented by sources that can list the currencies they
+// quote.
+type CurrencyLister interface {
+	Currencies(ctx context.Context) ([]string, error)
+}
+
+// Sources bundles the rate sources used by the application.
+type Sources struct {
+	Base     string          // Currency every table is fetched against
+	Upstream RateTableSource // Provider the tables come from
+	Tables   RateTableSource // Upstream tables, recorded in fx_rates when there is a database
+	Rates    RateProvider    // Cached cross rates derived from Tables
+}
+
+// Ping checks that the upstream provider is reachable. Sources that cannot be
+// checked, like static tables, are always reachable.
+func (s *Sources) Ping(ctx context.Context) error {
+	if pinger, ok := s.Upstream.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// NewSources builds the rate sources used by the application. A static
+// rates file switches to a static JSON rate table; otherwise the Frankfurter
+// API at the base URL is used. The supported currencies become those the
+// source quotes, unless it cannot list them. Every fetched table is stored in
+// the fx_rates table through db, unless db is nil; rates are derived from a
+// single base currency table and cached for the cache TTL.
+func NewSources(db *sql.DB, cfg config.FX) (*Sources, error) {
+	var source RateTableSource
+	if cfg.StaticRatesFile != "" {
+		static, err := NewStaticProviderFromFile(cfg.StaticRatesFile)
+		if err != nil {
+			return nil, err
+		}
+		source = static
+	} else {
+		source = NewFrankfurterClient(cfg.BaseURL, cfg.Timeout)
 	}
-	defer resp.Body.Close()
 
-	var exchangeRate ExchangeRate
-	if err := json.NewDecoder(resp.Body).Decode(&exchangeRate); err != nil {
-		return 0, err
+	if lister, ok := source.(CurrencyLister); ok {
+		codes, err := lister.Currencies(context.Background())
+		if err != nil {
+			slog.Warn("could not list the currencies of the rate source, keeping the Frankfurter list", "error", err)
+		} else {
+			SetSupported(codes)
+		}
+	}
+	base := strings.ToUpper(cfg.BaseCurrency)
+	if _, err := LookupSupported(base); err != nil {
+		return nil, err
 	}
 
-	rate, ok := exchangeRate.Rates[to]
-	if !ok {
-		return 0, fmt.Errorf("rate not found for %s", to)
+	tables := source
+	if db != nil {
+		tables = &RecordingSource{Source: source, Store: &RateStore{DB: db}}
 	}
 
-	return rate, nil
+	return &Sources{
+		Base:     base,
+		Upstream: source,
+		Tables:   tables,
+		Rates:    &TracedProvider{Provider: NewCachedProvider(&CrossRateProvider{Base: base, Source: tables}, cfg.CacheTTL)},
+	}, nil
+}
+
+// identityRate short-circuits conversions between the same currency.
+func identityRate(from, to string) (*Rate, bool) {
+	if from != to {
+		return nil, false
+	}
+	return &Rate{From: from, To: to, Rate: 1, Date: time.Now().UTC().Format(time.DateOnly)}, true
+}
+
+// rateFromTable derives from→to from a table quoted against any base.
+func rateFromTable(table *ExchangeRate, from, to string) (*Rate, error) {
+	lookup := func(code string) (float64, error) {
+		if code == table.Base {
+			return 1, nil
+		}
+		rate, ok := table.Rates[code]
+		if !ok || rate <= 0 {
+			return 0, fmt.Errorf("%w for %s", ErrRateNotFound, code)
+		}
+		return rate, nil
+	}
+
+	fromRate, err := lookup(from)
+	if err != nil {
+		return nil, err
+	}
+	toRate, err := lookup(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rate{From: from, To: to, Rate: toRate / fromRate, Date: table.Date}, nil
+}
+
+// rebaseTable expresses every rate of table against base.
+func rebaseTable(table *ExchangeRate, base string) (*ExchangeRate, error) {
+	if base == table.Base {
+		return table, nil
+	}
+
+	rebased := &ExchangeRate{Amount: 1, Base: base, Date: table.Date, Rates: make(map[string]float64)}
+	for code := range table.Rates {
+		if code == base {
+			continue
+		}
+		rate, err := rateFromTable(table, base, code)
+		if err != nil {
+			return nil, err
+		}
+		rebased.Rates[code] = rate.Rate
+	}
+	rate, err := rateFromTable(table, base, table.Base)
+	if err != nil {
+		return nil, err
+	}
+	rebased.Rates[table.Base] = rate.Rate
+	return rebased, nil
 }
@@ -0,0 +1,128 @@
+package currency
+
+import (
+	"banking-backend/auth"
+	"banking-backend/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// --- Frankfurter ---
+
+// FrankfurterClient talks to a (self-hosted) Frankfurter API.
+type FrankfurterClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewFrankfurterClient(baseURL string, timeout time.Duration) *FrankfurterClient {
+	return &FrankfurterClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+func (c *FrankfurterClient) LatestRates(ctx context.Context, base string) (*ExchangeRate, error) {
+	return c.fetch(ctx, "latest", url.Values{"from": {base}})
+}
+
+// HistoricalRates returns the rates published on date, or on the closest
+// previous business day.
+func (c *FrankfurterClient) HistoricalRates(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	return c.fetch(ctx, date.Format(time.DateOnly), url.Values{"from": {base}})
+}
+
+// Ping checks that the API answers by listing its currencies.
+func (c *FrankfurterClient) Ping(ctx context.Context) error {
+	_, err := c.Currencies(ctx)
+	return err
+}
+
+// Currencies returns the codes of the currencies the API publishes.
+func (c *FrankfurterClient) Currencies(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/v1/currencies", nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not build currencies request: %w", err)
+	}
+	setRequestID(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach rate provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		return nil, fmt.Errorf("rate provider returned %s", resp.Status)
+	}
+	var names map[string]string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&names); err != nil {
+		return nil, fmt.Errorf("could not decode currencies: %w", err)
+	}
+	return slices.Sorted(maps.Keys(names)), nil
+}
+
+func (c *FrankfurterClient) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	if rate, ok := identityRate(from, to); ok {
+		return rate, nil
+	}
+
+	table, err := c.fetch(ctx, "latest", url.Values{"from": {from}, "to": {to}})
+	if err != nil {
+		return nil, err
+	}
+	return rateFromTable(table, from, to)
+}
+
+// fetch requests a rate table and records its latency and outcome under the
+// "latest" or "historical" endpoint.
+func (c *FrankfurterClient) fetch(ctx context.Context, path string, query url.Values) (table *ExchangeRate, err error) {
+	endpointLabel := "historical"
+	if path == "latest" {
+		endpointLabel = "latest"
+	}
+	defer func(start time.Time) { metrics.ObserveFXRequest(endpointLabel, start, err) }(time.Now())
+
+	endpoint := fmt.Sprintf("%s/v1/%s?%s", c.BaseURL, path, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not build rate request: %w", err)
+	}
+	setRequestID(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rate provider returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var exchangeRate ExchangeRate
+	if err := json.NewDecoder(resp.Body).Decode(&exchangeRate); err != nil {
+		return nil, fmt.Errorf("could not decode rates: %w", err)
+	}
+	return &exchangeRate, nil
+}
+
+// setRequestID forwards the X-Request-ID of the incoming request, if any, so
+// calls to the provider can be matched with the request that made them.
+func setRequestID(req *http.Request) {
+	if id := auth.RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set(auth.RequestIDHeader, id)
+	}
+}
@@ -0,0 +1,300 @@
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"banking-backend/auth"
+
+	"github.com/lib/pq"
+)
+
+// --- Models ---
+
+type HistoricalRate struct {
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+}
+
+type RateHistory struct {
+	From  string           `json:"from"`
+	To    string           `json:"to"`
+	Rates []HistoricalRate `json:"rates"`
+}
+
+// maxHistoryDays bounds the range served by the history endpoint.
+const maxHistoryDays = 366
+
+// maxTableAgeDays bounds how far back GetTable looks for the table of a date
+// without rates, like a weekend or a bank holiday.
+const maxTableAgeDays = 4
+
+// isBusinessDay reports whether rates are published on date. Bank holidays
+// are not known here; the provider answers them with the previous table.
+func isBusinessDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// --- Database ---
+
+// TableStore reads the recorded rate tables.
+type TableStore interface {
+	GetTable(ctx context.Context, base string, date time.Time) (*ExchangeRate, error)
+	GetHistory(ctx context.Context, base, from, to string, start, end time.Time) ([]HistoricalRate, error)
+}
+
+// RateStore persists every fetched rate table in fx_rates.
+type RateStore struct {
+	DB *sql.DB
+}
+
+func (s *RateStore) SaveTable(ctx context.Context, table *ExchangeRate) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx) // Rollback in case of an error
+
+	query := `INSERT INTO fx_rates (base_currency, quote_currency, rate, rate_date)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (base_currency, quote_currency, rate_date)
+			  DO UPDATE SET rate = EXCLUDED.rate, fetched_at = NOW()`
+	for code, rate := range table.Rates {
+		if _, err := tx.ExecContext(ctx, query, table.Base, code, rate, table.Date); err != nil {
+			return fmt.Errorf("could not save rate: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetTable returns the latest stored table for base published on or before
+// date, so weekends and bank holidays get the rates of the previous business
+// day. It returns nil if none was recorded in the maxTableAgeDays before date.
+func (s *RateStore) GetTable(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT rate_date, quote_currency, rate FROM fx_rates
+		WHERE base_currency = $1 AND rate_date = (
+			SELECT MAX(rate_date) FROM fx_rates WHERE base_currency = $1 AND rate_date BETWEEN $2 AND $3
+		)`,
+		base, date.AddDate(0, 0, -maxTableAgeDays).Format(time.DateOnly), date.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("could not get rates: %w", err)
+	}
+	defer rows.Close()
+
+	table := &ExchangeRate{Amount: 1, Base: base, Rates: make(map[string]float64)}
+	for rows.Next() {
+		var rateDate time.Time
+		var code string
+		var rate float64
+		if err := rows.Scan(&rateDate, &code, &rate); err != nil {
+			return nil, fmt.Errorf("could not scan rate: %w", err)
+		}
+		table.Date = rateDate.Format(time.DateOnly)
+		table.Rates[code] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rates: %w", err)
+	}
+
+	if len(table.Rates) == 0 {
+		return nil, nil
+	}
+	return table, nil
+}
+
+// GetHistory returns the stored rates of the from/to pair between two dates,
+// derived from the tables recorded against base.
+func (s *RateStore) GetHistory(ctx context.Context, base, from, to string, start, end time.Time) ([]HistoricalRate, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT rate_date, quote_currency, rate FROM fx_rates
+		WHERE base_currency = $1 AND quote_currency = ANY($2) AND rate_date BETWEEN $3 AND $4
+		ORDER BY rate_date`,
+		base, pq.Array([]string{from, to}), start.Format(time.DateOnly), end.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("could not get rate history: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []string
+	tables := make(map[string]*ExchangeRate)
+	for rows.Next() {
+		var date time.Time
+		var code string
+		var rate float64
+		if err := rows.Scan(&date, &code, &rate); err != nil {
+			return nil, fmt.Errorf("could not scan rate: %w", err)
+		}
+		key := date.Format(time.DateOnly)
+		if _, ok := tables[key]; !ok {
+			tables[key] = &ExchangeRate{Base: base, Date: key, Rates: make(map[string]float64)}
+			dates = append(dates, key)
+		}
+		tables[key].Rates[code] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rates: %w", err)
+	}
+
+	history := []HistoricalRate{}
+	for _, date := range dates {
+		rate, err := rateFromTable(tables[date], from, to)
+		if err != nil {
+			continue // One side of the pair was not recorded that day
+		}
+		history = append(history, HistoricalRate{Date: date, Rate: rate.Rate})
+	}
+	return history, nil
+}
+
+// --- Recording ---
+
+// RecordingSource stores every table fetched from Source. Storage failures
+// are logged and never fail the fetch.
+type RecordingSource struct {
+	Source RateTableSource
+	Store  *RateStore
+}
+
+func (s *RecordingSource) LatestRates(ctx context.Context, base string) (*ExchangeRate, error) {
+	table, err := s.Source.LatestRates(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, table)
+	return table, nil
+}
+
+func (s *RecordingSource) HistoricalRates(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	table, err := s.Source.HistoricalRates(ctx, base, date)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, table)
+	return table, nil
+}
+
+func (s *RecordingSource) record(ctx context.Context, table *ExchangeRate) {
+	if err := s.Store.SaveTable(ctx, table); err != nil {
+		auth.LoggerFromContext(ctx).Error("could not record rates", "base", table.Base, "date", table.Date, "error", err)
+	}
+}
+
+// --- Handlers ---
+
+// GetRatesHandler serves GET /rates?date=YYYY-MM-DD&base=XXX, today by
+// default. A business day is served from the table recorded for that exact
+// date, and a weekend from the latest table recorded before it; otherwise the
+// table is fetched from the provider and recorded.
+func (env *Env) GetRatesHandler(w http.ResponseWriter, r *http.Request) {
+	date := time.Now().UTC()
+	if v := r.URL.Query().Get("date"); v != "" {
+		var err error
+		date, err = time.Parse(time.DateOnly, v)
+		if err != nil {
+			auth.RespondWithError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		if date.After(time.Now()) {
+			auth.RespondWithError(w, http.StatusBadRequest, "Date must not be in the future")
+			return
+		}
+	}
+
+	base := env.Sources.Base
+	if v := r.URL.Query().Get("base"); v != "" {
+		c, err := LookupSupported(v)
+		if err != nil {
+			auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		base = c.Code
+	}
+
+	var table *ExchangeRate
+	var err error
+	if env.Store != nil {
+		if table, err = env.Store.GetTable(r.Context(), env.Sources.Base, date); err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get rates")
+			return
+		}
+		// An older table only applies when nothing is published on the date
+		if table != nil && isBusinessDay(date) && table.Date != date.Format(time.DateOnly) {
+			table = nil
+		}
+	}
+	if table == nil {
+		if table, err = env.Sources.Tables.HistoricalRates(r.Context(), env.Sources.Base, date); err != nil {
+			auth.RespondWithError(w, http.StatusBadGateway, "Failed to get exchange rates")
+			return
+		}
+	}
+
+	if table, err = rebaseTable(table, base); err != nil {
+		auth.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, table)
+}
+
+// GetRateHistoryHandler serves GET /rates/history?from=&to=&pair=USD/GBP from
+// the recorded rates.
+func (env *Env) GetRateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	codes := strings.Split(query.Get("pair"), "/")
+	if len(codes) != 2 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid pair, expected FROM/TO")
+		return
+	}
+	from, err := LookupSupported(codes[0])
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := LookupSupported(codes[1])
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start, err := time.Parse(time.DateOnly, query.Get("from"))
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+		return
+	}
+	end, err := time.Parse(time.DateOnly, query.Get("to"))
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+		return
+	}
+	if end.Before(start) {
+		auth.RespondWithError(w, http.StatusBadRequest, "The from date must not be after the to date")
+		return
+	}
+	if end.Sub(start) > maxHistoryDays*24*time.Hour {
+		auth.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Date range must not exceed %d days", maxHistoryDays))
+		return
+	}
+
+	rates := []HistoricalRate{}
+	if env.Store != nil {
+		if rates, err = env.Store.GetHistory(r.Context(), env.Sources.Base, from.Code, to.Code, start, end); err != nil {
+			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get rate history")
+			return
+		}
+	}
+
+	auth.JSON(w, http.StatusOK, RateHistory{From: from.Code, To: to.Code, Rates: rates})
+}
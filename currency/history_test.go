@@ -0,0 +1,82 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// recordedTables serves the latest table on or before a date, like RateStore.
+type recordedTables map[string]*ExchangeRate
+
+func (s recordedTables) GetTable(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	for day := date; !day.Before(date.AddDate(0, 0, -maxTableAgeDays)); day = day.AddDate(0, 0, -1) {
+		if table, ok := s[day.Format(time.DateOnly)]; ok {
+			return table.clone(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (s recordedTables) GetHistory(ctx context.Context, base, from, to string, start, end time.Time) ([]HistoricalRate, error) {
+	return nil, nil
+}
+
+// publishedTables is a provider publishing a table on every date asked for.
+type publishedTables struct {
+	fetched []string
+}
+
+func (p *publishedTables) LatestRates(ctx context.Context, base string) (*ExchangeRate, error) {
+	return p.HistoricalRates(ctx, base, time.Now().UTC())
+}
+
+func (p *publishedTables) HistoricalRates(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	day := date.Format(time.DateOnly)
+	p.fetched = append(p.fetched, day)
+	return &ExchangeRate{Amount: 1, Base: base, Date: day, Rates: map[string]float64{"USD": 1.2}}, nil
+}
+
+func TestGetRatesHandler(t *testing.T) {
+	thursday := &ExchangeRate{Amount: 1, Base: "EUR", Date: "2025-01-02", Rates: map[string]float64{"USD": 1.1}}
+	friday := &ExchangeRate{Amount: 1, Base: "EUR", Date: "2025-01-03", Rates: map[string]float64{"USD": 1.1}}
+
+	tests := []struct {
+		name      string
+		recorded  recordedTables
+		date      string
+		wantDate  string
+		wantFetch bool
+	}{
+		{"recorded weekday", recordedTables{"2025-01-03": friday}, "2025-01-03", "2025-01-03", false},
+		{"missing weekday table", recordedTables{"2025-01-02": thursday}, "2025-01-03", "2025-01-03", true},
+		{"Saturday gets Friday", recordedTables{"2025-01-03": friday}, "2025-01-04", "2025-01-03", false},
+		{"Sunday gets Friday", recordedTables{"2025-01-03": friday}, "2025-01-05", "2025-01-03", false},
+		{"nothing recorded", recordedTables{}, "2025-01-04", "2025-01-04", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &publishedTables{}
+			env := &Env{Sources: &Sources{Base: "EUR", Tables: provider}, Store: tt.recorded}
+
+			w := httptest.NewRecorder()
+			env.GetRatesHandler(w, httptest.NewRequest("GET", "/rates?date="+tt.date, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /rates = %d %s", w.Code, w.Body)
+			}
+			var table ExchangeRate
+			if err := json.NewDecoder(w.Body).Decode(&table); err != nil {
+				t.Fatal(err)
+			}
+			if table.Date != tt.wantDate {
+				t.Errorf("rates of %s are the table of %s, want %s", tt.date, table.Date, tt.wantDate)
+			}
+			if fetched := len(provider.fetched) > 0; fetched != tt.wantFetch {
+				t.Errorf("fetched from the provider: %v, want %v", provider.fetched, tt.wantFetch)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- ISO 4217 ---
+
+var (
+	ErrUnknownCurrency     = errors.New("unknown ISO 4217 currency code")
+	ErrUnsupportedCurrency = errors.New("currency not supported by the exchange rate source")
+)
+
+type Currency struct {
+	Code       string `json:"code"`
+	Numeric    string `json:"numeric"`
+	MinorUnits int    `json:"minor_units"`
+	Name       string `json:"name"`
+}
+
+var registry = map[string]*Currency{
+	"AED": {"AED", "784", 2, "UAE Dirham"},
+	"ARS": {"ARS", "032", 2, "Argentine Peso"},
+	"AUD": {"AUD", "036", 2, "Australian Dollar"},
+	"BGN": {"BGN", "975", 2, "Bulgarian Lev"},
+	"BHD": {"BHD", "048", 3, "Bahraini Dinar"},
+	"BRL": {"BRL", "986", 2, "Brazilian Real"},
+	"CAD": {"CAD", "124", 2, "Canadian Dollar"},
+	"CHF": {"CHF", "756", 2, "Swiss Franc"},
+	"CLP": {"CLP", "152", 0, "Chilean Peso"},
+	"CNY": {"CNY", "156", 2, "Yuan Renminbi"},
+	"COP": {"COP", "170", 2, "Colombian Peso"},
+	"CZK": {"CZK", "203", 2, "Czech Koruna"},
+	"DKK": {"DKK", "208", 2, "Danish Krone"},
+	"EGP": {"EGP", "818", 2, "Egyptian Pound"},
+	"EUR": {"EUR", "978", 2, "Euro"},
+	"GBP": {"GBP", "826", 2, "Pound Sterling"},
+	"HKD": {"HKD", "344", 2, "Hong Kong Dollar"},
+	"HUF": {"HUF", "348", 2, "Forint"},
+	"IDR": {"IDR", "360", 2, "Rupiah"},
+	"ILS": {"ILS", "376", 2, "New Israeli Sheqel"},
+	"INR": {"INR", "356", 2, "Indian Rupee"},
+	"ISK": {"ISK", "352", 0, "Iceland Krona"},
+	"JOD": {"JOD", "400", 3, "Jordanian Dinar"},
+	"JPY": {"JPY", "392", 0, "Yen"},
+	"KRW": {"KRW", "410", 0, "Won"},
+	"KWD": {"KWD", "414", 3, "Kuwaiti Dinar"},
+	"MAD": {"MAD", "504", 2, "Moroccan Dirham"},
+	"MXN": {"MXN", "484", 2, "Mexican Peso"},
+	"MYR": {"MYR", "458", 2, "Malaysian Ringgit"},
+	"NGN": {"NGN", "566", 2, "Naira"},
+	"NOK": {"NOK", "578", 2, "Norwegian Krone"},
+	"NZD": {"NZD", "554", 2, "New Zealand Dollar"},
+	"OMR": {"OMR", "512", 3, "Rial Omani"},
+	"PEN": {"PEN", "604", 2, "Sol"},
+	"PHP": {"PHP", "608", 2, "Philippine Peso"},
+	"PLN": {"PLN", "985", 2, "Zloty"},
+	"RON": {"RON", "946", 2, "Romanian Leu"},
+	"RUB": {"RUB", "643", 2, "Russian Ruble"},
+	"SAR": {"SAR", "682", 2, "Saudi Riyal"},
+	"SEK": {"SEK", "752", 2, "Swedish Krona"},
+	"SGD": {"SGD", "702", 2, "Singapore Dollar"},
+	"THB": {"THB", "764", 2, "Baht"},
+	"TND": {"TND", "788", 3, "Tunisian Dinar"},
+	"TRY": {"TRY", "949", 2, "Turkish Lira"},
+	"TWD": {"TWD", "901", 2, "New Taiwan Dollar"},
+	"UAH": {"UAH", "980", 2, "Hryvnia"},
+	"USD": {"USD", "840", 2, "US Dollar"},
+	"VND": {"VND", "704", 0, "Dong"},
+	"ZAR": {"ZAR", "710", 2, "Rand"},
+}
+
+// frankfurterCurrencies lists the currencies published by the Frankfurter
+// API. They are supported until the rate source reports its own.
+var frankfurterCurrencies = []string{
+	"AUD", "BGN", "BRL", "CAD", "CHF", "CNY", "CZK", "DKK", "EUR", "GBP", "HKD",
+	"HUF", "IDR", "ILS", "INR", "ISK", "JPY", "KRW", "MXN", "MYR", "NOK", "NZD",
+	"PHP", "PLN", "RON", "SEK", "SGD", "THB", "TRY", "USD", "ZAR",
+}
+
+var (
+	supportedMutex sync.RWMutex
+	supported      = currencySet(frankfurterCurrencies)
+)
+
+func currencySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if c, err := Lookup(code); err == nil {
+			set[c.Code] = true
+		}
+	}
+	return set
+}
+
+// SetSupported restricts LookupSupported to codes, the currencies quoted by
+// the exchange rate source. Codes missing from the ISO 4217 registry are
+// ignored.
+func SetSupported(codes []string) {
+	set := currencySet(codes)
+	supportedMutex.Lock()
+	defer supportedMutex.Unlock()
+	supported = set
+}
+
+// Lookup returns the ISO 4217 entry for code, which is matched case-insensitively.
+func Lookup(code string) (*Currency, error) {
+	c, ok := registry[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c, nil
+}
+
+// LookupSupported is like Lookup but also requires the exchange rate source
+// to quote the currency.
+func LookupSupported(code string) (*Currency, error) {
+	c, err := Lookup(code)
+	if err != nil {
+		return nil, err
+	}
+	supportedMutex.RLock()
+	ok := supported[c.Code]
+	supportedMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, c.Code)
+	}
+	return c, nil
+}
+
+// Round rounds amount to the currency's minor units.
+func (c *Currency) Round(amount float64) float64 {
+	factor := math.Pow10(c.MinorUnits)
+	return math.Round(amount*factor) / factor
+}
+
+// Format renders amount with the currency's minor units, e.g. "1234.50 EUR".
+func (c *Currency) Format(amount float64) string {
+	return strconv.FormatFloat(c.Round(amount), 'f', c.MinorUnits, 64) + " " + c.Code
+}
+
+// Round rounds amount to the minor units of code, or to cents if the code is unknown.
+func Round(amount float64, code string) float64 {
+	c, err := Lookup(code)
+	if err != nil {
+		return math.Round(amount*100) / 100
+	}
+	return c.Round(amount)
+}
+
+// Format renders amount in code like Currency.Format, or as a bare amount in
+// cents if the code is unknown.
+func Format(amount float64, code string) string {
+	c, err := Lookup(code)
+	if err != nil {
+		return strconv.FormatFloat(Round(amount, code), 'f', 2, 64)
+	}
+	return c.Format(amount)
+}
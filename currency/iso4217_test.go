@@ -0,0 +1,84 @@
+package currency
+
+import (
+	"banking-backend/config"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount float64
+		code   string
+		want   string
+	}{
+		{1234.5, "EUR", "1234.50 EUR"},
+		{0.005, "EUR", "0.01 EUR"},
+		{1099.6, "JPY", "1100 JPY"},
+		{1.2345, "BHD", "1.235 BHD"},
+		{-20, "USD", "-20.00 USD"},
+		{12.345, "", "12.35"},
+		{12.345, "XXX", "12.35"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.code); got != tt.want {
+			t.Errorf("Format(%v, %q) = %q, want %q", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+// TestNewSourcesSupportsTheSourceCurrencies checks that the currencies the
+// source lists become the supported ones, and that the Frankfurter list is
+// kept when the source cannot list them.
+func TestNewSourcesSupportsTheSourceCurrencies(t *testing.T) {
+	t.Cleanup(func() { SetSupported(frankfurterCurrencies) })
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"EUR": "Euro", "USD": "US Dollar", "XBT": "Bitcoin"}`))
+	}))
+	defer listing.Close()
+
+	tests := []struct {
+		name        string
+		cfg         config.FX
+		supported   []string
+		unsupported []string
+	}{
+		{"static table", config.FX{StaticRatesFile: "testdata/rates.json", BaseCurrency: "EUR"},
+			[]string{"EUR", "CHF", "GBP", "JPY", "USD"}, []string{"SEK", "ZAR"}},
+		{"Frankfurter listing", config.FX{BaseURL: listing.URL, BaseCurrency: "EUR"},
+			[]string{"EUR", "USD"}, []string{"GBP", "JPY"}},
+		{"Frankfurter down", config.FX{BaseURL: down.URL, BaseCurrency: "EUR"},
+			frankfurterCurrencies, []string{"AED", "CLP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSupported(frankfurterCurrencies)
+			if _, err := NewSources(nil, tt.cfg); err != nil {
+				t.Fatalf("NewSources: %v", err)
+			}
+			for _, code := range tt.supported {
+				if _, err := LookupSupported(code); err != nil {
+					t.Errorf("LookupSupported(%s) = %v, want supported", code, err)
+				}
+			}
+			for _, code := range tt.unsupported {
+				if _, err := LookupSupported(code); !errors.Is(err, ErrUnsupportedCurrency) {
+					t.Errorf("LookupSupported(%s) = %v, want ErrUnsupportedCurrency", code, err)
+				}
+			}
+		})
+	}
+
+	// The base currency must be quoted by the source
+	SetSupported(frankfurterCurrencies)
+	if _, err := NewSources(nil, config.FX{StaticRatesFile: "testdata/rates.json", BaseCurrency: "SEK"}); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("NewSources with an unquoted base = %v, want ErrUnsupportedCurrency", err)
+	}
+}
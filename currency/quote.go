@@ -0,0 +1,200 @@
+package currency
+
+import (
+	"banking-backend/config"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"banking-backend/auth"
+	"banking-backend/store"
+)
+
+// --- Models ---
+
+// Quote locks a customer rate for a currency pair until ExpiresAt. The
+// customer rate is the mid-market rate minus the bank spread.
+type Quote struct {
+	ID              string     `json:"quote_id"`
+	UserID          string     `json:"-"`
+	From            string     `json:"from"`
+	To              string     `json:"to"`
+	Amount          float64    `json:"amount,omitempty"`
+	ConvertedAmount float64    `json:"converted_amount,omitempty"`
+	MidRate         float64    `json:"mid_rate"`
+	Spread          float64    `json:"spread"`
+	Rate            float64    `json:"rate"`
+	RateDate        string     `json:"rate_date"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type QuoteRequest struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+var (
+	ErrQuoteNotFound = errors.New("quote not found")
+	ErrQuoteExpired  = errors.New("quote has expired")
+	ErrQuoteUsed     = errors.New("quote has already been used")
+	ErrQuoteMismatch = errors.New("quote does not match the operation")
+)
+
+// quoteIDPattern matches the UUIDs Postgres assigns to quotes.
+var quoteIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// --- Database ---
+
+func createQuote(ctx context.Context, db *sql.DB, quote *Quote) error {
+	query := `INSERT INTO fx_quotes (user_id, from_currency, to_currency, amount, mid_rate, spread, rate, rate_date, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`
+	err := db.QueryRowContext(ctx, query, quote.UserID, quote.From, quote.To, quote.Amount, quote.MidRate,
+		quote.Spread, quote.Rate, quote.RateDate, quote.ExpiresAt).Scan(&quote.ID, &quote.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not create quote: %w", err)
+	}
+	return nil
+}
+
+// QuoteStore redeems quotes for the ledger, inside the unit of work carried
+// by the context when there is one.
+type QuoteStore struct {
+	DB *sql.DB
+}
+
+// UseQuote locks a quote, checks that it belongs to userID, is still valid
+// and matches the operation, and marks it as used. amount is the amount in
+// the from currency being converted.
+func (s *QuoteStore) UseQuote(ctx context.Context, quoteID, userID, from, to string, amount float64) (*Quote, error) {
+	// Malformed IDs cannot name a quote
+	if !quoteIDPattern.MatchString(quoteID) {
+		return nil, ErrQuoteNotFound
+	}
+
+	tx := store.Conn(ctx, s.DB)
+	quote := &Quote{}
+	query := `SELECT id, user_id, from_currency, to_currency, amount, mid_rate, spread, rate, rate_date, expires_at, used_at, created_at
+			  FROM fx_quotes WHERE id = $1 FOR UPDATE`
+	err := tx.QueryRowContext(ctx, query, quoteID).Scan(&quote.ID, &quote.UserID, &quote.From, &quote.To, &quote.Amount,
+		&quote.MidRate, &quote.Spread, &quote.Rate, &quote.RateDate, &quote.ExpiresAt, &quote.UsedAt, &quote.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrQuoteNotFound
+		}
+		return nil, fmt.Errorf("could not get quote: %w", err)
+	}
+
+	if quote.UserID != userID {
+		return nil, ErrQuoteNotFound
+	}
+	if quote.UsedAt != nil {
+		return nil, ErrQuoteUsed
+	}
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+	if quote.From != from || quote.To != to || (quote.Amount > 0 && quote.Amount != amount) {
+		return nil, ErrQuoteMismatch
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE fx_quotes SET used_at = NOW() WHERE id = $1`, quote.ID); err != nil {
+		return nil, fmt.Errorf("could not mark quote as used: %w", err)
+	}
+	return quote, nil
+}
+
+// --- Handlers ---
+
+type Env struct {
+	DB       *sql.DB
+	Rates    RateProvider
+	Sources  *Sources
+	Store    TableStore    // Recorded rates, nil without a database
+	Spread   float64       // Fraction taken from the mid-market rate, e.g. 0.005
+	QuoteTTL time.Duration // How long a quote can be executed
+}
+
+// NewEnv takes the bank spread and the quote lifetime from cfg.
+// Rates are not recorded without db.
+func NewEnv(db *sql.DB, sources *Sources, cfg config.FX) *Env {
+	env := &Env{
+		DB:       db,
+		Rates:    sources.Rates,
+		Sources:  sources,
+		Spread:   cfg.Spread,
+		QuoteTTL: cfg.QuoteTTL,
+	}
+	if db != nil {
+		env.Store = &RateStore{DB: db}
+	}
+	return env
+}
+
+func (env *Env) CreateQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req QuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	from, err := LookupSupported(req.From)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := LookupSupported(req.To)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if from.Code == to.Code {
+		auth.RespondWithError(w, http.StatusBadRequest, "Currencies must differ")
+		return
+	}
+	if req.Amount < 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Amount must not be negative")
+		return
+	}
+
+	mid, err := env.Rates.GetRate(r.Context(), from.Code, to.Code)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadGateway, "Failed to get exchange rate")
+		return
+	}
+
+	quote := &Quote{
+		UserID:    userID,
+		From:      from.Code,
+		To:        to.Code,
+		Amount:    from.Round(req.Amount),
+		MidRate:   mid.Rate,
+		Spread:    env.Spread,
+		Rate:      mid.Rate * (1 - env.Spread),
+		RateDate:  mid.Date,
+		ExpiresAt: time.Now().Add(env.QuoteTTL),
+	}
+	if quote.Amount > 0 {
+		quote.ConvertedAmount = to.Round(quote.Amount * quote.Rate)
+	}
+
+	if err := createQuote(r.Context(), env.DB, quote); err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to create quote")
+		return
+	}
+
+	auth.JSON(w, http.StatusCreated, quote)
+}
@@ -0,0 +1,59 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// --- Static Rates ---
+
+// StaticProvider serves a fixed rate table, typically loaded from a JSON file
+// in the Frankfurter response format. It is meant for tests and offline use.
+type StaticProvider struct {
+	Table *ExchangeRate
+}
+
+func NewStaticProviderFromFile(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read static rates: %w", err)
+	}
+
+	var table ExchangeRate
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("could not decode static rates: %w", err)
+	}
+	if table.Base == "" {
+		return nil, fmt.Errorf("static rates file %s has no base currency", path)
+	}
+	return &StaticProvider{Table: &table}, nil
+}
+
+// LatestRates rebases a copy of the static table on base.
+func (p *StaticProvider) LatestRates(ctx context.Context, base string) (*ExchangeRate, error) {
+	return rebaseTable(p.Table.clone(), base)
+}
+
+// HistoricalRates serves the same static table for every date.
+func (p *StaticProvider) HistoricalRates(ctx context.Context, base string, date time.Time) (*ExchangeRate, error) {
+	return rebaseTable(p.Table.clone(), base)
+}
+
+// Currencies returns the base of the table and every currency it quotes.
+func (p *StaticProvider) Currencies(ctx context.Context) ([]string, error) {
+	codes := append([]string{p.Table.Base}, slices.Collect(maps.Keys(p.Table.Rates))...)
+	slices.Sort(codes)
+	return codes, nil
+}
+
+func (p *StaticProvider) GetRate(ctx context.Context, from, to string) (*Rate, error) {
+	if rate, ok := identityRate(from, to); ok {
+		return rate, nil
+	}
+	return rateFromTable(p.Table, from, to)
+}
@@ -0,0 +1,100 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadStaticProvider(t *testing.T) *StaticProvider {
+	t.Helper()
+	provider, err := NewStaticProviderFromFile("testdata/rates.json")
+	if err != nil {
+		t.Fatalf("NewStaticProviderFromFile: %v", err)
+	}
+	return provider
+}
+
+func TestStaticProviderGetRate(t *testing.T) {
+	provider := loadStaticProvider(t)
+
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"EUR", "USD", 1.0321},
+		{"USD", "EUR", 1 / 1.0321},
+		{"USD", "GBP", 0.8297 / 1.0321},
+		{"JPY", "CHF", 0.9412 / 163.25},
+		{"GBP", "GBP", 1},
+	}
+	for _, tt := range tests {
+		rate, err := provider.GetRate(context.Background(), tt.from, tt.to)
+		if err != nil {
+			t.Errorf("GetRate(%s, %s): %v", tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(rate.Rate-tt.want) > 1e-12 || rate.From != tt.from || rate.To != tt.to {
+			t.Errorf("GetRate(%s, %s) = %+v, want %v", tt.from, tt.to, rate, tt.want)
+		}
+	}
+
+	if _, err := provider.GetRate(context.Background(), "EUR", "SEK"); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("GetRate of a missing currency = %v, want ErrRateNotFound", err)
+	}
+}
+
+func TestStaticProviderTables(t *testing.T) {
+	provider := loadStaticProvider(t)
+	ctx := context.Background()
+
+	latest, err := provider.LatestRates(ctx, "USD")
+	if err != nil {
+		t.Fatalf("LatestRates: %v", err)
+	}
+	if latest.Base != "USD" || latest.Date != "2025-01-02" || math.Abs(latest.Rates["EUR"]-1/1.0321) > 1e-12 {
+		t.Errorf("LatestRates(USD) = %+v, want the table rebased on USD", latest)
+	}
+	if _, ok := latest.Rates["USD"]; ok {
+		t.Error("the rebased table quotes its own base")
+	}
+
+	historical, err := provider.HistoricalRates(ctx, "EUR", time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("HistoricalRates: %v", err)
+	}
+	if historical.Base != "EUR" || historical.Rates["USD"] != 1.0321 {
+		t.Errorf("HistoricalRates(EUR) = %+v, want the static table", historical)
+	}
+
+	// Tables handed out are copies
+	historical.Rates["USD"] = 2
+	if rate, _ := provider.GetRate(ctx, "EUR", "USD"); rate.Rate != 1.0321 {
+		t.Errorf("GetRate = %v after a caller changed its table, want 1.0321", rate.Rate)
+	}
+}
+
+func TestNewStaticProviderFromFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for name, path := range map[string]string{
+		"missing file": filepath.Join(dir, "missing.json"),
+		"invalid JSON": write("invalid.json", `{"base": `),
+		"missing base": write("nobase.json", `{"rates": {"USD": 1.1}}`),
+	} {
+		if _, err := NewStaticProviderFromFile(path); err == nil {
+			t.Errorf("%s: NewStaticProviderFromFile succeeded", name)
+		}
+	}
+}
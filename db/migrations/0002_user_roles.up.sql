@@ -0,0 +1,2 @@
+-- Staff roles for the back office
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer' CHECK (role IN ('customer', 'support', 'admin'));
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_transactions_account_timestamp;
+DROP INDEX IF EXISTS idx_transactions_fee_for;
+DROP INDEX IF EXISTS idx_transactions_reversal_of;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS fee_for,
+    DROP COLUMN IF EXISTS linked_transaction_id,
+    DROP COLUMN IF EXISTS reversal_of,
+    DROP COLUMN IF EXISTS fx_quote_id,
+    DROP COLUMN IF EXISTS fx_spread,
+    DROP COLUMN IF EXISTS fx_rate,
+    DROP COLUMN IF EXISTS original_currency,
+    DROP COLUMN IF EXISTS original_amount,
+    DROP COLUMN IF EXISTS counterparty_account,
+    DROP COLUMN IF EXISTS reference,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS balance_after,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,19 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'posted', -- 'pending', 'posted', 'failed', 'reversed'
+    ADD COLUMN IF NOT EXISTS balance_after DECIMAL(15, 2), -- Balance of the account (or pocket) once posted
+    ADD COLUMN IF NOT EXISTS description VARCHAR(140),
+    ADD COLUMN IF NOT EXISTS reference VARCHAR(35), -- External reference supplied by the user
+    ADD COLUMN IF NOT EXISTS counterparty_account VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS original_amount DECIMAL(15, 2), -- Amount before currency conversion
+    ADD COLUMN IF NOT EXISTS original_currency VARCHAR(3),
+    ADD COLUMN IF NOT EXISTS fx_rate DECIMAL(18, 8),
+    ADD COLUMN IF NOT EXISTS fx_spread DECIMAL(9, 6),
+    ADD COLUMN IF NOT EXISTS fx_quote_id UUID,
+    ADD COLUMN IF NOT EXISTS reversal_of INTEGER REFERENCES transactions(id), -- Transaction compensated by this one
+    ADD COLUMN IF NOT EXISTS linked_transaction_id INTEGER REFERENCES transactions(id), -- Other leg of a transfer or exchange
+    ADD COLUMN IF NOT EXISTS fee_for INTEGER REFERENCES transactions(id); -- Transaction a fee was charged for
+
+-- A transaction can only be reversed once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_reversal_of ON transactions(reversal_of);
+CREATE INDEX IF NOT EXISTS idx_transactions_fee_for ON transactions(fee_for) WHERE fee_for IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_account_timestamp ON transactions(account_id, timestamp);
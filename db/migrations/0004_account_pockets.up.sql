@@ -0,0 +1,10 @@
+-- Per-currency pockets of multi-currency accounts (the base currency stays in accounts.balance)
+CREATE TABLE IF NOT EXISTS account_balances (
+    account_id UUID NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    balance DECIMAL(15, 2) NOT NULL DEFAULT 0.00,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, currency),
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
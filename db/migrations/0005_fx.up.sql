@@ -0,0 +1,27 @@
+-- FX quotes lock a rate (mid-market minus the bank spread) until they expire
+CREATE TABLE IF NOT EXISTS fx_quotes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    from_currency VARCHAR(3) NOT NULL,
+    to_currency VARCHAR(3) NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL DEFAULT 0, -- 0 when the quote is not tied to an amount
+    mid_rate DECIMAL(18, 8) NOT NULL,
+    spread DECIMAL(9, 6) NOT NULL,
+    rate DECIMAL(18, 8) NOT NULL,
+    rate_date VARCHAR(10) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Every exchange rate table fetched by the currency package
+CREATE TABLE IF NOT EXISTS fx_rates (
+    id SERIAL PRIMARY KEY,
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate DECIMAL(18, 8) NOT NULL,
+    rate_date DATE NOT NULL, -- Publication date reported by the provider
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (base_currency, quote_currency, rate_date)
+);
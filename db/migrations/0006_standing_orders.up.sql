@@ -0,0 +1,34 @@
+-- Standing orders: recurring transfers executed by the payments scheduler
+CREATE TABLE IF NOT EXISTS standing_orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    from_account_number VARCHAR(50) NOT NULL,
+    to_account_number VARCHAR(50) NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL,
+    frequency VARCHAR(10) NOT NULL, -- 'weekly' or 'monthly'
+    day SMALLINT NOT NULL, -- Weekday (0 = Sunday) or day of the month
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- 'active', 'paused', 'cancelled'
+    scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL, -- Current occurrence
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Next attempt, including retries
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_standing_orders_user_id ON standing_orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders(next_run_at) WHERE status = 'active';
+
+-- User notifications
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
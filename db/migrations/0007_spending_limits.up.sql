@@ -0,0 +1,16 @@
+-- Lower limits chosen by users; a NULL account_id applies to all their accounts
+CREATE TABLE IF NOT EXISTS spending_limits (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    account_id UUID,
+    per_transaction DECIMAL(15, 2),
+    daily DECIMAL(15, 2),
+    monthly DECIMAL(15, 2),
+    hourly_count INTEGER,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_limits_user ON spending_limits(user_id) WHERE account_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_limits_account ON spending_limits(account_id) WHERE account_id IS NOT NULL;
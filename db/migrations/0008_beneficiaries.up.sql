@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS beneficiaries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    nickname VARCHAR(50),
+    verified_at TIMESTAMP WITH TIME ZONE,
+    active_from TIMESTAMP WITH TIME ZONE, -- NULL until the payee is verified
+    verification_code_hash VARCHAR(255),
+    verification_attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, account_number),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
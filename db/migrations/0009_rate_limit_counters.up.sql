@@ -0,0 +1,7 @@
+-- Shared counters of the rate limiter when RATE_LIMIT_STORE=postgres
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key VARCHAR(255) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count INTEGER NOT NULL,
+    PRIMARY KEY (key, window_start)
+);
@@ -0,0 +1,24 @@
+-- Daily interest accruals, posted monthly as 'interest' transactions
+CREATE TABLE IF NOT EXISTS interest_accruals (
+    id SERIAL PRIMARY KEY,
+    account_id UUID NOT NULL,
+    accrual_date DATE NOT NULL,
+    balance DECIMAL(15, 2) NOT NULL, -- End-of-day balance
+    annual_rate DECIMAL(9, 6) NOT NULL,
+    day_count VARCHAR(10) NOT NULL, -- e.g., 'ACT/365', '30/360'
+    amount DECIMAL(20, 10) NOT NULL,
+    posted_at TIMESTAMP WITH TIME ZONE,
+    transaction_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (account_id, accrual_date),
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_interest_accruals_pending ON interest_accruals(accrual_date) WHERE posted_at IS NULL;
+
+-- Days already processed by the accrual job
+CREATE TABLE IF NOT EXISTS interest_runs (
+    accrual_date DATE PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
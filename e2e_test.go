@@ -0,0 +1,607 @@
+package main
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/clock"
+	"banking-backend/config"
+	"banking-backend/currency"
+	"banking-backend/db/migrations"
+	"banking-backend/limits"
+	"banking-backend/transactions"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// The end-to-end tests drive the full API over HTTP. Everything lives in the
+// in-memory store, or in the Postgres database at TEST_DATABASE_URL when it
+// is set; that database is migrated and emptied before every test. Exchange
+// rates come from a stub Frankfurter server.
+
+// --- Harness ---
+
+// fxRates is the table published by the stub provider, against EUR.
+var fxRates = map[string]float64{"USD": 1.10, "GBP": 0.85}
+
+// fxStub serves the Frankfurter endpoints used by the application and fails
+// every request while down is set.
+type fxStub struct {
+	*httptest.Server
+	down          atomic.Bool
+	requests      atomic.Int64
+	lastRequestID atomic.Value // X-Request-ID of the latest request
+}
+
+func newFXStub(t *testing.T) *fxStub {
+	stub := &fxStub{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/currencies", func(w http.ResponseWriter, r *http.Request) {
+		auth.JSON(w, http.StatusOK, map[string]string{"EUR": "Euro", "USD": "United States Dollar", "GBP": "British Pound"})
+	})
+	mux.HandleFunc("GET /v1/latest", func(w http.ResponseWriter, r *http.Request) {
+		if base := r.URL.Query().Get("from"); base != "EUR" {
+			http.Error(w, "unexpected base "+base, http.StatusBadRequest)
+			return
+		}
+		auth.JSON(w, http.StatusOK, currency.ExchangeRate{
+			Amount: 1,
+			Base:   "EUR",
+			Date:   time.Now().UTC().Format(time.DateOnly),
+			Rates:  fxRates,
+		})
+	})
+	mux.HandleFunc("GET /v1/{date}", func(w http.ResponseWriter, r *http.Request) {
+		date, err := time.Parse(time.DateOnly, r.PathValue("date"))
+		if err != nil {
+			http.Error(w, "invalid date", http.StatusNotFound)
+			return
+		}
+		// Like the ECB, nothing is published on weekends
+		for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			date = date.AddDate(0, 0, -1)
+		}
+		auth.JSON(w, http.StatusOK, currency.ExchangeRate{Amount: 1, Base: "EUR", Date: date.Format(time.DateOnly), Rates: fxRates})
+	})
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests.Add(1)
+		stub.lastRequestID.Store(r.Header.Get(auth.RequestIDHeader))
+		if stub.down.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+type harness struct {
+	*httptest.Server
+	FX *fxStub
+	DB *sql.DB // nil when running against the in-memory store
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	h := &harness{FX: newFXStub(t)}
+
+	cfg := config.Default()
+	cfg.FX.BaseURL = h.FX.URL
+	cfg.FX.CacheTTL = 0
+	generous := config.Rate{Limit: 1000, Window: time.Minute}
+	cfg.RateLimit.Global, cfg.RateLimit.Signup, cfg.RateLimit.Payments = generous, generous, generous
+	cfg.RateLimit.LoginIP, cfg.RateLimit.LoginDNI, cfg.RateLimit.Refresh = generous, generous, generous
+
+	// The application is wired by newApp, like in main
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		h.DB = openTestDB(t, url)
+	}
+	api, err := newApp(cfg, h.DB, clock.System{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Server = httptest.NewServer(api.routes())
+	t.Cleanup(h.Close)
+	return h
+}
+
+func openTestDB(t *testing.T, url string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+	// Every other table belongs to a user and is emptied with it
+	if _, err := db.Exec(`TRUNCATE users, fx_rates, rate_limit_counters, interest_runs RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatalf("could not empty the database: %v", err)
+	}
+	return db
+}
+
+// --- Client ---
+
+// do sends body as JSON with the bearer token, if any, checks the status and
+// decodes the response into out, if given.
+func (h *harness) do(t *testing.T, method, path, token string, body any, wantStatus int, out any) {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, h.URL+path, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := h.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		var errBody auth.ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errBody)
+		t.Fatalf("%s %s = %d %q, want %d", method, path, resp.StatusCode, errBody.Error, wantStatus)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: could not decode the response: %v", method, path, err)
+		}
+	}
+}
+
+// wantError checks the status and the error message of a failed request.
+func (h *harness) wantError(t *testing.T, method, path, token string, body any, wantStatus int, wantMessage string) {
+	t.Helper()
+	var errBody auth.ErrorResponse
+	h.do(t, method, path, token, body, wantStatus, &errBody)
+	if errBody.Error != wantMessage {
+		t.Errorf("%s %s failed with %q, want %q", method, path, errBody.Error, wantMessage)
+	}
+}
+
+var dniSequence atomic.Int64
+
+// newDNI returns a valid Spanish DNI no other call in this process returns.
+func newDNI() string {
+	n := 10000000 + dniSequence.Add(1)
+	return fmt.Sprintf("%08d%c", n, "TRWAGMYFPDXBNJZSQVHLCKE"[n%23])
+}
+
+type customer struct {
+	DNI   string
+	PIN   string
+	Token string
+}
+
+// signUp registers a new user and logs them in.
+func (h *harness) signUp(t *testing.T) *customer {
+	t.Helper()
+	c := &customer{DNI: newDNI()}
+	var signup struct {
+		UserID string `json:"user_id"`
+		PIN    string `json:"pin"`
+	}
+	h.do(t, "POST", "/signup", "", auth.SignupRequest{
+		FullName: "Ada Lovelace",
+		DNI:      c.DNI,
+		Email:    "ada." + c.DNI + "@example.com",
+	}, http.StatusCreated, &signup)
+	if signup.UserID == "" || signup.PIN == "" {
+		t.Fatalf("signup returned %+v", signup)
+	}
+	c.PIN = signup.PIN
+
+	var tokens auth.TokenResponse
+	h.do(t, "POST", "/login", "", auth.LoginRequest{DNI: c.DNI, Pin: c.PIN}, http.StatusOK, &tokens)
+	if tokens.AccessToken == "" {
+		t.Fatal("login returned no access token")
+	}
+	c.Token = tokens.AccessToken
+	return c
+}
+
+// openAccount creates an account and returns its number.
+func (h *harness) openAccount(t *testing.T, c *customer, accountType, cur string) string {
+	t.Helper()
+	var created struct {
+		AccountNumber string `json:"account_number"`
+	}
+	h.do(t, "POST", "/create-account", c.Token, map[string]string{"account_type": accountType, "currency": cur}, http.StatusCreated, &created)
+	return created.AccountNumber
+}
+
+// accounts returns the accounts of c by number.
+func (h *harness) accounts(t *testing.T, c *customer) map[string]*account.Account {
+	t.Helper()
+	var list []*account.Account
+	h.do(t, "GET", "/accounts", c.Token, nil, http.StatusOK, &list)
+	byNumber := make(map[string]*account.Account)
+	for _, acc := range list {
+		byNumber[acc.AccountNumber] = acc
+	}
+	return byNumber
+}
+
+func (h *harness) balance(t *testing.T, c *customer, accountNumber string) float64 {
+	t.Helper()
+	acc, ok := h.accounts(t, c)[accountNumber]
+	if !ok {
+		t.Fatalf("account %s is not listed", accountNumber)
+	}
+	return acc.Balance
+}
+
+func wantAmount(t *testing.T, what string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 0.005 {
+		t.Errorf("%s = %.2f, want %.2f", what, got, want)
+	}
+}
+
+// --- Flows ---
+
+func TestSignupLoginDepositConvert(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	checking := h.openAccount(t, c, account.TypeChecking, "EUR")
+
+	var deposit transactions.Transaction
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 100}, http.StatusOK, &deposit)
+	if deposit.TransactionType != transactions.TypeDeposit || deposit.Status != transactions.StatusPosted {
+		t.Errorf("deposit = %+v", deposit)
+	}
+	wantAmount(t, "deposit amount", deposit.Amount, 100)
+
+	// Foreign currency deposits are converted at the mid-market rate
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 55, Currency: "USD"}, http.StatusOK, &deposit)
+	wantAmount(t, "converted deposit", deposit.Amount, 50)
+	if deposit.OriginalAmount == nil || *deposit.OriginalAmount != 55 || deposit.OriginalCurrency != "USD" || deposit.FXRate == nil {
+		t.Errorf("converted deposit does not record the conversion: %+v", deposit)
+	}
+	wantAmount(t, "balance after deposits", h.balance(t, c, checking), 150)
+
+	var conversions []currency.ConversionResult
+	h.do(t, "GET", "/convert?from=EUR&to=GBP&amount=100", "", nil, http.StatusOK, &conversions)
+	if len(conversions) != 1 {
+		t.Fatalf("single target conversion = %+v, want one result", conversions)
+	}
+	wantAmount(t, "EUR to GBP conversion", conversions[0].Converted, 85)
+	h.do(t, "GET", "/convert?from=GBP&to=USD,EUR&amount=85", "", nil, http.StatusOK, &conversions)
+	if len(conversions) != 2 || conversions[0].To != "USD" || conversions[1].To != "EUR" {
+		t.Fatalf("batch conversion = %+v, want USD then EUR", conversions)
+	}
+	wantAmount(t, "GBP to USD cross rate", conversions[0].Converted, 110)
+	wantAmount(t, "GBP to EUR conversion", conversions[1].Converted, 100)
+
+	var withdrawal transactions.Transaction
+	h.do(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: checking, Amount: 30}, http.StatusOK, &withdrawal)
+	wantAmount(t, "withdrawal amount", withdrawal.Amount, -30)
+	wantAmount(t, "balance after withdrawal", h.balance(t, c, checking), 120)
+
+	var history []*transactions.Transaction
+	h.do(t, "GET", "/transactions?account_number="+checking, c.Token, nil, http.StatusOK, &history)
+	if len(history) != 3 || history[0].TransactionType != transactions.TypeWithdrawal {
+		t.Errorf("history has %d transactions, want 3 with the withdrawal first", len(history))
+	}
+}
+
+func TestTransferBetweenOwnAccounts(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	eur := h.openAccount(t, c, account.TypeChecking, "EUR")
+	usd := h.openAccount(t, c, account.TypeSavings, "USD")
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: eur, Amount: 200}, http.StatusOK, nil)
+
+	var transfer transactions.TransferResult
+	h.do(t, "POST", "/transfer", c.Token, transactions.TransferRequest{
+		FromAccountNumber: eur, ToAccountNumber: usd, Amount: 100, Reference: "INV-1",
+	}, http.StatusOK, &transfer)
+	wantAmount(t, "debited amount", transfer.Debit.Amount, -100)
+	wantAmount(t, "credited amount", transfer.Credit.Amount, 110)
+	if transfer.Credit.Reference != "INV-1" || transfer.Debit.CounterpartyAccount != usd {
+		t.Errorf("transfer legs do not carry the details: %+v, %+v", transfer.Debit, transfer.Credit)
+	}
+
+	accounts := h.accounts(t, c)
+	wantAmount(t, "EUR balance", accounts[eur].Balance, 100)
+	wantAmount(t, "USD balance", accounts[usd].Balance, 110)
+}
+
+func TestOpeningDeposit(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+
+	// Fixed-term deposits keep a minimum balance from the day they are opened
+	h.wantError(t, "POST", "/create-account", c.Token, account.CreateAccountRequest{AccountType: account.TypeFixedTermDeposit},
+		http.StatusBadRequest, "Initial deposit must cover the minimum balance of 1000.00 EUR")
+	h.wantError(t, "POST", "/create-account", c.Token, account.CreateAccountRequest{AccountType: account.TypeChecking, InitialDeposit: -1},
+		http.StatusBadRequest, "Initial deposit must not be negative")
+
+	var created struct {
+		AccountNumber string `json:"account_number"`
+	}
+	h.do(t, "POST", "/create-account", c.Token, account.CreateAccountRequest{AccountType: account.TypeFixedTermDeposit, InitialDeposit: 1000},
+		http.StatusCreated, &created)
+	wantAmount(t, "opening balance", h.balance(t, c, created.AccountNumber), 1000)
+
+	var history []*transactions.Transaction
+	h.do(t, "GET", "/transactions?account_number="+created.AccountNumber, c.Token, nil, http.StatusOK, &history)
+	if len(history) != 1 || history[0].TransactionType != transactions.TypeDeposit || history[0].Description != "Opening deposit" {
+		t.Errorf("history is %+v, want only the opening deposit", history)
+	}
+}
+
+func TestMultiCurrencyExchange(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	wallet := h.openAccount(t, c, account.TypeMultiCurrency, "EUR")
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: wallet, Amount: 100}, http.StatusOK, nil)
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: wallet, Amount: 10, Currency: "GBP"}, http.StatusOK, nil)
+
+	var exchange transactions.ExchangeResult
+	h.do(t, "POST", "/accounts/exchange", c.Token, transactions.ExchangeRequest{
+		AccountNumber: wallet, From: "EUR", To: "USD", Amount: 50,
+	}, http.StatusOK, &exchange)
+	wantAmount(t, "exchanged amount", exchange.Credit.Amount, 55)
+
+	pockets := h.accounts(t, c)[wallet].Pockets
+	wantAmount(t, "EUR pocket", pockets["EUR"], 50)
+	wantAmount(t, "USD pocket", pockets["USD"], 55)
+	wantAmount(t, "GBP pocket", pockets["GBP"], 10)
+
+	h.wantError(t, "POST", "/accounts/exchange", c.Token, transactions.ExchangeRequest{
+		AccountNumber: wallet, From: "USD", To: "EUR", Amount: 100,
+	}, http.StatusUnprocessableEntity, account.ErrInsufficientFunds.Error())
+}
+
+func TestQuotedDeposit(t *testing.T) {
+	h := newHarness(t)
+	if h.DB == nil {
+		t.Skip("quotes are stored in Postgres; set TEST_DATABASE_URL")
+	}
+	c := h.signUp(t)
+	checking := h.openAccount(t, c, account.TypeChecking, "USD")
+
+	var quote currency.Quote
+	h.do(t, "POST", "/fx/quotes", c.Token, currency.QuoteRequest{From: "EUR", To: "USD", Amount: 100}, http.StatusCreated, &quote)
+	wantAmount(t, "quoted amount", quote.ConvertedAmount, 100*1.10*(1-config.Default().FX.Spread))
+
+	var deposit transactions.Transaction
+	request := transactions.DepositRequest{AccountNumber: checking, Amount: 100, Currency: "EUR", QuoteID: quote.ID}
+	h.do(t, "POST", "/deposit", c.Token, request, http.StatusOK, &deposit)
+	wantAmount(t, "deposit at the quoted rate", deposit.Amount, quote.ConvertedAmount)
+	if deposit.FXQuoteID != quote.ID {
+		t.Errorf("deposit references quote %q, want %q", deposit.FXQuoteID, quote.ID)
+	}
+
+	h.wantError(t, "POST", "/deposit", c.Token, request, http.StatusConflict, currency.ErrQuoteUsed.Error())
+
+	request.QuoteID = "not-a-quote"
+	h.wantError(t, "POST", "/deposit", c.Token, request, http.StatusNotFound, currency.ErrQuoteNotFound.Error())
+}
+
+func TestRatesOnWeekends(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+
+	h.wantError(t, "GET", "/rates?date=2025-01-04", "", nil, http.StatusUnauthorized, "Authorization header required")
+
+	// Saturday and Sunday get the rates published on Friday
+	var table currency.ExchangeRate
+	h.do(t, "GET", "/rates?date=2025-01-04&base=USD", c.Token, nil, http.StatusOK, &table)
+	if table.Date != "2025-01-03" || table.Base != "USD" {
+		t.Errorf("rates of Saturday are the %s table of %s, want the USD table of 2025-01-03", table.Base, table.Date)
+	}
+	wantAmount(t, "USD/EUR rate", table.Rates["EUR"], 1/1.10)
+
+	requests := h.FX.requests.Load()
+	h.do(t, "GET", "/rates?date=2025-01-05", c.Token, nil, http.StatusOK, &table)
+	if table.Date != "2025-01-03" {
+		t.Errorf("rates of Sunday are the table of %s, want 2025-01-03", table.Date)
+	}
+	if h.DB != nil && h.FX.requests.Load() != requests {
+		t.Error("rates of Sunday were fetched again instead of served from the recorded Friday table")
+	}
+}
+
+func TestSpendingLimits(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	checking := h.openAccount(t, c, account.TypeChecking, "EUR")
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 200}, http.StatusOK, nil)
+
+	daily := 50.0
+	h.do(t, "PUT", "/limits", c.Token, limits.UpdateLimitsRequest{Override: limits.Override{Daily: &daily}}, http.StatusOK, nil)
+	h.do(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: checking, Amount: 30}, http.StatusOK, nil)
+	h.do(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: checking, Amount: 30}, http.StatusUnprocessableEntity, nil)
+
+	var status limits.LimitsResponse
+	h.do(t, "GET", "/limits", c.Token, nil, http.StatusOK, &status)
+	if status.User == nil || len(status.Accounts) != 1 {
+		t.Fatalf("limits = %+v, want the user and one account", status)
+	}
+	wantAmount(t, "daily limit", status.User.Limits.Daily, 50)
+	wantAmount(t, "used today", status.User.Used.Daily, 30)
+	wantAmount(t, "remaining today", status.User.Remaining.Daily, 20)
+	wantAmount(t, "balance after the rejected withdrawal", h.balance(t, c, checking), 170)
+}
+
+// --- Error Paths ---
+
+func TestAuthErrors(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+
+	h.wantError(t, "POST", "/signup", "", auth.SignupRequest{FullName: "Ada Lovelace", DNI: c.DNI, Email: "other@example.com"},
+		http.StatusConflict, "A user with this DNI or email already exists")
+	h.do(t, "POST", "/signup", "", auth.SignupRequest{FullName: "Ada Lovelace", DNI: "12345678A", Email: "ada@example.com"},
+		http.StatusBadRequest, nil)
+
+	h.wantError(t, "POST", "/login", "", auth.LoginRequest{DNI: c.DNI, Pin: "wrong"}, http.StatusUnauthorized, "Invalid DNI or PIN")
+	h.wantError(t, "POST", "/login", "", auth.LoginRequest{DNI: newDNI(), Pin: c.PIN}, http.StatusUnauthorized, "Invalid DNI or PIN")
+
+	h.wantError(t, "GET", "/accounts", "", nil, http.StatusUnauthorized, "Authorization header required")
+	h.do(t, "GET", "/accounts", "not-a-token", nil, http.StatusUnauthorized, nil)
+
+	// Customers cannot use back-office routes
+	h.wantError(t, "POST", "/transactions/1/reverse", c.Token, map[string]string{"reason": "test"}, http.StatusForbidden, "Insufficient permissions")
+}
+
+func TestDatabaseOnlyRoutes(t *testing.T) {
+	h := newHarness(t)
+	if h.DB != nil {
+		t.Skip("every route is served with a database")
+	}
+	c := h.signUp(t)
+
+	for _, path := range []string{"/beneficiaries", "/beneficiaries/5f0c6a8e-3f4b-4c1e-9d2a-7b6e1f0a9c3d", "/notifications", "/fx/quotes"} {
+		h.wantError(t, "GET", path, c.Token, nil, http.StatusNotImplemented, "Not available without a database")
+	}
+}
+
+func TestMetricsOnAdminListener(t *testing.T) {
+	h := newHarness(t)
+	admin := httptest.NewServer((&app{}).adminRoutes())
+	t.Cleanup(admin.Close)
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	if body := get(h.URL + "/metrics"); strings.Contains(body, "go_goroutines") {
+		t.Error("the API listener serves the metrics")
+	}
+	if body := get(admin.URL + "/metrics"); !strings.Contains(body, "go_goroutines") {
+		t.Errorf("the admin listener does not serve the metrics: %.200s", body)
+	}
+}
+
+func TestLedgerErrors(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	other := h.signUp(t)
+	checking := h.openAccount(t, c, account.TypeChecking, "EUR")
+	savings := h.openAccount(t, c, account.TypeSavings, "EUR")
+	foreign := h.openAccount(t, other, account.TypeChecking, "EUR")
+
+	h.wantError(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: -5},
+		http.StatusBadRequest, "Deposit amount must be positive")
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 5, Currency: "XXX"},
+		http.StatusBadRequest, nil)
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: "ES00", Amount: 5},
+		http.StatusBadRequest, nil)
+	h.wantError(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: foreign, Amount: 5},
+		http.StatusUnauthorized, "Account does not belong to the user")
+
+	// Checking accounts can go 500 into overdraft, savings accounts cannot
+	h.do(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: checking, Amount: 500}, http.StatusOK, nil)
+	h.wantError(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: checking, Amount: 1},
+		http.StatusUnprocessableEntity, account.ErrInsufficientFunds.Error())
+	h.wantError(t, "POST", "/withdraw", c.Token, transactions.WithdrawRequest{AccountNumber: savings, Amount: 1},
+		http.StatusUnprocessableEntity, account.ErrInsufficientFunds.Error())
+	wantAmount(t, "balance after rejected withdrawals", h.balance(t, c, checking), -500)
+
+	h.wantError(t, "POST", "/transfer", c.Token, transactions.TransferRequest{FromAccountNumber: checking, ToAccountNumber: checking, Amount: 1},
+		http.StatusBadRequest, transactions.ErrSameAccount.Error())
+
+	// Other users can only be paid through saved payees
+	h.wantError(t, "POST", "/transfer", c.Token, transactions.TransferRequest{FromAccountNumber: savings, ToAccountNumber: foreign, Amount: 1},
+		http.StatusForbidden, beneficiaries.ErrPayeeRequired.Error())
+	h.wantError(t, "POST", "/transfer", c.Token, transactions.TransferRequest{
+		FromAccountNumber: savings, BeneficiaryID: "5f0c6a8e-3f4b-4c1e-9d2a-7b6e1f0a9c3d", Amount: 1,
+	}, http.StatusNotFound, beneficiaries.ErrBeneficiaryNotFound.Error())
+	h.wantError(t, "POST", "/deposit", c.Token, transactions.DepositRequest{
+		AccountNumber: savings, Amount: 1, Currency: "USD", QuoteID: "5f0c6a8e-3f4b-4c1e-9d2a-7b6e1f0a9c3d",
+	}, http.StatusNotFound, currency.ErrQuoteNotFound.Error())
+
+	var history []*transactions.Transaction
+	h.do(t, "GET", "/transactions", c.Token, nil, http.StatusOK, &history)
+	if len(history) != 1 {
+		t.Errorf("history has %d transactions, want only the accepted withdrawal", len(history))
+	}
+	h.do(t, "GET", "/transactions?account_number="+foreign, c.Token, nil, http.StatusUnauthorized, nil)
+}
+
+func TestRequestIDForwardedToFXProvider(t *testing.T) {
+	h := newHarness(t)
+
+	req, err := http.NewRequest("GET", h.URL+"/convert?from=EUR&to=USD&amount=10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(auth.RequestIDHeader, "convert-42")
+	resp, err := h.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get(auth.RequestIDHeader); got != "convert-42" {
+		t.Errorf("response %s = %q, want convert-42", auth.RequestIDHeader, got)
+	}
+	if got, _ := h.FX.lastRequestID.Load().(string); got != "convert-42" {
+		t.Errorf("FX provider got %s %q, want convert-42", auth.RequestIDHeader, got)
+	}
+}
+
+func TestFXProviderDown(t *testing.T) {
+	h := newHarness(t)
+	c := h.signUp(t)
+	checking := h.openAccount(t, c, account.TypeChecking, "EUR")
+	h.FX.down.Store(true)
+
+	h.wantError(t, "GET", "/convert?from=EUR&to=USD&amount=10", "", nil, http.StatusBadGateway, "Failed to get exchange rate")
+	h.wantError(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 10, Currency: "USD"},
+		http.StatusBadGateway, "Failed to get exchange rate")
+	wantAmount(t, "balance after the failed deposit", h.balance(t, c, checking), 0)
+
+	// Deposits in the account currency need no rate
+	h.do(t, "POST", "/deposit", c.Token, transactions.DepositRequest{AccountNumber: checking, Amount: 10}, http.StatusOK, nil)
+	h.do(t, "GET", "/healthz", "", nil, http.StatusOK, nil)
+	if h.FX.requests.Load() == 0 {
+		t.Error("the stub FX provider was never called")
+	}
+}
@@ -0,0 +1,200 @@
+package fees
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"banking-backend/account"
+	"banking-backend/config"
+	"banking-backend/currency"
+)
+
+// --- Models ---
+
+// Operations that can be charged. FX applies on top of the operation that
+// converts the funds (deposits, transfers and exchanges).
+const (
+	OpWithdrawal = "withdrawal"
+	OpTransfer   = "transfer"
+	OpFX         = "fx"
+)
+
+// Rule kinds.
+const (
+	KindFlat       = "flat"
+	KindPercentage = "percentage"
+	KindTiered     = "tiered"
+)
+
+var ErrInvalidRule = errors.New("invalid fee rule")
+
+// Rule prices one operation. Product and Currency narrow the rule to an
+// account type and to the currency the fee is charged in; empty matches any.
+// Flat and tiered rules charge fixed amounts, so they need a currency.
+type Rule struct {
+	TransactionType string  `json:"transaction_type"`
+	Product         string  `json:"product,omitempty"`
+	Currency        string  `json:"currency,omitempty"`
+	Kind            string  `json:"kind"`
+	Amount          float64 `json:"amount,omitempty"` // Flat fee
+	Rate            float64 `json:"rate,omitempty"`   // Percentage fee as a fraction, e.g. 0.01 for 1%
+	Min             float64 `json:"min,omitempty"`    // Bounds of percentage fees; 0 means unbounded
+	Max             float64 `json:"max,omitempty"`
+	Tiers           []Tier  `json:"tiers,omitempty"`
+}
+
+// Tier applies to amounts up to UpTo (inclusive); the last tier must leave
+// UpTo at 0 to cover any larger amount. Its fee is Amount plus Rate of the
+// amount.
+type Tier struct {
+	UpTo   float64 `json:"up_to"`
+	Amount float64 `json:"amount,omitempty"`
+	Rate   float64 `json:"rate,omitempty"`
+}
+
+// Fee is a priced charge, before it is posted.
+type Fee struct {
+	TransactionType string  `json:"transaction_type"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency"`
+}
+
+func (r *Rule) validate() error {
+	switch r.TransactionType {
+	case OpWithdrawal, OpTransfer, OpFX:
+	default:
+		return fmt.Errorf("%w: unknown transaction type %q", ErrInvalidRule, r.TransactionType)
+	}
+	if r.Product != "" {
+		if _, err := account.GetProduct(r.Product); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+	if r.Currency != "" {
+		if _, err := currency.Lookup(r.Currency); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	} else if r.Kind == KindFlat || r.Kind == KindTiered {
+		return fmt.Errorf("%w: %s rule without a currency", ErrInvalidRule, r.Kind)
+	}
+
+	switch r.Kind {
+	case KindFlat:
+		if r.Amount < 0 {
+			return fmt.Errorf("%w: flat amount must not be negative", ErrInvalidRule)
+		}
+	case KindPercentage:
+		if r.Rate < 0 || r.Rate >= 1 || r.Min < 0 || (r.Max > 0 && r.Max < r.Min) {
+			return fmt.Errorf("%w: percentage rate must be in [0, 1) with min <= max", ErrInvalidRule)
+		}
+	case KindTiered:
+		if len(r.Tiers) == 0 {
+			return fmt.Errorf("%w: tiered rule without tiers", ErrInvalidRule)
+		}
+		for i, tier := range r.Tiers {
+			last := i == len(r.Tiers)-1
+			if tier.Amount < 0 || tier.Rate < 0 || tier.Rate >= 1 {
+				return fmt.Errorf("%w: tier %d has a negative amount or an invalid rate", ErrInvalidRule, i)
+			}
+			if tier.UpTo <= 0 && !last {
+				return fmt.Errorf("%w: only the last tier may be unbounded", ErrInvalidRule)
+			}
+			if tier.UpTo > 0 && last {
+				return fmt.Errorf("%w: the last tier must be unbounded", ErrInvalidRule)
+			}
+			if i > 0 && tier.UpTo > 0 && tier.UpTo <= r.Tiers[i-1].UpTo {
+				return fmt.Errorf("%w: tiers must be sorted by up_to", ErrInvalidRule)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+	}
+	return nil
+}
+
+func (r *Rule) matches(op, product, cur string) bool {
+	return r.TransactionType == op &&
+		(r.Product == "" || r.Product == product) &&
+		(r.Currency == "" || r.Currency == cur)
+}
+
+// price returns the fee of the rule for amount, before rounding.
+func (r *Rule) price(amount float64) float64 {
+	switch r.Kind {
+	case KindFlat:
+		return r.Amount
+	case KindPercentage:
+		fee := amount * r.Rate
+		if fee < r.Min {
+			fee = r.Min
+		}
+		if r.Max > 0 && fee > r.Max {
+			fee = r.Max
+		}
+		return fee
+	case KindTiered:
+		for _, tier := range r.Tiers {
+			if tier.UpTo <= 0 || amount <= tier.UpTo {
+				return tier.Amount + amount*tier.Rate
+			}
+		}
+	}
+	return 0
+}
+
+// --- Schedule ---
+
+// Schedule holds the fee rules. For each operation the first matching rule,
+// in file order, applies; operations without a matching rule are free.
+type Schedule struct {
+	Rules []Rule `json:"rules"`
+}
+
+// NewScheduleFromFile loads and validates the rules of a JSON file.
+func NewScheduleFromFile(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fee rules: %w", err)
+	}
+
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("could not decode fee rules: %w", err)
+	}
+	for i := range schedule.Rules {
+		if err := schedule.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("fee rule %d: %w", i, err)
+		}
+	}
+	return &schedule, nil
+}
+
+// NewSchedule loads the rules file of cfg. Without one no fees are charged.
+func NewSchedule(cfg config.Fees) (*Schedule, error) {
+	if cfg.RulesFile == "" {
+		return &Schedule{}, nil
+	}
+	return NewScheduleFromFile(cfg.RulesFile)
+}
+
+// Quote prices an operation on an account of the given product, charged in
+// cur on amount. It returns nil when the operation is free.
+func (s *Schedule) Quote(op, product, cur string, amount float64) *Fee {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if !rule.matches(op, product, cur) {
+			continue
+		}
+		fee := currency.Round(rule.price(amount), cur)
+		if fee <= 0 {
+			return nil
+		}
+		return &Fee{TransactionType: op, Amount: fee, Currency: cur}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package fees_test
+
+import (
+	"banking-backend/account"
+	"banking-backend/fees"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadSchedule(t *testing.T) *fees.Schedule {
+	t.Helper()
+	schedule, err := fees.NewScheduleFromFile("testdata/rules.json")
+	if err != nil {
+		t.Fatalf("NewScheduleFromFile: %v", err)
+	}
+	return schedule
+}
+
+func TestQuote(t *testing.T) {
+	schedule := loadSchedule(t)
+
+	tests := []struct {
+		name    string
+		op      string
+		product string
+		cur     string
+		amount  float64
+		want    float64 // 0 means free
+	}{
+		{"savings withdrawal", fees.OpWithdrawal, account.TypeSavings, "EUR", 100, 2},
+		{"free withdrawal", fees.OpWithdrawal, account.TypeChecking, "EUR", 100, 0},
+		{"first tier", fees.OpTransfer, account.TypeChecking, "EUR", 500, 0},
+		{"first tier bound is inclusive", fees.OpTransfer, account.TypeChecking, "EUR", 1000, 0},
+		{"second tier", fees.OpTransfer, account.TypeChecking, "EUR", 1000.01, 1},
+		{"second tier bound is inclusive", fees.OpTransfer, account.TypeChecking, "EUR", 10000, 1},
+		{"unbounded tier", fees.OpTransfer, account.TypeChecking, "EUR", 10000.01, 10},
+		{"unbounded tier rate", fees.OpTransfer, account.TypeChecking, "EUR", 100000, 55},
+		{"transfer in another currency", fees.OpTransfer, account.TypeChecking, "USD", 100000, 1.5},
+		{"percentage", fees.OpFX, account.TypeChecking, "EUR", 1000, 5},
+		{"percentage minimum", fees.OpFX, account.TypeChecking, "EUR", 10, 0.5},
+		{"percentage maximum", fees.OpFX, account.TypeChecking, "EUR", 20000, 50},
+		{"percentage rounded to the currency", fees.OpFX, account.TypeChecking, "JPY", 1099, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee := schedule.Quote(tt.op, tt.product, tt.cur, tt.amount)
+			if tt.want == 0 {
+				if fee != nil {
+					t.Errorf("Quote = %+v, want no fee", fee)
+				}
+				return
+			}
+			if fee == nil {
+				t.Fatalf("Quote = nil, want %.2f", tt.want)
+			}
+			if math.Abs(fee.Amount-tt.want) > 1e-9 || fee.Currency != tt.cur || fee.TransactionType != tt.op {
+				t.Errorf("Quote = %+v, want %.2f %s for %s", fee, tt.want, tt.cur, tt.op)
+			}
+		})
+	}
+}
+
+func TestQuoteWithoutSchedule(t *testing.T) {
+	var schedule *fees.Schedule
+	if fee := schedule.Quote(fees.OpTransfer, account.TypeChecking, "EUR", 100); fee != nil {
+		t.Errorf("Quote on a nil schedule = %+v, want no fee", fee)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"unknown transaction type", `{"transaction_type": "deposit", "kind": "flat", "amount": 1}`},
+		{"unknown product", `{"transaction_type": "fx", "product": "brokerage", "kind": "percentage", "rate": 0.01}`},
+		{"unknown currency", `{"transaction_type": "fx", "currency": "XXX", "kind": "flat", "amount": 1}`},
+		{"unknown kind", `{"transaction_type": "fx", "kind": "free"}`},
+		{"flat rule without currency", `{"transaction_type": "fx", "kind": "flat", "amount": 1}`},
+		{"tiered rule without currency", `{"transaction_type": "transfer", "kind": "tiered", "tiers": [{"amount": 1}]}`},
+		{"negative flat amount", `{"transaction_type": "fx", "currency": "EUR", "kind": "flat", "amount": -1}`},
+		{"percentage rate of 100%", `{"transaction_type": "fx", "kind": "percentage", "rate": 1}`},
+		{"percentage max below min", `{"transaction_type": "fx", "kind": "percentage", "rate": 0.01, "min": 5, "max": 1}`},
+		{"no tiers", `{"transaction_type": "transfer", "currency": "EUR", "kind": "tiered"}`},
+		{"bounded last tier", `{"transaction_type": "transfer", "currency": "EUR", "kind": "tiered", "tiers": [
+			{"up_to": 1000, "amount": 0}, {"up_to": 5000, "amount": 1}]}`},
+		{"unbounded middle tier", `{"transaction_type": "transfer", "currency": "EUR", "kind": "tiered", "tiers": [
+			{"up_to": 1000, "amount": 0}, {"amount": 1}, {"amount": 2}]}`},
+		{"unsorted tiers", `{"transaction_type": "transfer", "currency": "EUR", "kind": "tiered", "tiers": [
+			{"up_to": 5000, "amount": 1}, {"up_to": 1000, "amount": 0}, {"amount": 2}]}`},
+		{"negative tier amount", `{"transaction_type": "transfer", "currency": "EUR", "kind": "tiered", "tiers": [{"amount": -1}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(`{"rules": [`+tt.rules+`]}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fees.NewScheduleFromFile(path); !errors.Is(err, fees.ErrInvalidRule) {
+				t.Errorf("NewScheduleFromFile = %v, want ErrInvalidRule", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"banking-backend/auth"
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Models ---
+
+// Statuses of a dependency and of the whole service.
+const (
+	StatusOK           = "ok"
+	StatusDegraded     = "degraded"      // A non-critical dependency is failing
+	StatusUnavailable  = "unavailable"   // A critical dependency is failing
+	StatusShuttingDown = "shutting_down" // Draining before exit
+)
+
+// Check probes one dependency. Failing critical checks make the service not
+// ready; failing non-critical ones only degrade it.
+type Check struct {
+	Name     string
+	Critical bool
+	Func     func(ctx context.Context) error
+}
+
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Critical  bool    `json:"critical"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// --- Checker ---
+
+type Checker struct {
+	Checks  []Check
+	Timeout time.Duration // Per check
+
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{Checks: checks, Timeout: timeout}
+}
+
+// Shutdown marks the service as not ready so load balancers stop routing to
+// it while in-flight requests drain.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run probes every dependency concurrently.
+func (c *Checker) Run(ctx context.Context) *Report {
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(c.Checks))}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.Checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Func(ctx)
+			result := Result{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Critical:  check.Critical,
+			}
+			if err != nil {
+				// Errors may name internal hosts, so they are only logged
+				result.Status = StatusUnavailable
+				slog.WarnContext(ctx, "health check failed", "check", check.Name, "error", err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[check.Name] = result
+			switch {
+			case err == nil:
+			case check.Critical:
+				report.Status = StatusUnavailable
+			case report.Status == StatusOK:
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+// --- Handlers ---
+
+// LivenessHandler serves GET /healthz. It does not check dependencies: a
+// failing database should take the service out of rotation, not restart it.
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	auth.JSON(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// ReadinessHandler serves GET /readyz with the status and latency of every
+// dependency. It answers 503 while a critical dependency fails or the service
+// is shutting down.
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if c.shuttingDown.Load() {
+		auth.JSON(w, http.StatusServiceUnavailable, Report{Status: StatusShuttingDown})
+		return
+	}
+
+	report := c.Run(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	auth.JSON(w, status, report)
+}
@@ -0,0 +1,59 @@
+package interest
+
+import (
+	"fmt"
+	"time"
+)
+
+// --- Day-Count Conventions ---
+
+// DayCount computes the fraction of a year between two dates.
+type DayCount interface {
+	Name() string
+	YearFraction(start, end time.Time) float64
+}
+
+// Actual365 counts actual calendar days over a fixed 365-day year.
+type Actual365 struct{}
+
+func (Actual365) Name() string { return "ACT/365" }
+
+func (Actual365) YearFraction(start, end time.Time) float64 {
+	return float64(daysBetween(start, end)) / 365
+}
+
+// Thirty360 treats every month as 30 days and the year as 360 days (bond
+// basis). Day 31 counts as day 30 but February month ends are not adjusted,
+// so accruing one day at a time still adds up to 30 days per month.
+type Thirty360 struct{}
+
+func (Thirty360) Name() string { return "30/360" }
+
+func (Thirty360) YearFraction(start, end time.Time) float64 {
+	y1, m1, d1 := start.Date()
+	y2, m2, d2 := end.Date()
+	if d1 == 31 {
+		d1 = 30
+	}
+	if d2 == 31 && d1 >= 30 {
+		d2 = 30
+	}
+	days := 360*(y2-y1) + 30*(int(m2)-int(m1)) + (d2 - d1)
+	return float64(days) / 360
+}
+
+func ParseDayCount(name string) (DayCount, error) {
+	switch name {
+	case "", "ACT/365":
+		return Actual365{}, nil
+	case "30/360":
+		return Thirty360{}, nil
+	}
+	return nil, fmt.Errorf("unknown day-count convention %q", name)
+}
+
+func daysBetween(start, end time.Time) int {
+	s := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	e := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	return int(e.Sub(s).Hours() / 24)
+}
@@ -0,0 +1,99 @@
+package interest_test
+
+import (
+	"banking-backend/interest"
+	"math"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestActual365(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end time.Time
+		days       float64
+	}{
+		{"one day", date(2025, 3, 10), date(2025, 3, 11), 1},
+		{"same day", date(2025, 3, 10), date(2025, 3, 10), 0},
+		{"month end", date(2025, 1, 31), date(2025, 2, 1), 1},
+		{"Feb 28 to Mar 1", date(2025, 2, 28), date(2025, 3, 1), 1},
+		{"Feb 28 to Mar 1 in a leap year", date(2024, 2, 28), date(2024, 3, 1), 2},
+		{"Feb 29 to Mar 1", date(2024, 2, 29), date(2024, 3, 1), 1},
+		{"February", date(2025, 2, 1), date(2025, 3, 1), 28},
+		{"February in a leap year", date(2024, 2, 1), date(2024, 3, 1), 29},
+		{"whole year", date(2025, 1, 1), date(2026, 1, 1), 365},
+		{"whole leap year", date(2024, 1, 1), date(2025, 1, 1), 366},
+		{"times of day are ignored",
+			time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 11, 1, 0, 0, 0, time.UTC), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interest.Actual365{}.YearFraction(tt.start, tt.end)
+			if want := tt.days / 365; math.Abs(got-want) > 1e-12 {
+				t.Errorf("YearFraction = %v (%v days), want %v days", got, got*365, tt.days)
+			}
+		})
+	}
+}
+
+func TestThirty360(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end time.Time
+		days       float64
+	}{
+		{"one day", date(2025, 3, 10), date(2025, 3, 11), 1},
+		{"30th to 31st", date(2025, 1, 30), date(2025, 1, 31), 0},
+		{"31st to 1st", date(2025, 1, 31), date(2025, 2, 1), 1},
+		{"31st to 31st", date(2025, 1, 31), date(2025, 3, 31), 60},
+		{"15th to 31st", date(2025, 1, 15), date(2025, 1, 31), 16},
+		{"Feb 28 to Mar 1", date(2025, 2, 28), date(2025, 3, 1), 3},
+		{"Feb 28 to Feb 29", date(2024, 2, 28), date(2024, 2, 29), 1},
+		{"Feb 29 to Mar 1", date(2024, 2, 29), date(2024, 3, 1), 2},
+		{"February", date(2025, 2, 1), date(2025, 3, 1), 30},
+		{"February in a leap year", date(2024, 2, 1), date(2024, 3, 1), 30},
+		{"half a year", date(2025, 1, 15), date(2025, 7, 15), 180},
+		{"whole leap year", date(2024, 1, 1), date(2025, 1, 1), 360},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interest.Thirty360{}.YearFraction(tt.start, tt.end)
+			if want := tt.days / 360; math.Abs(got-want) > 1e-12 {
+				t.Errorf("YearFraction = %v (%v days), want %v days", got, got*360, tt.days)
+			}
+		})
+	}
+}
+
+// Interest accrues one day at a time, so the daily fractions of a year must
+// add up to the whole year under either convention.
+func TestDailyFractionsAddUpToAYear(t *testing.T) {
+	for _, year := range []int{2024, 2025} {
+		for _, dayCount := range []interest.DayCount{interest.Actual365{}, interest.Thirty360{}} {
+			var total float64
+			for day := date(year, 1, 1); day.Year() == year; day = day.AddDate(0, 0, 1) {
+				total += dayCount.YearFraction(day, day.AddDate(0, 0, 1))
+			}
+			want := dayCount.YearFraction(date(year, 1, 1), date(year+1, 1, 1))
+			if math.Abs(total-want) > 1e-9 {
+				t.Errorf("%s: daily fractions of %d add up to %v, want %v", dayCount.Name(), year, total, want)
+			}
+		}
+	}
+}
+
+func TestParseDayCount(t *testing.T) {
+	for name, want := range map[string]string{"": "ACT/365", "ACT/365": "ACT/365", "30/360": "30/360"} {
+		dayCount, err := interest.ParseDayCount(name)
+		if err != nil || dayCount.Name() != want {
+			t.Errorf("ParseDayCount(%q) = %v, %v, want %s", name, dayCount, err, want)
+		}
+	}
+	if _, err := interest.ParseDayCount("ACT/360"); err == nil {
+		t.Error("ParseDayCount accepted an unknown convention")
+	}
+}
@@ -0,0 +1,366 @@
+package interest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"banking-backend/account"
+	"banking-backend/clock"
+	"banking-backend/store"
+	"banking-backend/transactions"
+
+	"github.com/lib/pq"
+)
+
+// --- Models ---
+
+type Accrual struct {
+	AccountID     string
+	AccrualDate   time.Time
+	Balance       float64
+	AnnualRate    float64
+	DayCount      string
+	Amount        float64
+	PostedAt      *time.Time
+	TransactionID *int // Interest transaction crediting the accrual, if any
+}
+
+// Balance is the balance of an account at the end of a day.
+type Balance struct {
+	AccountID   string
+	AccountType string
+	Amount      float64
+}
+
+// PendingMonth is a month of an account with unposted accruals.
+type PendingMonth struct {
+	AccountNumber string
+	Month         time.Time
+}
+
+// --- Database ---
+
+// Repository stores the accruals and the days already accrued.
+type Repository interface {
+	// GetEndOfDayBalances returns the balance at the end of day of every
+	// account of the given types opened by then.
+	GetEndOfDayBalances(ctx context.Context, accountTypes []string, day time.Time) ([]Balance, error)
+	// RecordAccrual ignores an accrual of an account and day already recorded.
+	RecordAccrual(ctx context.Context, accrual *Accrual) error
+	RecordRun(ctx context.Context, day time.Time) error
+	// LastAccrualDate returns the latest day run, or the zero time.
+	LastAccrualDate(ctx context.Context) (time.Time, error)
+	// GetPendingMonths returns the months with unposted accruals dated before
+	// cutoff, oldest first.
+	GetPendingMonths(ctx context.Context, cutoff time.Time) ([]PendingMonth, error)
+	// SumUnposted totals the unposted accruals of an account from start until
+	// end.
+	SumUnposted(ctx context.Context, accountID string, start, end time.Time) (float64, error)
+	// MarkPosted records when the unposted accruals of an account from start
+	// until end were posted, and by which transaction when transactionID is
+	// not nil.
+	MarkPosted(ctx context.Context, accountID string, start, end, postedAt time.Time, transactionID *int) error
+	GetAccruals(ctx context.Context, accountID string) ([]*Accrual, error)
+}
+
+// DB is the Repository backed by Postgres.
+type DB struct {
+	*sql.DB
+}
+
+func (db *DB) GetEndOfDayBalances(ctx context.Context, accountTypes []string, day time.Time) ([]Balance, error) {
+	// Rebuild the end-of-day balance by removing everything posted afterwards
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `
+		SELECT a.id, a.account_type,
+		       a.balance - COALESCE((SELECT SUM(t.amount) FROM transactions t
+		                             WHERE t.account_id = a.id AND t.currency = a.currency AND t.timestamp >= $2), 0)
+		FROM accounts a
+		WHERE a.account_type = ANY($1) AND a.created_at < $2`,
+		pq.Array(accountTypes), day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, fmt.Errorf("could not get interest-bearing accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []Balance
+	for rows.Next() {
+		var b Balance
+		if err := rows.Scan(&b.AccountID, &b.AccountType, &b.Amount); err != nil {
+			return nil, fmt.Errorf("could not scan end-of-day balance: %w", err)
+		}
+		balances = append(balances, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounts: %w", err)
+	}
+	return balances, nil
+}
+
+func (db *DB) RecordAccrual(ctx context.Context, accrual *Accrual) error {
+	_, err := store.Conn(ctx, db.DB).ExecContext(ctx, `
+		INSERT INTO interest_accruals (account_id, accrual_date, balance, annual_rate, day_count, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (account_id, accrual_date) DO NOTHING`,
+		accrual.AccountID, accrual.AccrualDate, accrual.Balance, accrual.AnnualRate, accrual.DayCount, accrual.Amount)
+	if err != nil {
+		return fmt.Errorf("could not record accrual: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) RecordRun(ctx context.Context, day time.Time) error {
+	_, err := store.Conn(ctx, db.DB).ExecContext(ctx, `INSERT INTO interest_runs (accrual_date) VALUES ($1) ON CONFLICT DO NOTHING`, day)
+	if err != nil {
+		return fmt.Errorf("could not record accrual run: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) LastAccrualDate(ctx context.Context) (time.Time, error) {
+	var last sql.NullTime
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT MAX(accrual_date) FROM interest_runs`).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get last accrual date: %w", err)
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return truncateToDay(last.Time), nil
+}
+
+func (db *DB) GetPendingMonths(ctx context.Context, cutoff time.Time) ([]PendingMonth, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `
+		SELECT a.account_number, date_trunc('month', i.accrual_date)::date
+		FROM interest_accruals i JOIN accounts a ON a.id = i.account_id
+		WHERE i.posted_at IS NULL AND i.accrual_date < $1
+		GROUP BY 1, 2 ORDER BY 2, 1`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pending accruals: %w", err)
+	}
+	defer rows.Close()
+
+	var months []PendingMonth
+	for rows.Next() {
+		var p PendingMonth
+		if err := rows.Scan(&p.AccountNumber, &p.Month); err != nil {
+			return nil, fmt.Errorf("could not scan pending accrual: %w", err)
+		}
+		months = append(months, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending accruals: %w", err)
+	}
+	return months, nil
+}
+
+func (db *DB) SumUnposted(ctx context.Context, accountID string, start, end time.Time) (float64, error) {
+	var total float64
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM interest_accruals
+		WHERE account_id = $1 AND posted_at IS NULL AND accrual_date >= $2 AND accrual_date < $3`,
+		accountID, start, end).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("could not sum accruals: %w", err)
+	}
+	return total, nil
+}
+
+func (db *DB) MarkPosted(ctx context.Context, accountID string, start, end, postedAt time.Time, transactionID *int) error {
+	_, err := store.Conn(ctx, db.DB).ExecContext(ctx, `
+		UPDATE interest_accruals SET posted_at = $1, transaction_id = $2
+		WHERE account_id = $3 AND posted_at IS NULL AND accrual_date >= $4 AND accrual_date < $5`,
+		postedAt, transactionID, accountID, start, end)
+	if err != nil {
+		return fmt.Errorf("could not mark accruals as posted: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetAccruals(ctx context.Context, accountID string) ([]*Accrual, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `
+		SELECT account_id, accrual_date, balance, annual_rate, day_count, amount, posted_at, transaction_id
+		FROM interest_accruals WHERE account_id = $1 ORDER BY accrual_date`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get accruals: %w", err)
+	}
+	defer rows.Close()
+
+	var accruals []*Accrual
+	for rows.Next() {
+		a := &Accrual{}
+		if err := rows.Scan(&a.AccountID, &a.AccrualDate, &a.Balance, &a.AnnualRate, &a.DayCount, &a.Amount, &a.PostedAt, &a.TransactionID); err != nil {
+			return nil, fmt.Errorf("could not scan accrual: %w", err)
+		}
+		accruals = append(accruals, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accruals: %w", err)
+	}
+	return accruals, nil
+}
+
+// --- Engine ---
+
+// Engine accrues daily interest on end-of-day balances of interest-bearing
+// accounts and posts the accrued amounts once a month.
+type Engine struct {
+	Stores
+	Clock    clock.Clock
+	DayCount DayCount
+}
+
+// Stores are the repositories the engine accrues and posts through.
+type Stores struct {
+	Tx           store.Transactor
+	Accruals     Repository
+	Accounts     account.Repository
+	Transactions transactions.Repository
+}
+
+func NewEngine(stores Stores, c clock.Clock, dayCount DayCount) *Engine {
+	return &Engine{Stores: stores, Clock: c, DayCount: dayCount}
+}
+
+// Run executes RunOnce every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "interest run failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce accrues every completed day since the last accrual and posts every
+// completed month that still has unposted accruals. It is idempotent.
+func (e *Engine) RunOnce(ctx context.Context) error {
+	today := truncateToDay(e.Clock.Now())
+
+	last, err := e.Accruals.LastAccrualDate(ctx)
+	if err != nil {
+		return err
+	}
+	day := today.AddDate(0, 0, -1)
+	if !last.IsZero() {
+		day = last.AddDate(0, 0, 1)
+	}
+
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if err := e.AccrueDay(ctx, day); err != nil {
+			return err
+		}
+	}
+
+	return e.PostBefore(ctx, time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC))
+}
+
+// AccrueDay records one day of interest for every interest-bearing account,
+// based on the balance at the end of that day.
+func (e *Engine) AccrueDay(ctx context.Context, day time.Time) error {
+	day = truncateToDay(day)
+	nextDay := day.AddDate(0, 0, 1)
+	yearFraction := e.DayCount.YearFraction(day, nextDay)
+
+	rates := make(map[string]float64)
+	var accountTypes []string
+	for _, product := range account.Products() {
+		if product.InterestRate > 0 {
+			rates[product.Type] = product.InterestRate
+			accountTypes = append(accountTypes, product.Type)
+		}
+	}
+
+	balances, err := e.Accruals.GetEndOfDayBalances(ctx, accountTypes, day)
+	if err != nil {
+		return err
+	}
+	for _, balance := range balances {
+		if balance.Amount <= 0 {
+			continue
+		}
+		accrual := &Accrual{
+			AccountID:   balance.AccountID,
+			AccrualDate: day,
+			Balance:     balance.Amount,
+			AnnualRate:  rates[balance.AccountType],
+			DayCount:    e.DayCount.Name(),
+		}
+		accrual.Amount = accrual.Balance * accrual.AnnualRate * yearFraction
+		if err := e.Accruals.RecordAccrual(ctx, accrual); err != nil {
+			return err
+		}
+	}
+
+	return e.Accruals.RecordRun(ctx, day)
+}
+
+// PostBefore credits, per account and month, the unposted accruals dated
+// before cutoff as a single interest transaction.
+func (e *Engine) PostBefore(ctx context.Context, cutoff time.Time) error {
+	months, err := e.Accruals.GetPendingMonths(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	for _, p := range months {
+		if err := e.postMonth(ctx, p.AccountNumber, p.Month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) postMonth(ctx context.Context, accountNumber string, month time.Time) error {
+	return e.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		acc, err := e.Accounts.GetAccountForUpdate(ctx, accountNumber)
+		if err != nil || acc == nil {
+			return fmt.Errorf("could not lock account %s: %w", accountNumber, err)
+		}
+
+		nextMonth := month.AddDate(0, 1, 0)
+		total, err := e.Accruals.SumUnposted(ctx, acc.ID, month, nextMonth)
+		if err != nil {
+			return err
+		}
+
+		// Sub-cent totals are marked as posted without crediting anything
+		var transactionID *int
+		amount := math.Round(total*100) / 100
+		if amount > 0 {
+			balanceAfter := acc.Balance + amount
+			if err := e.Accounts.UpdateAccountBalance(ctx, acc.ID, balanceAfter); err != nil {
+				return err
+			}
+			transaction, err := e.Transactions.CreateTransaction(ctx, &transactions.Transaction{
+				AccountID:       acc.ID,
+				TransactionType: transactions.TypeInterest,
+				Amount:          amount,
+				Currency:        acc.Currency,
+				BalanceAfter:    &balanceAfter,
+				Description:     "Interest for " + month.Format("January 2006"),
+			})
+			if err != nil {
+				return err
+			}
+			transactionID = &transaction.ID
+		}
+
+		return e.Accruals.MarkPosted(ctx, acc.ID, month, nextMonth, e.Clock.Now(), transactionID)
+	})
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
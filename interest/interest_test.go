@@ -0,0 +1,179 @@
+package interest_test
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/db/migrations"
+	"banking-backend/interest"
+	"banking-backend/store"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"context"
+	"database/sql"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// backend holds the repositories the engine runs on, and the users owning
+// the accounts.
+type backend struct {
+	interest.Stores
+	Users auth.UserRepository
+	// backdate moves the opening of an account, which the repositories
+	// otherwise stamp with their own clock.
+	backdate func(t *testing.T, accountID string, openedAt time.Time)
+}
+
+// openMemory returns an in-memory backend stamping rows with c.
+func openMemory(t *testing.T, c clock.Clock) backend {
+	s := memory.New()
+	s.Clock = c
+	return backend{
+		Stores:   interest.Stores{Tx: s, Accruals: s, Accounts: s, Transactions: s},
+		Users:    s,
+		backdate: func(t *testing.T, accountID string, openedAt time.Time) {},
+	}
+}
+
+// openPostgres migrates and empties the database in TEST_DATABASE_URL.
+func openPostgres(t *testing.T) backend {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+	if _, err := db.Exec(`TRUNCATE users, interest_runs RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatalf("could not empty the database: %v", err)
+	}
+
+	return backend{
+		Stores: interest.Stores{
+			Tx:           store.Postgres{DB: db},
+			Accruals:     &interest.DB{DB: db},
+			Accounts:     &account.DB{DB: db},
+			Transactions: &transactions.DB{DB: db},
+		},
+		Users: &auth.DB{DB: db},
+		backdate: func(t *testing.T, accountID string, openedAt time.Time) {
+			if _, err := db.Exec(`UPDATE accounts SET created_at = $1 WHERE id = $2`, openedAt, accountID); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+}
+
+// TestRunOnce accrues February 2026 and March 1 on a savings account opened
+// in January, then posts February on March 2.
+func TestRunOnce(t *testing.T) {
+	const balance = 36000 // 1.50 a day at 1.5% under 30/360
+
+	backends := []struct {
+		name string
+		open func(t *testing.T, c clock.Clock) backend
+	}{
+		{"memory", openMemory},
+		{"postgres", func(t *testing.T, c clock.Clock) backend { return openPostgres(t) }},
+	}
+	tests := []struct {
+		dayCount interest.DayCount
+		posted   float64 // Interest for February
+		pending  float64 // Accrued on March 1
+	}{
+		{interest.Actual365{}, 41.42, balance * 0.015 / 365},
+		{interest.Thirty360{}, 45, 1.5},
+	}
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.dayCount.Name(), func(t *testing.T) {
+				openedAt := time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)
+				c := clock.NewFixed(openedAt)
+				s := b.open(t, c)
+				ctx := context.Background()
+
+				userID, err := s.Users.CreateUser(ctx, &auth.User{DNI: "12345678Z", FullName: "Ada Lovelace", Email: "ada@example.com"}, "hash")
+				if err != nil {
+					t.Fatalf("CreateUser: %v", err)
+				}
+				accountID, err := s.Accounts.CreateAccount(ctx, &account.Account{
+					UserID: userID, AccountNumber: "ES0000000000000000000001", Balance: balance, Currency: "EUR", AccountType: account.TypeSavings,
+				})
+				if err != nil {
+					t.Fatalf("CreateAccount: %v", err)
+				}
+				s.backdate(t, accountID, openedAt)
+				if err := s.Accruals.RecordRun(ctx, time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)); err != nil {
+					t.Fatalf("RecordRun: %v", err)
+				}
+
+				c.Set(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+				engine := interest.NewEngine(s.Stores, c, tt.dayCount)
+				// A second run finds nothing left to do
+				for range 2 {
+					if err := engine.RunOnce(ctx); err != nil {
+						t.Fatalf("RunOnce: %v", err)
+					}
+				}
+
+				accruals, err := s.Accruals.GetAccruals(ctx, accountID)
+				if err != nil {
+					t.Fatalf("GetAccruals: %v", err)
+				}
+				if len(accruals) != 29 {
+					t.Errorf("%d accruals, want one per day from February 1 to March 1", len(accruals))
+				}
+				var pending float64
+				for _, accrual := range accruals {
+					if accrual.PostedAt == nil {
+						pending += accrual.Amount
+					}
+				}
+				if math.Abs(pending-tt.pending) > 1e-6 {
+					t.Errorf("pending accruals = %v, want %v", pending, tt.pending)
+				}
+
+				history, err := s.Transactions.GetTransactionsByUserID(ctx, userID, "", 10)
+				if err != nil {
+					t.Fatalf("GetTransactionsByUserID: %v", err)
+				}
+				if len(history) != 1 || history[0].TransactionType != transactions.TypeInterest {
+					t.Fatalf("history = %+v, want one interest transaction", history)
+				}
+				if posted := history[0]; posted.Amount != tt.posted || posted.Description != "Interest for February 2026" {
+					t.Errorf("interest transaction = %.2f %q, want %.2f for February 2026", posted.Amount, posted.Description, tt.posted)
+				}
+				for _, accrual := range accruals {
+					if accrual.PostedAt != nil && (accrual.TransactionID == nil || *accrual.TransactionID != history[0].ID) {
+						t.Errorf("accrual of %s was posted by transaction %v, want %d", accrual.AccrualDate, accrual.TransactionID, history[0].ID)
+					}
+				}
+
+				acc, err := s.Accounts.GetAccountByAccountNumber(ctx, "ES0000000000000000000001")
+				if err != nil {
+					t.Fatalf("GetAccountByAccountNumber: %v", err)
+				}
+				if math.Abs(acc.Balance-(balance+tt.posted)) > 1e-9 {
+					t.Errorf("balance = %.2f, want %.2f", acc.Balance, balance+tt.posted)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package limits
+
+import (
+	"banking-backend/config"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/currency"
+	"banking-backend/store"
+	"banking-backend/transactions"
+)
+
+// --- Models ---
+
+// Limits bound the outgoing debits (withdrawals and outgoing transfers) of an
+// account or of all the accounts of a user. Amounts are in the engine
+// currency; the daily and monthly windows are calendar periods in UTC and the
+// hourly count is a rolling window.
+type Limits struct {
+	PerTransaction float64 `json:"per_transaction"`
+	Daily          float64 `json:"daily"`
+	Monthly        float64 `json:"monthly"`
+	HourlyCount    int     `json:"hourly_count"`
+}
+
+// Override holds the lower limits chosen by a user. Nil fields fall back to
+// the bank defaults.
+type Override struct {
+	PerTransaction *float64 `json:"per_transaction"`
+	Daily          *float64 `json:"daily"`
+	Monthly        *float64 `json:"monthly"`
+	HourlyCount    *int     `json:"hourly_count"`
+}
+
+// Usage is the amount and number of outgoing debits within each window.
+type Usage struct {
+	Daily       float64 `json:"daily"`
+	Monthly     float64 `json:"monthly"`
+	HourlyCount int     `json:"hourly_count"`
+}
+
+type Remaining struct {
+	Daily       float64 `json:"daily"`
+	Monthly     float64 `json:"monthly"`
+	HourlyCount int     `json:"hourly_count"`
+}
+
+type Status struct {
+	AccountNumber string    `json:"account_number,omitempty"`
+	Limits        Limits    `json:"limits"`
+	Used          Usage     `json:"used"`
+	Remaining     Remaining `json:"remaining"`
+}
+
+type LimitsResponse struct {
+	Currency string    `json:"currency"`
+	User     *Status   `json:"user"`
+	Accounts []*Status `json:"accounts"`
+}
+
+// UpdateLimitsRequest replaces the custom limits of the user, or of one of
+// their accounts when AccountNumber is set. Omitted fields reset to the bank
+// default.
+type UpdateLimitsRequest struct {
+	AccountNumber string `json:"account_number"`
+	Override
+}
+
+// apply returns the limits lowered by the override.
+func (l Limits) apply(o *Override) Limits {
+	if o == nil {
+		return l
+	}
+	if o.PerTransaction != nil && *o.PerTransaction < l.PerTransaction {
+		l.PerTransaction = *o.PerTransaction
+	}
+	if o.Daily != nil && *o.Daily < l.Daily {
+		l.Daily = *o.Daily
+	}
+	if o.Monthly != nil && *o.Monthly < l.Monthly {
+		l.Monthly = *o.Monthly
+	}
+	if o.HourlyCount != nil && *o.HourlyCount < l.HourlyCount {
+		l.HourlyCount = *o.HourlyCount
+	}
+	return l
+}
+
+// validate checks that every field of the override is positive and does not
+// exceed the bank default, expressed in code.
+func (o *Override) validate(defaults Limits, code string) error {
+	if o.PerTransaction != nil && (*o.PerTransaction <= 0 || *o.PerTransaction > defaults.PerTransaction) {
+		return fmt.Errorf("per_transaction must be between 0 and %s", currency.Format(defaults.PerTransaction, code))
+	}
+	if o.Daily != nil && (*o.Daily <= 0 || *o.Daily > defaults.Daily) {
+		return fmt.Errorf("daily must be between 0 and %s", currency.Format(defaults.Daily, code))
+	}
+	if o.Monthly != nil && (*o.Monthly <= 0 || *o.Monthly > defaults.Monthly) {
+		return fmt.Errorf("monthly must be between 0 and %s", currency.Format(defaults.Monthly, code))
+	}
+	if o.HourlyCount != nil && (*o.HourlyCount <= 0 || *o.HourlyCount > defaults.HourlyCount) {
+		return fmt.Errorf("hourly_count must be between 1 and %d", defaults.HourlyCount)
+	}
+	return nil
+}
+
+// IsEmpty reports whether the override keeps every bank default.
+func (o *Override) IsEmpty() bool {
+	return o.PerTransaction == nil && o.Daily == nil && o.Monthly == nil && o.HourlyCount == nil
+}
+
+func (s *Status) computeRemaining() {
+	s.Remaining = Remaining{
+		Daily:       max(s.Limits.Daily-s.Used.Daily, 0),
+		Monthly:     max(s.Limits.Monthly-s.Used.Monthly, 0),
+		HourlyCount: max(s.Limits.HourlyCount-s.Used.HourlyCount, 0),
+	}
+}
+
+// --- Database ---
+
+// Repository stores the custom limits of users and accounts.
+type Repository interface {
+	// LockUser serializes the limit checks of a user until the unit of work
+	// of ctx ends.
+	LockUser(ctx context.Context, userID string) error
+	// GetOverride returns the custom limits of a user (accountID empty) or of
+	// an account, or nil if there are none.
+	GetOverride(ctx context.Context, userID, accountID string) (*Override, error)
+	// SaveOverride replaces the custom limits; an override without any field
+	// removes them.
+	SaveOverride(ctx context.Context, userID, accountID string, o *Override) error
+}
+
+// DB is the Repository backed by Postgres.
+type DB struct {
+	*sql.DB
+}
+
+func (db *DB) LockUser(ctx context.Context, userID string) error {
+	if _, err := store.Conn(ctx, db.DB).ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return fmt.Errorf("could not lock user: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetOverride(ctx context.Context, userID, accountID string) (*Override, error) {
+	o := &Override{}
+	var perTransaction, daily, monthly sql.NullFloat64
+	var hourlyCount sql.NullInt64
+	query := `SELECT per_transaction, daily, monthly, hourly_count FROM spending_limits
+			  WHERE user_id = $1 AND account_id IS NOT DISTINCT FROM $2`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, userID, nullIfEmpty(accountID)).Scan(&perTransaction, &daily, &monthly, &hourlyCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get limits: %w", err)
+	}
+	if perTransaction.Valid {
+		o.PerTransaction = &perTransaction.Float64
+	}
+	if daily.Valid {
+		o.Daily = &daily.Float64
+	}
+	if monthly.Valid {
+		o.Monthly = &monthly.Float64
+	}
+	if hourlyCount.Valid {
+		n := int(hourlyCount.Int64)
+		o.HourlyCount = &n
+	}
+	return o, nil
+}
+
+// SaveOverride deletes and inserts the row, so callers run it within a unit
+// of work.
+func (db *DB) SaveOverride(ctx context.Context, userID, accountID string, o *Override) error {
+	conn := store.Conn(ctx, db.DB)
+	if _, err := conn.ExecContext(ctx, `DELETE FROM spending_limits WHERE user_id = $1 AND account_id IS NOT DISTINCT FROM $2`,
+		userID, nullIfEmpty(accountID)); err != nil {
+		return fmt.Errorf("could not reset limits: %w", err)
+	}
+	if o.IsEmpty() {
+		return nil
+	}
+	query := `INSERT INTO spending_limits (user_id, account_id, per_transaction, daily, monthly, hourly_count)
+			  VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := conn.ExecContext(ctx, query, userID, nullIfEmpty(accountID), o.PerTransaction, o.Daily, o.Monthly, o.HourlyCount); err != nil {
+		return fmt.Errorf("could not save limits: %w", err)
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// usage sums the outgoing debits of an account, or of every account of the
+// user when accountID is empty, converted into the engine currency.
+func (e *Engine) usage(ctx context.Context, userID, accountID string, now time.Time) (Usage, error) {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	hourAgo := now.Add(-time.Hour)
+	since := monthStart
+	if hourAgo.Before(since) {
+		since = hourAgo
+	}
+
+	debits, err := e.Transactions.GetDebitsSince(ctx, userID, accountID, since)
+	if err != nil {
+		return Usage{}, fmt.Errorf("could not get limit usage: %w", err)
+	}
+
+	// Total each currency first so that every rate is looked up once
+	type total struct {
+		daily, monthly float64
+		count          int
+	}
+	totals := make(map[string]*total)
+	for _, debit := range debits {
+		t := totals[debit.Currency]
+		if t == nil {
+			t = &total{}
+			totals[debit.Currency] = t
+		}
+		if !debit.Timestamp.Before(dayStart) {
+			t.daily -= debit.Amount
+		}
+		if !debit.Timestamp.Before(monthStart) {
+			t.monthly -= debit.Amount
+		}
+		if !debit.Timestamp.Before(hourAgo) {
+			t.count++
+		}
+	}
+
+	var u Usage
+	for _, code := range slices.Sorted(maps.Keys(totals)) {
+		rate, err := e.rate(ctx, code)
+		if err != nil {
+			return Usage{}, err
+		}
+		t := totals[code]
+		u.Daily += t.daily * rate
+		u.Monthly += t.monthly * rate
+		u.HourlyCount += t.count
+	}
+	u.Daily = currency.Round(u.Daily, e.Currency)
+	u.Monthly = currency.Round(u.Monthly, e.Currency)
+	return u, nil
+}
+
+// --- Engine ---
+
+// Engine enforces the spending limits on every outgoing debit. It implements
+// transactions.LimitChecker.
+type Engine struct {
+	Stores
+	Rates    currency.RateProvider
+	Clock    clock.Clock
+	Currency string // Currency the limits are expressed in
+	Account  Limits // Bank defaults per account
+	User     Limits // Bank defaults across all the accounts of a user
+}
+
+// Stores are the repositories the engine reads its overrides and the debits
+// from.
+type Stores struct {
+	Tx           store.Transactor
+	Overrides    Repository
+	Accounts     account.Repository
+	Transactions transactions.Repository
+}
+
+// NewEngine takes the limits currency and the bank defaults from cfg.
+func NewEngine(stores Stores, rates currency.RateProvider, c clock.Clock, cfg config.Limits) (*Engine, error) {
+	cur, err := currency.LookupSupported(cfg.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid limits currency: %w", err)
+	}
+	return &Engine{
+		Stores:   stores,
+		Rates:    rates,
+		Clock:    c,
+		Currency: cur.Code,
+		Account:  Limits(cfg.Account),
+		User:     Limits(cfg.User),
+	}, nil
+}
+
+// rate returns the rate from code into the engine currency.
+func (e *Engine) rate(ctx context.Context, code string) (float64, error) {
+	if code == e.Currency {
+		return 1, nil
+	}
+	rate, err := e.Rates.GetRate(ctx, code, e.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", transactions.ErrRateUnavailable, err)
+	}
+	return rate.Rate, nil
+}
+
+// CheckDebit rejects a debit of amount (in the account currency) that would
+// exceed the limits of the account or of its owner. The owner is locked inside
+// the unit of work carried by ctx so concurrent debits from different accounts
+// are counted consistently.
+func (e *Engine) CheckDebit(ctx context.Context, acc *account.Account, amount float64) error {
+	if err := e.Overrides.LockUser(ctx, acc.UserID); err != nil {
+		return err
+	}
+
+	rate, err := e.rate(ctx, acc.Currency)
+	if err != nil {
+		return err
+	}
+	amount = currency.Round(amount*rate, e.Currency)
+
+	now := e.Clock.Now()
+	for _, scope := range []struct {
+		name      string
+		accountID string
+		defaults  Limits
+	}{
+		{"account", acc.ID, e.Account},
+		{"user", "", e.User},
+	} {
+		override, err := e.Overrides.GetOverride(ctx, acc.UserID, scope.accountID)
+		if err != nil {
+			return err
+		}
+		limits := scope.defaults.apply(override)
+
+		if amount > limits.PerTransaction {
+			return fmt.Errorf("%w: %s per-transaction limit is %s", transactions.ErrLimitExceeded, scope.name, currency.Format(limits.PerTransaction, e.Currency))
+		}
+
+		used, err := e.usage(ctx, acc.UserID, scope.accountID, now)
+		if err != nil {
+			return err
+		}
+		switch {
+		case used.HourlyCount+1 > limits.HourlyCount:
+			return fmt.Errorf("%w: %s allows %d debits per hour", transactions.ErrLimitExceeded, scope.name, limits.HourlyCount)
+		case used.Daily+amount > limits.Daily:
+			return fmt.Errorf("%w: %s daily limit is %s", transactions.ErrLimitExceeded, scope.name, currency.Format(limits.Daily, e.Currency))
+		case used.Monthly+amount > limits.Monthly:
+			return fmt.Errorf("%w: %s monthly limit is %s", transactions.ErrLimitExceeded, scope.name, currency.Format(limits.Monthly, e.Currency))
+		}
+	}
+	return nil
+}
+
+// status returns the effective limits and usage of a scope.
+func (e *Engine) status(ctx context.Context, userID, accountID string, defaults Limits) (*Status, error) {
+	override, err := e.Overrides.GetOverride(ctx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := e.usage(ctx, userID, accountID, e.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	s := &Status{Limits: defaults.apply(override), Used: used}
+	s.computeRemaining()
+	return s, nil
+}
+
+// --- Handlers ---
+
+// GetLimitsHandler serves GET /limits with the limits, usage and remaining
+// allowance of the user and of each of their accounts.
+func (e *Engine) GetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Read every scope in one unit of work
+	response := &LimitsResponse{Currency: e.Currency, Accounts: []*Status{}}
+	err = e.Tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		accounts, err := e.Accounts.GetAccountsByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if response.User, err = e.status(ctx, userID, "", e.User); err != nil {
+			return err
+		}
+		for _, acc := range accounts {
+			s, err := e.status(ctx, userID, acc.ID, e.Account)
+			if err != nil {
+				return err
+			}
+			s.AccountNumber = acc.AccountNumber
+			response.Accounts = append(response.Accounts, s)
+		}
+		return nil
+	})
+	if err != nil {
+		auth.LoggerFromContext(r.Context()).Error("could not get limits", "error", err)
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get limits")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, response)
+}
+
+// UpdateLimitsHandler serves PUT /limits. Users can only lower their limits
+// below the bank defaults.
+func (e *Engine) UpdateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req UpdateLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	defaults := e.User
+	var accountID string
+	if req.AccountNumber != "" {
+		req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+		acc, err := e.Accounts.GetAccountByAccountNumber(r.Context(), req.AccountNumber)
+		if err != nil || acc == nil {
+			auth.RespondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		if acc.UserID != userID {
+			auth.RespondWithError(w, http.StatusUnauthorized, "Account does not belong to the user")
+			return
+		}
+		defaults = e.Account
+		accountID = acc.ID
+	}
+
+	if err := req.Override.validate(defaults, e.Currency); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = e.Tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		return e.Overrides.SaveOverride(ctx, userID, accountID, &req.Override)
+	})
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, defaults.apply(&req.Override))
+}
@@ -0,0 +1,274 @@
+package limits_test
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/config"
+	"banking-backend/currency"
+	"banking-backend/limits"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usdRates converts USD at 0.5 EUR.
+type usdRates struct{}
+
+func (usdRates) GetRate(ctx context.Context, from, to string) (*currency.Rate, error) {
+	if from != "USD" || to != "EUR" {
+		return nil, fmt.Errorf("no rate from %s to %s", from, to)
+	}
+	return &currency.Rate{From: from, To: to, Rate: 0.5}, nil
+}
+
+var cfg = config.Limits{
+	Currency: "EUR",
+	Account:  config.LimitSet{PerTransaction: 1000, Daily: 2000, Monthly: 5000, HourlyCount: 3},
+	User:     config.LimitSet{PerTransaction: 1500, Daily: 3000, Monthly: 8000, HourlyCount: 5},
+}
+
+type fixture struct {
+	store    *memory.Store
+	clock    *clock.Fixed
+	engine   *limits.Engine
+	userID   string
+	accounts map[string]*account.Account // By currency
+}
+
+// newFixture returns an engine on the memory store with one user holding a
+// checking account in EUR and another in USD.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{store: memory.New(), clock: clock.NewFixed(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)), accounts: map[string]*account.Account{}}
+	f.store.Clock = f.clock
+
+	var err error
+	f.userID, err = f.store.CreateUser(ctx, &auth.User{DNI: "12345678Z", FullName: "Ada Lovelace", Email: "ada@example.com"}, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for i, code := range []string{"EUR", "USD"} {
+		acc := &account.Account{UserID: f.userID, AccountNumber: fmt.Sprintf("ES000000000000000000000%d", i+1), Currency: code, AccountType: account.TypeChecking}
+		if acc.ID, err = f.store.CreateAccount(ctx, acc); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		f.accounts[code] = acc
+	}
+
+	f.engine, err = limits.NewEngine(limits.Stores{Tx: f.store, Overrides: f.store, Accounts: f.store, Transactions: f.store}, usdRates{}, f.clock, cfg)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return f
+}
+
+// movement is a past transaction of one of the accounts.
+type movement struct {
+	at              time.Time
+	currency        string // Of the account
+	transactionType string
+	amount          float64 // Positive; debits are stored negative
+}
+
+func debit(at time.Time, cur string, amount float64) movement {
+	return movement{at, cur, transactions.TypeWithdrawal, amount}
+}
+
+func (f *fixture) record(t *testing.T, movements ...movement) {
+	t.Helper()
+	for _, m := range movements {
+		f.clock.Set(m.at)
+		amount := m.amount
+		if m.transactionType != transactions.TypeDeposit {
+			amount = -amount
+		}
+		_, err := f.store.CreateTransaction(context.Background(), &transactions.Transaction{
+			AccountID: f.accounts[m.currency].ID, TransactionType: m.transactionType, Amount: amount, Currency: m.currency,
+		})
+		if err != nil {
+			t.Fatalf("CreateTransaction: %v", err)
+		}
+	}
+}
+
+func float(v float64) *float64 { return &v }
+func count(v int) *int         { return &v }
+
+func TestCheckDebit(t *testing.T) {
+	noon := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		now       time.Time // Noon on March 15 when zero
+		history   []movement
+		overrides map[string]*limits.Override // By account currency, "" for the user
+		currency  string
+		amount    float64
+		wantErr   string // Start of the limit error, "" when allowed
+	}{
+		{name: "within every limit", currency: "EUR", amount: 500},
+		{name: "account per-transaction", currency: "EUR", amount: 1000.01, wantErr: "account per-transaction"},
+		{name: "converted amount at the limit", currency: "USD", amount: 2000},
+		{name: "converted amount over the limit", currency: "USD", amount: 2002, wantErr: "account per-transaction"},
+
+		{name: "daily window", history: []movement{debit(noon.Add(-2*time.Hour), "EUR", 1500)},
+			currency: "EUR", amount: 600, wantErr: "account daily"},
+		{name: "yesterday is another day", history: []movement{debit(noon.Add(-13*time.Hour), "EUR", 1500)},
+			currency: "EUR", amount: 600},
+		{name: "transfers out count", history: []movement{{noon.Add(-2 * time.Hour), "EUR", transactions.TypeTransferOut, 1500}},
+			currency: "EUR", amount: 600, wantErr: "account daily"},
+		{name: "deposits do not count", history: []movement{{noon.Add(-2 * time.Hour), "EUR", transactions.TypeDeposit, 1500}},
+			currency: "EUR", amount: 600},
+
+		{name: "monthly window", history: []movement{
+			debit(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "EUR", 1600),
+			debit(time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC), "EUR", 1600),
+			debit(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), "EUR", 1600),
+		}, currency: "EUR", amount: 300, wantErr: "account monthly"},
+		{name: "last month is another month", history: []movement{
+			debit(time.Date(2026, 2, 28, 23, 59, 0, 0, time.UTC), "EUR", 1600),
+			debit(time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC), "EUR", 1600),
+			debit(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), "EUR", 1600),
+		}, currency: "EUR", amount: 300},
+
+		{name: "rolling hour", history: []movement{
+			debit(noon.Add(-50*time.Minute), "EUR", 10), debit(noon.Add(-30*time.Minute), "EUR", 10), debit(noon.Add(-10*time.Minute), "EUR", 10),
+		}, currency: "EUR", amount: 10, wantErr: "account allows 3 debits per hour"},
+		{name: "debits over an hour old", history: []movement{
+			debit(noon.Add(-61*time.Minute), "EUR", 10), debit(noon.Add(-30*time.Minute), "EUR", 10), debit(noon.Add(-10*time.Minute), "EUR", 10),
+		}, currency: "EUR", amount: 10},
+		{name: "rolling hour across the month start", now: time.Date(2026, 4, 1, 0, 20, 0, 0, time.UTC), history: []movement{
+			debit(time.Date(2026, 3, 31, 23, 30, 0, 0, time.UTC), "EUR", 10),
+			debit(time.Date(2026, 3, 31, 23, 50, 0, 0, time.UTC), "EUR", 10),
+			debit(time.Date(2026, 4, 1, 0, 10, 0, 0, time.UTC), "EUR", 10),
+		}, currency: "EUR", amount: 10, wantErr: "account allows 3 debits per hour"},
+
+		{name: "usage converted into the limits currency", history: []movement{debit(noon.Add(-2*time.Hour), "USD", 3000)},
+			currency: "USD", amount: 900},
+		{name: "converted usage over the limit", history: []movement{debit(noon.Add(-2*time.Hour), "USD", 3000)},
+			currency: "USD", amount: 1100, wantErr: "account daily"},
+		{name: "user usage across accounts", history: []movement{
+			debit(noon.Add(-2*time.Hour), "EUR", 1400), debit(noon.Add(-3*time.Hour), "USD", 2400),
+		}, currency: "EUR", amount: 500, wantErr: "user daily"},
+
+		{name: "account override", overrides: map[string]*limits.Override{"EUR": {Daily: float(100)}},
+			currency: "EUR", amount: 150, wantErr: "account daily limit is 100.00 EUR"},
+		{name: "override of another account", overrides: map[string]*limits.Override{"USD": {Daily: float(100)}},
+			currency: "EUR", amount: 150},
+		{name: "user override", overrides: map[string]*limits.Override{"": {HourlyCount: count(1)}},
+			history:  []movement{debit(noon.Add(-10*time.Minute), "USD", 10)},
+			currency: "EUR", amount: 10, wantErr: "user allows 1 debits per hour"},
+		{name: "user override below the account default", overrides: map[string]*limits.Override{"": {PerTransaction: float(200)}},
+			currency: "EUR", amount: 300, wantErr: "user per-transaction"},
+		{name: "override cannot raise the default", overrides: map[string]*limits.Override{"EUR": {Daily: float(5000)}},
+			history:  []movement{debit(noon.Add(-2*time.Hour), "EUR", 1500)},
+			currency: "EUR", amount: 600, wantErr: "account daily limit is 2000.00 EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			ctx := context.Background()
+			f.record(t, tt.history...)
+			for cur, override := range tt.overrides {
+				var accountID string
+				if cur != "" {
+					accountID = f.accounts[cur].ID
+				}
+				if err := f.store.SaveOverride(ctx, f.userID, accountID, override); err != nil {
+					t.Fatalf("SaveOverride: %v", err)
+				}
+			}
+
+			now := tt.now
+			if now.IsZero() {
+				now = noon
+			}
+			f.clock.Set(now)
+			err := f.store.WithinTx(ctx, func(ctx context.Context) error {
+				return f.engine.CheckDebit(ctx, f.accounts[tt.currency], tt.amount)
+			})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CheckDebit(%.2f %s) = %v, want allowed", tt.amount, tt.currency, err)
+			case tt.wantErr != "" && !errors.Is(err, transactions.ErrLimitExceeded):
+				t.Errorf("CheckDebit(%.2f %s) = %v, want ErrLimitExceeded", tt.amount, tt.currency, err)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), ": "+tt.wantErr):
+				t.Errorf("CheckDebit(%.2f %s) = %v, want %s", tt.amount, tt.currency, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestGetLimits reports the usage of each window, converted into the limits
+// currency, for the user and for each account.
+func TestGetLimits(t *testing.T) {
+	f := newFixture(t)
+	noon := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	f.record(t,
+		debit(time.Date(2026, 2, 27, 9, 0, 0, 0, time.UTC), "EUR", 400),
+		debit(time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC), "EUR", 200),
+		movement{noon.Add(-2 * time.Hour), "USD", transactions.TypeTransferOut, 300},
+		debit(noon.Add(-10*time.Minute), "EUR", 100),
+		movement{noon.Add(-5 * time.Minute), "EUR", transactions.TypeDeposit, 1000},
+	)
+	if err := f.store.SaveOverride(context.Background(), f.userID, f.accounts["USD"].ID, &limits.Override{Monthly: float(1000)}); err != nil {
+		t.Fatalf("SaveOverride: %v", err)
+	}
+	f.clock.Set(noon)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/limits", nil)
+	f.engine.GetLimitsHandler(w, r.WithContext(context.WithValue(r.Context(), "userID", f.userID)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /limits = %d %s", w.Code, w.Body)
+	}
+	var response limits.LimitsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]limits.Status{
+		"user": {
+			Limits:    limits.Limits(cfg.User),
+			Used:      limits.Usage{Daily: 250, Monthly: 450, HourlyCount: 1},
+			Remaining: limits.Remaining{Daily: 2750, Monthly: 7550, HourlyCount: 4},
+		},
+		f.accounts["EUR"].AccountNumber: {
+			AccountNumber: f.accounts["EUR"].AccountNumber,
+			Limits:        limits.Limits(cfg.Account),
+			Used:          limits.Usage{Daily: 100, Monthly: 300, HourlyCount: 1},
+			Remaining:     limits.Remaining{Daily: 1900, Monthly: 4700, HourlyCount: 2},
+		},
+		f.accounts["USD"].AccountNumber: {
+			AccountNumber: f.accounts["USD"].AccountNumber,
+			Limits:        limits.Limits{PerTransaction: 1000, Daily: 2000, Monthly: 1000, HourlyCount: 3},
+			Used:          limits.Usage{Daily: 150, Monthly: 150},
+			Remaining:     limits.Remaining{Daily: 1850, Monthly: 850, HourlyCount: 3},
+		},
+	}
+	got := map[string]limits.Status{}
+	if response.User != nil {
+		got["user"] = *response.User
+	}
+	for _, s := range response.Accounts {
+		got[s.AccountNumber] = *s
+	}
+	if response.Currency != "EUR" || len(got) != len(want) {
+		t.Fatalf("GET /limits = %+v, want the user and both accounts in EUR", response)
+	}
+	for scope, w := range want {
+		if got[scope] != w {
+			t.Errorf("%s: %+v, want %+v", scope, got[scope], w)
+		}
+	}
+}
@@ -1,33 +1,74 @@
 package main
 
 import (
-	"banking-backend/account"
 	"banking-backend/auth"
-	"banking-backend/currency"
-	"banking-backend/transactions"
-	"database/sql"
+	"banking-backend/clock"
+	"banking-backend/config"
+	"banking-backend/db/migrations"
+	"banking-backend/metrics"
+	"banking-backend/server"
+	"banking-backend/tracing"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	// Get database connection details from environment variables
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		os.Getenv("DATABASE_HOST"), 5432, os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DB"))
-
-	// Open a connection to the database
-	db, err := sql.Open("postgres", psqlInfo)
+	// Log as JSON; the standard logger goes through the same handler
+	slog.SetDefault(auth.NewLogger(os.Stdout))
+
+	// Load the configuration from the optional YAML file and the environment
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path of a YAML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		if err := yaml.NewEncoder(os.Stdout).Encode(cfg.Redacted()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	slog.Info("effective configuration", "config", cfg.Redacted())
+	for _, warning := range cfg.Warnings() {
+		slog.Warn(warning)
+	}
+
+	// Export traces as configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("could not flush traces: %v", err)
+		}
+	}()
+
+	// Open a connection pool to the database; queries are traced
+	db, err := tracing.OpenDB("postgres", cfg.Database.DSN())
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
 
 	// Ping the database to verify the connection
 	err = db.Ping()
@@ -37,67 +78,71 @@ func main() {
 
 	fmt.Println("Successfully connected to the database!")
 
-	// Create the auth environment
-	authEnv := &auth.Env{DB: db}
-	accountEnv := &account.Env{DB: db}
-	transactionsEnv := &transactions.Env{DB: db}
-
-	// Create a new rate limiter
-	rateLimiter := auth.NewRateLimiter()
-
-	// Create a new ServeMux
-	mux := http.NewServeMux()
-
-	// Define handlers
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Welcome to the Banking System!")
-	})
-
-	// Auth routes
-	mux.Handle("/signup", auth.ValidateSignupRequest(http.HandlerFunc(authEnv.SignupHandler)))
-	mux.Handle("/login", rateLimiter.Middleware(http.HandlerFunc(authEnv.LoginHandler)))
-	mux.Handle("/change-password", auth.AuthenticationMiddleware(http.HandlerFunc(authEnv.ChangePasswordHandler)))
-	mux.Handle("/refresh", http.HandlerFunc(authEnv.RefreshHandler))
-	mux.Handle("/status", auth.AuthenticationMiddleware(http.HandlerFunc(authEnv.StatusHandler)))
-	mux.Handle("/user", auth.AuthenticationMiddleware(http.HandlerFunc(authEnv.GetUserHandler)))
-
-	// Account routes
-	mux.Handle("/accounts", auth.AuthenticationMiddleware(http.HandlerFunc(accountEnv.GetAccountsHandler)))
-	mux.Handle("/create-account", auth.AuthenticationMiddleware(http.HandlerFunc(accountEnv.CreateAccountHandler)))
-
-	// Transactions routes
-	mux.Handle("/deposit", auth.AuthenticationMiddleware(http.HandlerFunc(transactionsEnv.DepositHandler)))
-
-	// Currency conversion route
-	mux.HandleFunc("/convert", func(w http.ResponseWriter, r *http.Request) {
-		from := r.URL.Query().Get("from")
-		to := r.URL.Query().Get("to")
-		amountStr := r.URL.Query().Get("amount")
-
-		if from == "" || to == "" || amountStr == "" {
-			http.Error(w, "Missing required query parameters: from, to, amount", http.StatusBadRequest)
-			return
+	// "migrate up|down|status" manages the schema and exits; otherwise pending
+	// migrations are applied at startup unless disabled
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) == "migrate" {
+		if err := migrator.Command(context.Background(), flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
 		}
-
-		amount, err := strconv.ParseFloat(amountStr, 64)
+		return
+	}
+	if cfg.Database.AutoMigrate {
+		applied, err := migrator.Up(context.Background())
 		if err != nil {
-			http.Error(w, "Invalid amount", http.StatusBadRequest)
-			return
+			log.Fatal(err)
 		}
-
-		rate, err := currency.GetRate(from, to)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get exchange rate: %v", err), http.StatusInternalServerError)
-			return
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
 		}
+	}
 
-		convertedAmount := amount * rate
-		fmt.Fprintf(w, "%.2f %s is %.2f %s", amount, from, convertedAmount, to)
-	})
+	// Export the connection pool stats
+	if err := metrics.RegisterDB(db, "banking"); err != nil {
+		log.Fatal(err)
+	}
 
-	// Start the HTTP server
-	log.Println("Starting server on :8080")
-	if err := http.ListenAndServe(":8080", auth.Logger(mux)); err != nil {
+	// Wire the API and its background jobs on Postgres
+	api, err := newApp(cfg, db, clock.System{})
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	// SIGINT and SIGTERM start a graceful shutdown; a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	workers := server.NewWorkers(ctx)
+
+	// Start the interest accrual job and the standing order scheduler
+	workers.Go(func(ctx context.Context) { api.Interest.Run(ctx, time.Hour) })
+	workers.Go(func(ctx context.Context) { api.Scheduler.Run(ctx, time.Minute) })
+
+	// Serve the metrics on the admin listener until the process exits, so
+	// they can still be scraped while the API drains
+	if cfg.HTTP.MetricsAddr != "" {
+		admin := server.New(cfg.HTTP, api.adminRoutes())
+		admin.Addr = cfg.HTTP.MetricsAddr
+		go func() {
+			log.Printf("Serving metrics on %s", admin.Addr)
+			if err := admin.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("admin server: %v", err)
+			}
+		}()
+		defer admin.Close()
+	}
+
+	// Start the HTTP server
+	srv := server.New(cfg.HTTP, api.routes())
+
+	// Serve until a signal arrives, then drain requests and stop the workers
+	// within one shutdown timeout, and let the deferred calls flush traces and
+	// close the database pool
+	log.Printf("Starting server on %s", cfg.HTTP.Addr)
+	if err := server.Run(ctx, srv, cfg.HTTP, workers, api.Health.Shutdown); err != nil {
+		log.Printf("server: %v", err)
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"banking-backend/server"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// --- Metrics ---
+
+const namespace = "banking"
+
+// Login results.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	rateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter by policy.",
+	}, []string{"policy"})
+
+	deposits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deposits_total",
+		Help:      "Successful deposits by currency.",
+	}, []string{"currency"})
+
+	depositVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deposit_volume_total",
+		Help:      "Amount deposited by currency, in units of that currency.",
+	}, []string{"currency"})
+
+	fxDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fx_request_duration_seconds",
+		Help:      "Latency of requests to the FX rate provider by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	fxErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fx_request_errors_total",
+		Help:      "Failed requests to the FX rate provider by endpoint.",
+	}, []string{"endpoint"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exports the connection pool stats of db.
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+func ObserveLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
+
+func ObserveRateLimitRejection(policy string) {
+	rateLimitRejections.WithLabelValues(policy).Inc()
+}
+
+func ObserveDeposit(currency string, amount float64) {
+	deposits.WithLabelValues(currency).Inc()
+	depositVolume.WithLabelValues(currency).Add(amount)
+}
+
+// ObserveFXRequest records a request to the rate provider that started at
+// start and failed when err is not nil.
+func ObserveFXRequest(endpoint string, start time.Time, err error) {
+	fxDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		fxErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// --- Middleware ---
+
+// Instrument counts and times the requests served by mux. Routes are labelled
+// with the pattern they matched, so path values do not multiply the series;
+// requests that match no route are labelled "unmatched".
+func Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &server.StatusWriter{ResponseWriter: w}
+
+		// The mux records the matched pattern on the request it is given
+		mux.ServeHTTP(sw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(sw.StatusCode())
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"banking-backend/auth"
+)
+
+// --- Models ---
+
+type Notification struct {
+	ID        int       `json:"id"`
+	UserID    string    `json:"-"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notifier delivers messages to users.
+type Notifier interface {
+	Notify(ctx context.Context, userID, subject, body string) error
+}
+
+// CodeSender delivers one-time codes out of band (email or SMS), never
+// through the inbox, which anyone holding the user's session can read.
+type CodeSender interface {
+	SendCode(ctx context.Context, userID, purpose, code string) error
+}
+
+// LogCodeSender writes codes to the server log. It stands in for an email or
+// SMS gateway in development.
+type LogCodeSender struct{}
+
+func (LogCodeSender) SendCode(ctx context.Context, userID, purpose, code string) error {
+	auth.LoggerFromContext(ctx).Info("one-time code", "recipient", userID, "purpose", purpose, "code", code)
+	return nil
+}
+
+// LogNotifier writes notifications to the server log. It stands in for the
+// inbox when there is no database.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, userID, subject, body string) error {
+	auth.LoggerFromContext(ctx).Info("notification", "recipient", userID, "subject", subject, "body", body)
+	return nil
+}
+
+// --- Database ---
+
+// Store keeps notifications in the user's inbox (the notifications table).
+type Store struct {
+	DB *sql.DB
+}
+
+func (s *Store) Notify(ctx context.Context, userID, subject, body string) error {
+	query := `INSERT INTO notifications (user_id, subject, body) VALUES ($1, $2, $3)`
+	if _, err := s.DB.ExecContext(ctx, query, userID, subject, body); err != nil {
+		return fmt.Errorf("could not create notification: %w", err)
+	}
+	auth.LoggerFromContext(ctx).Info("notification", "recipient", userID, "subject", subject)
+	return nil
+}
+
+func (s *Store) GetByUserID(ctx context.Context, userID string, limit int) ([]*Notification, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, user_id, subject, body, created_at FROM notifications
+				   WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Subject, &n.Body, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// --- Handlers ---
+
+type Env struct {
+	Store *Store
+}
+
+func (env *Env) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	notifications, err := env.Store.GetByUserID(r.Context(), userID, 50)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get notifications")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, notifications)
+}
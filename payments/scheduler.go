@@ -0,0 +1,204 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"banking-backend/account"
+	"banking-backend/beneficiaries"
+	"banking-backend/clock"
+	"banking-backend/currency"
+	"banking-backend/notifications"
+	"banking-backend/transactions"
+)
+
+// --- Scheduler ---
+
+// Scheduler executes due standing orders as transfers. Failed attempts are
+// retried every RetryDelay up to MaxAttempts times, after which the
+// occurrence is skipped. Orders whose accounts or beneficiaries disappeared
+// are cancelled. After downtime an overdue order is paid once and the
+// occurrences missed meanwhile are skipped.
+type Scheduler struct {
+	Orders       Repository
+	Transactions *transactions.Env
+	Notifier     notifications.Notifier
+	Clock        clock.Clock
+	MaxAttempts  int
+	RetryDelay   time.Duration
+	BatchSize    int
+}
+
+func NewScheduler(orders Repository, transactionsEnv *transactions.Env, notifier notifications.Notifier, c clock.Clock) *Scheduler {
+	return &Scheduler{
+		Orders:       orders,
+		Transactions: transactionsEnv,
+		Notifier:     notifier,
+		Clock:        c,
+		MaxAttempts:  3,
+		RetryDelay:   time.Hour,
+		BatchSize:    100,
+	}
+}
+
+// Run executes RunOnce every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "standing order run failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts every due standing order once.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	now := s.Clock.Now()
+
+	orders, err := s.Orders.GetDueStandingOrders(ctx, now, s.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.execute(ctx, order, now); err != nil {
+			slog.ErrorContext(ctx, "could not execute standing order", "order_id", order.ID, "user_id", order.UserID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) execute(ctx context.Context, order *StandingOrder, now time.Time) error {
+	// Lease the attempt before transferring so no other replica picks it up
+	claimed, err := s.Orders.ClaimStandingOrder(ctx, order, now.Add(s.RetryDelay))
+	if err != nil || !claimed {
+		return err
+	}
+
+	// The transfer and the move to the next occurrence commit together, so an
+	// interrupted run either pays and advances or leaves the lease to expire
+	var transferErr error
+	err = s.Transactions.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		// Edits, pauses and cancellations made since the claim win
+		current, err := s.Orders.GetStandingOrderForUpdate(ctx, order.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil || !current.UpdatedAt.Equal(order.UpdatedAt) {
+			return ErrStandingOrderChanged
+		}
+
+		_, transferErr = s.Transactions.Transfer(ctx, order.UserID, transactions.TransferRequest{
+			FromAccountNumber: order.FromAccountNumber,
+			ToAccountNumber:   order.ToAccountNumber,
+			Amount:            order.Amount,
+			Description:       "Standing order " + order.ID,
+		})
+		if transferErr != nil {
+			return transferErr
+		}
+
+		order.LastRunAt = &now
+		order.LastError = ""
+		s.advance(order, now)
+		return s.Orders.RecordStandingOrderRun(ctx, order)
+	})
+	switch {
+	case err == nil:
+		s.notify(ctx, order, "Standing order executed",
+			fmt.Sprintf("%s was transferred from %s to %s.", s.formatAmount(ctx, order), order.FromAccountNumber, order.ToAccountNumber))
+		return nil
+	case errors.Is(err, ErrStandingOrderChanged):
+		return nil
+	case transferErr == nil:
+		// Nothing was paid; the attempt is retried once the lease expires
+		return err
+	}
+
+	// The transfer was rolled back; record the failed attempt
+	order.LastRunAt = &now
+	order.LastError = transferErr.Error()
+	var subject, body string
+	switch {
+	case errors.Is(transferErr, transactions.ErrAccountNotFound),
+		errors.Is(transferErr, transactions.ErrAccountNotOwned),
+		errors.Is(transferErr, transactions.ErrSameAccount),
+		errors.Is(transferErr, beneficiaries.ErrPayeeRequired):
+		order.Status = StatusCancelled
+		subject = "Standing order cancelled"
+		body = fmt.Sprintf("Your standing order to %s was cancelled: %v.", order.ToAccountNumber, transferErr)
+
+	default:
+		order.Attempts++
+		if order.Attempts >= s.MaxAttempts {
+			s.advance(order, now)
+			subject = "Standing order skipped"
+			body = fmt.Sprintf("The payment of %s to %s failed %d times (%v) and was skipped. Next payment: %s.",
+				s.formatAmount(ctx, order), order.ToAccountNumber, s.MaxAttempts, transferErr, order.ScheduledFor.Format(time.DateOnly))
+		} else {
+			order.NextRunAt = now.Add(s.RetryDelay)
+			switch {
+			case errors.Is(transferErr, account.ErrInsufficientFunds):
+				subject = "Insufficient funds for standing order"
+				body = fmt.Sprintf("The payment of %s to %s could not be made due to insufficient funds. It will be retried at %s.",
+					s.formatAmount(ctx, order), order.ToAccountNumber, order.NextRunAt.Format(time.RFC3339))
+			case errors.Is(transferErr, transactions.ErrLimitExceeded):
+				subject = "Spending limit reached for standing order"
+				body = fmt.Sprintf("The payment of %s to %s could not be made (%v). It will be retried at %s.",
+					s.formatAmount(ctx, order), order.ToAccountNumber, transferErr, order.NextRunAt.Format(time.RFC3339))
+			}
+		}
+	}
+
+	if err := s.Orders.RecordStandingOrderRun(ctx, order); err != nil {
+		if errors.Is(err, ErrStandingOrderChanged) {
+			return nil
+		}
+		return err
+	}
+	if subject != "" {
+		s.notify(ctx, order, subject, body)
+	}
+	return nil
+}
+
+// advance moves the order to its next occurrence after today, skipping any
+// that passed while the order was overdue.
+func (s *Scheduler) advance(order *StandingOrder, now time.Time) {
+	order.ScheduledFor = nextOccurrence(order.Frequency, order.Day, order.ScheduledFor)
+	if tomorrow := truncateToDay(now).AddDate(0, 0, 1); order.ScheduledFor.Before(tomorrow) {
+		order.ScheduledFor = firstOccurrence(order.Frequency, order.Day, tomorrow)
+	}
+	order.NextRunAt = order.ScheduledFor
+	order.Attempts = 0
+}
+
+// formatAmount renders the amount of the order in the currency of its source
+// account, which may no longer exist.
+func (s *Scheduler) formatAmount(ctx context.Context, order *StandingOrder) string {
+	var code string
+	if acc, err := s.Transactions.Accounts.GetAccountByAccountNumber(ctx, order.FromAccountNumber); err == nil && acc != nil {
+		code = acc.Currency
+	}
+	return currency.Format(order.Amount, code)
+}
+
+func (s *Scheduler) notify(ctx context.Context, order *StandingOrder, subject, body string) {
+	if err := s.Notifier.Notify(ctx, order.UserID, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not notify standing order outcome", "order_id", order.ID, "user_id", order.UserID, "error", err)
+	}
+}
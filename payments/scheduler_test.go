@@ -0,0 +1,255 @@
+package payments_test
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/payments"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+const (
+	checking = "ES0000000000000000000001"
+	savings  = "ES0000000000000000000002"
+)
+
+// inbox records the subjects of the notifications sent.
+type inbox struct {
+	subjects []string
+}
+
+func (n *inbox) Notify(ctx context.Context, userID, subject, body string) error {
+	n.subjects = append(n.subjects, subject)
+	return nil
+}
+
+// last returns the subject of the last notification, if any was sent since
+// the previous call.
+func (n *inbox) last() string {
+	if len(n.subjects) == 0 {
+		return ""
+	}
+	subject := n.subjects[len(n.subjects)-1]
+	n.subjects = nil
+	return subject
+}
+
+type fixture struct {
+	*memory.Store
+	Clock     *clock.Fixed
+	Ledger    *transactions.Env
+	Scheduler *payments.Scheduler
+	Inbox     *inbox
+	UserID    string
+}
+
+// newFixture returns a scheduler on the memory store, with one user holding
+// a checking account with 1000 EUR and an empty savings account.
+func newFixture(t *testing.T, now time.Time) *fixture {
+	t.Helper()
+	f := &fixture{Store: memory.New(), Clock: clock.NewFixed(now), Inbox: &inbox{}}
+	f.Store.Clock = f.Clock
+	f.Ledger = &transactions.Env{Tx: f.Store, Clock: f.Clock, Accounts: f.Store, Transactions: f.Store}
+	f.Scheduler = payments.NewScheduler(f.Store, f.Ledger, f.Inbox, f.Clock)
+	f.UserID = f.newUser(t, "12345678Z", checking, savings)
+
+	if _, err := f.Ledger.Deposit(context.Background(), f.UserID, transactions.DepositRequest{AccountNumber: checking, Amount: 1000}); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	return f
+}
+
+func (f *fixture) newUser(t *testing.T, dni string, accountNumbers ...string) string {
+	t.Helper()
+	ctx := context.Background()
+	userID, err := f.CreateUser(ctx, &auth.User{DNI: dni, FullName: "Ada Lovelace", Email: dni + "@example.com"}, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, accountNumber := range accountNumbers {
+		accountType := account.TypeChecking
+		if accountNumber == savings {
+			accountType = account.TypeSavings
+		}
+		acc := &account.Account{UserID: userID, AccountNumber: accountNumber, Currency: "EUR", AccountType: accountType}
+		if _, err := f.CreateAccount(ctx, acc); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+	return userID
+}
+
+// newOrder saves an active order from checking to to, due on scheduledFor.
+func (f *fixture) newOrder(t *testing.T, to string, amount float64, frequency string, day int, scheduledFor time.Time) *payments.StandingOrder {
+	t.Helper()
+	order := &payments.StandingOrder{
+		UserID: f.UserID, FromAccountNumber: checking, ToAccountNumber: to, Amount: amount,
+		Frequency: frequency, Day: day, Status: payments.StatusActive, ScheduledFor: scheduledFor, NextRunAt: scheduledFor,
+	}
+	if err := f.CreateStandingOrder(context.Background(), order); err != nil {
+		t.Fatalf("CreateStandingOrder: %v", err)
+	}
+	return order
+}
+
+// run runs the scheduler at now and returns the order as stored.
+func (f *fixture) run(t *testing.T, now time.Time, order *payments.StandingOrder) *payments.StandingOrder {
+	t.Helper()
+	f.Clock.Set(now)
+	if err := f.Scheduler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	stored, err := f.GetStandingOrder(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("GetStandingOrder: %v", err)
+	}
+	return stored
+}
+
+func (f *fixture) balance(t *testing.T, accountNumber string) float64 {
+	t.Helper()
+	acc, err := f.GetAccountByAccountNumber(context.Background(), accountNumber)
+	if err != nil {
+		t.Fatalf("GetAccountByAccountNumber: %v", err)
+	}
+	return acc.Balance
+}
+
+func at(day string, hour int) time.Time {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(time.Duration(hour) * time.Hour)
+}
+
+// TestSchedulerRetriesThenSkips fails an order for lack of funds until it is
+// skipped, then pays the next occurrence once funded.
+func TestSchedulerRetriesThenSkips(t *testing.T) {
+	f := newFixture(t, at("2026-03-31", 9))
+	order := f.newOrder(t, savings, 2000, payments.FrequencyMonthly, 31, at("2026-03-31", 0))
+
+	steps := []struct {
+		name         string
+		now          time.Time
+		attempts     int
+		scheduledFor time.Time
+		nextRunAt    time.Time
+		notification string
+	}{
+		{"first attempt", at("2026-03-31", 9), 1, at("2026-03-31", 0), at("2026-03-31", 10), "Insufficient funds for standing order"},
+		{"retry not due yet", at("2026-03-31", 9).Add(30 * time.Minute), 1, at("2026-03-31", 0), at("2026-03-31", 10), ""},
+		{"second attempt", at("2026-03-31", 10), 2, at("2026-03-31", 0), at("2026-03-31", 11), "Insufficient funds for standing order"},
+		{"skipped to April 30", at("2026-03-31", 11), 0, at("2026-04-30", 0), at("2026-04-30", 0), "Standing order skipped"},
+		{"nothing due before April 30", at("2026-04-29", 23), 0, at("2026-04-30", 0), at("2026-04-30", 0), ""},
+	}
+	for _, step := range steps {
+		stored := f.run(t, step.now, order)
+		if stored.Status != payments.StatusActive || stored.Attempts != step.attempts ||
+			!stored.ScheduledFor.Equal(step.scheduledFor) || !stored.NextRunAt.Equal(step.nextRunAt) {
+			t.Errorf("%s: order is %s with %d attempts for %s, next run %s; want active with %d attempts for %s, next run %s",
+				step.name, stored.Status, stored.Attempts, stored.ScheduledFor, stored.NextRunAt, step.attempts, step.scheduledFor, step.nextRunAt)
+		}
+		if step.attempts > 0 && stored.LastError == "" {
+			t.Errorf("%s: the failed attempt left no error", step.name)
+		}
+		if got := f.Inbox.last(); got != step.notification {
+			t.Errorf("%s: notified %q, want %q", step.name, got, step.notification)
+		}
+	}
+	if got := f.balance(t, checking); got != 1000 {
+		t.Errorf("balance after the failed attempts = %.2f, want 1000", got)
+	}
+
+	if _, err := f.Ledger.Deposit(context.Background(), f.UserID, transactions.DepositRequest{AccountNumber: checking, Amount: 1500}); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	stored := f.run(t, at("2026-04-30", 8), order)
+	if !stored.ScheduledFor.Equal(at("2026-05-31", 0)) || stored.Attempts != 0 || stored.LastError != "" {
+		t.Errorf("paid order is for %s with %d attempts and error %q, want May 31 with none", stored.ScheduledFor, stored.Attempts, stored.LastError)
+	}
+	if got := f.Inbox.last(); got != "Standing order executed" {
+		t.Errorf("notified %q after paying, want the execution", got)
+	}
+	if got := f.balance(t, savings); got != 2000 {
+		t.Errorf("savings balance = %.2f, want 2000", got)
+	}
+}
+
+func TestSchedulerCancels(t *testing.T) {
+	tests := []struct {
+		name string
+		to   func(t *testing.T, f *fixture) string
+	}{
+		{"missing destination", func(t *testing.T, f *fixture) string { return "ES0000000000000000000099" }},
+		{"destination of another user without payees", func(t *testing.T, f *fixture) string {
+			f.newUser(t, "87654321X", "ES0000000000000000000003")
+			return "ES0000000000000000000003"
+		}},
+		{"own source account", func(t *testing.T, f *fixture) string { return checking }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, at("2026-03-10", 9))
+			order := f.newOrder(t, tt.to(t, f), 100, payments.FrequencyWeekly, 2, at("2026-03-10", 0))
+
+			stored := f.run(t, at("2026-03-10", 9), order)
+			if stored.Status != payments.StatusCancelled || stored.LastError == "" {
+				t.Errorf("order is %s with error %q, want cancelled with the error", stored.Status, stored.LastError)
+			}
+			if got := f.Inbox.last(); got != "Standing order cancelled" {
+				t.Errorf("notified %q, want the cancellation", got)
+			}
+
+			// Cancelled orders are never attempted again
+			f.run(t, at("2026-03-17", 9), order)
+			if got := f.Inbox.last(); got != "" {
+				t.Errorf("notified %q after the cancellation", got)
+			}
+			if got := f.balance(t, checking); got != 1000 {
+				t.Errorf("balance = %.2f, want 1000", got)
+			}
+		})
+	}
+}
+
+// TestSchedulerAfterDowntime pays an overdue order once and moves it to its
+// next occurrence after the day it ran.
+func TestSchedulerAfterDowntime(t *testing.T) {
+	tests := []struct {
+		name         string
+		frequency    string
+		day          int
+		scheduledFor time.Time
+		now          time.Time
+		want         time.Time
+	}{
+		{"on time", payments.FrequencyMonthly, 31, at("2026-01-31", 0), at("2026-01-31", 9), at("2026-02-28", 0)},
+		{"late within the period", payments.FrequencyMonthly, 31, at("2026-01-31", 0), at("2026-02-10", 9), at("2026-02-28", 0)},
+		{"monthly after missed months", payments.FrequencyMonthly, 1, at("2026-01-01", 0), at("2026-03-15", 9), at("2026-04-01", 0)},
+		{"back on an occurrence day", payments.FrequencyMonthly, 1, at("2026-02-01", 0), at("2026-03-01", 9), at("2026-04-01", 0)},
+		{"over the new year", payments.FrequencyMonthly, 31, at("2026-11-30", 0), at("2027-01-05", 9), at("2027-01-31", 0)},
+		{"weekly after missed weeks", payments.FrequencyWeekly, 2, at("2026-03-03", 0), at("2026-03-19", 9), at("2026-03-24", 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, tt.now)
+			order := f.newOrder(t, savings, 100, tt.frequency, tt.day, tt.scheduledFor)
+
+			// The second run finds the order no longer due
+			f.run(t, tt.now, order)
+			stored := f.run(t, tt.now, order)
+			if !stored.ScheduledFor.Equal(tt.want) || !stored.NextRunAt.Equal(tt.want) {
+				t.Errorf("next occurrence = %s, want %s", stored.ScheduledFor.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+			if got := f.balance(t, savings); math.Abs(got-100) > 1e-9 {
+				t.Errorf("savings balance = %.2f, want one payment of 100", got)
+			}
+		})
+	}
+}
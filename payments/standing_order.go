@@ -0,0 +1,560 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/clock"
+	"banking-backend/store"
+	"banking-backend/transactions"
+)
+
+// --- Models ---
+
+const (
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+)
+
+// StandingOrder is a recurring transfer. Day is the weekday (0 = Sunday) for
+// weekly orders and the day of the month for monthly ones; months shorter
+// than Day run on their last day.
+type StandingOrder struct {
+	ID                string     `json:"id"`
+	UserID            string     `json:"-"`
+	FromAccountNumber string     `json:"from_account_number"`
+	ToAccountNumber   string     `json:"to_account_number"`
+	Amount            float64    `json:"amount"`
+	Frequency         string     `json:"frequency"`
+	Day               int        `json:"day"`
+	Status            string     `json:"status"`
+	ScheduledFor      time.Time  `json:"scheduled_for"` // Current occurrence
+	NextRunAt         time.Time  `json:"next_run_at"`   // Next attempt, later than ScheduledFor while retrying
+	Attempts          int        `json:"attempts"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastRunAt         *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type StandingOrderRequest struct {
+	FromAccountNumber string  `json:"from_account_number"`
+	ToAccountNumber   string  `json:"to_account_number"`
+	Amount            float64 `json:"amount"`
+	Frequency         string  `json:"frequency"`
+	Day               int     `json:"day"`
+	StartDate         string  `json:"start_date,omitempty"` // YYYY-MM-DD, defaults to today
+}
+
+// UpdateStandingOrderRequest edits an order; omitted fields are kept.
+type UpdateStandingOrderRequest struct {
+	ToAccountNumber *string  `json:"to_account_number"`
+	Amount          *float64 `json:"amount"`
+	Frequency       *string  `json:"frequency"`
+	Day             *int     `json:"day"`
+}
+
+var (
+	ErrStandingOrderNotFound = errors.New("standing order not found")
+	ErrInvalidSchedule       = errors.New("invalid schedule")
+	ErrOrderCancelled        = errors.New("standing order is cancelled")
+	ErrStandingOrderChanged  = errors.New("standing order was changed by another request, please retry")
+)
+
+// --- Schedule ---
+
+func validateSchedule(frequency string, day int) error {
+	switch frequency {
+	case FrequencyWeekly:
+		if day < 0 || day > 6 {
+			return fmt.Errorf("%w: weekly day must be between 0 (Sunday) and 6", ErrInvalidSchedule)
+		}
+	case FrequencyMonthly:
+		if day < 1 || day > 31 {
+			return fmt.Errorf("%w: monthly day must be between 1 and 31", ErrInvalidSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: frequency must be %q or %q", ErrInvalidSchedule, FrequencyWeekly, FrequencyMonthly)
+	}
+	return nil
+}
+
+// firstOccurrence returns the first run date on or after from.
+func firstOccurrence(frequency string, day int, from time.Time) time.Time {
+	from = truncateToDay(from)
+	if frequency == FrequencyWeekly {
+		return from.AddDate(0, 0, (day-int(from.Weekday())+7)%7)
+	}
+
+	candidate := monthlyDate(from.Year(), from.Month(), day)
+	if candidate.Before(from) {
+		candidate = monthlyDate(from.Year(), from.Month()+1, day)
+	}
+	return candidate
+}
+
+// nextOccurrence returns the run date following occurrence.
+func nextOccurrence(frequency string, day int, occurrence time.Time) time.Time {
+	if frequency == FrequencyWeekly {
+		return truncateToDay(occurrence).AddDate(0, 0, 7)
+	}
+	return monthlyDate(occurrence.Year(), occurrence.Month()+1, day)
+}
+
+// monthlyDate clamps day to the length of the month.
+func monthlyDate(year int, month time.Month, day int) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// --- Database ---
+
+// Repository stores the standing orders.
+type Repository interface {
+	CreateStandingOrder(ctx context.Context, o *StandingOrder) error
+	GetStandingOrder(ctx context.Context, id string) (*StandingOrder, error) // nil, nil when missing
+	GetStandingOrdersByUserID(ctx context.Context, userID string) ([]*StandingOrder, error)
+	GetDueStandingOrders(ctx context.Context, now time.Time, limit int) ([]*StandingOrder, error)
+	GetStandingOrderForUpdate(ctx context.Context, id string) (*StandingOrder, error)
+	UpdateStandingOrderTerms(ctx context.Context, o *StandingOrder, reschedule bool) error
+	UpdateStandingOrderStatus(ctx context.Context, o *StandingOrder, reschedule bool) error
+	RecordStandingOrderRun(ctx context.Context, o *StandingOrder) error
+	ClaimStandingOrder(ctx context.Context, o *StandingOrder, lease time.Time) (bool, error)
+}
+
+// DB is the Repository backed by Postgres.
+type DB struct {
+	*sql.DB
+}
+
+const standingOrderColumns = `id, user_id, from_account_number, to_account_number, amount, frequency, day, status,
+	scheduled_for, next_run_at, attempts, COALESCE(last_error, ''), last_run_at, created_at, updated_at`
+
+func scanStandingOrder(row interface{ Scan(...interface{}) error }) (*StandingOrder, error) {
+	o := &StandingOrder{}
+	err := row.Scan(&o.ID, &o.UserID, &o.FromAccountNumber, &o.ToAccountNumber, &o.Amount, &o.Frequency, &o.Day, &o.Status,
+		&o.ScheduledFor, &o.NextRunAt, &o.Attempts, &o.LastError, &o.LastRunAt, &o.CreatedAt, &o.UpdatedAt)
+	return o, err
+}
+
+func (db *DB) CreateStandingOrder(ctx context.Context, o *StandingOrder) error {
+	query := `INSERT INTO standing_orders (user_id, from_account_number, to_account_number, amount, frequency, day, status, scheduled_for, next_run_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+	err := db.QueryRowContext(ctx, query, o.UserID, o.FromAccountNumber, o.ToAccountNumber, o.Amount, o.Frequency, o.Day,
+		o.Status, o.ScheduledFor, o.NextRunAt).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("could not create standing order: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetStandingOrder(ctx context.Context, id string) (*StandingOrder, error) {
+	o, err := scanStandingOrder(db.QueryRowContext(ctx, `SELECT `+standingOrderColumns+` FROM standing_orders WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get standing order: %w", err)
+	}
+	return o, nil
+}
+
+func (db *DB) GetStandingOrdersByUserID(ctx context.Context, userID string) ([]*StandingOrder, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+standingOrderColumns+` FROM standing_orders
+				   WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get standing orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []*StandingOrder{}
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan standing order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating standing orders: %w", err)
+	}
+	return orders, nil
+}
+
+// GetDueStandingOrders returns the active orders whose next attempt is due.
+func (db *DB) GetDueStandingOrders(ctx context.Context, now time.Time, limit int) ([]*StandingOrder, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+standingOrderColumns+` FROM standing_orders
+				   WHERE status = $1 AND next_run_at <= $2 ORDER BY next_run_at LIMIT $3`, StatusActive, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get due standing orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*StandingOrder
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan standing order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating standing orders: %w", err)
+	}
+	return orders, nil
+}
+
+// GetStandingOrderForUpdate locks the order until the unit of work of ctx
+// ends. It returns nil, nil when the order does not exist.
+func (db *DB) GetStandingOrderForUpdate(ctx context.Context, id string) (*StandingOrder, error) {
+	o, err := scanStandingOrder(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+standingOrderColumns+` FROM standing_orders WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get standing order: %w", err)
+	}
+	return o, nil
+}
+
+// The updates below only write the columns their caller owns, and only if the
+// order is unchanged since o was read: they compare updated_at with
+// o.UpdatedAt, which they advance, and return ErrStandingOrderChanged when
+// another request or the scheduler got there first.
+
+// UpdateStandingOrderTerms saves the payee, amount and schedule set by the
+// user. The next run is only moved when reschedule is set.
+func (db *DB) UpdateStandingOrderTerms(ctx context.Context, o *StandingOrder, reschedule bool) error {
+	set := `to_account_number = $3, amount = $4, frequency = $5, day = $6`
+	args := []any{o.ID, o.UpdatedAt, o.ToAccountNumber, o.Amount, o.Frequency, o.Day}
+	if reschedule {
+		set += `, scheduled_for = $7, next_run_at = $8, attempts = 0`
+		args = append(args, o.ScheduledFor, o.NextRunAt)
+	}
+	return db.update(ctx, o, set, args...)
+}
+
+// UpdateStandingOrderStatus pauses, resumes or cancels the order, moving the
+// next run when reschedule is set.
+func (db *DB) UpdateStandingOrderStatus(ctx context.Context, o *StandingOrder, reschedule bool) error {
+	set := `status = $3`
+	args := []any{o.ID, o.UpdatedAt, o.Status}
+	if reschedule {
+		set += `, scheduled_for = $4, next_run_at = $5, attempts = 0`
+		args = append(args, o.ScheduledFor, o.NextRunAt)
+	}
+	return db.update(ctx, o, set, args...)
+}
+
+// RecordStandingOrderRun saves the outcome of an attempt made by the scheduler.
+func (db *DB) RecordStandingOrderRun(ctx context.Context, o *StandingOrder) error {
+	return db.update(ctx, o, `status = $3, scheduled_for = $4, next_run_at = $5, attempts = $6, last_error = NULLIF($7, ''), last_run_at = $8`,
+		o.ID, o.UpdatedAt, o.Status, o.ScheduledFor, o.NextRunAt, o.Attempts, o.LastError, o.LastRunAt)
+}
+
+func (db *DB) update(ctx context.Context, o *StandingOrder, set string, args ...any) error {
+	query := `UPDATE standing_orders SET ` + set + `, updated_at = NOW() WHERE id = $1 AND updated_at = $2 RETURNING updated_at`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, args...).Scan(&o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrStandingOrderChanged
+	}
+	if err != nil {
+		return fmt.Errorf("could not update standing order: %w", err)
+	}
+	return nil
+}
+
+// ClaimStandingOrder pushes next_run_at forward to lease, provided nobody
+// changed it since o was read, so that only one worker executes an attempt.
+// It advances o.UpdatedAt, so that edits made during the attempt are noticed.
+func (db *DB) ClaimStandingOrder(ctx context.Context, o *StandingOrder, lease time.Time) (bool, error) {
+	err := db.QueryRowContext(ctx, `UPDATE standing_orders SET next_run_at = $1, updated_at = NOW()
+				   WHERE id = $2 AND status = $3 AND next_run_at = $4 RETURNING updated_at`, lease, o.ID, StatusActive, o.NextRunAt).Scan(&o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not claim standing order: %w", err)
+	}
+	o.NextRunAt = lease
+	return true, nil
+}
+
+// --- Handlers ---
+
+type Env struct {
+	Orders   Repository
+	Accounts account.Repository
+	Payees   transactions.PayeeChecker // Optional; only own accounts can be paid when nil
+	Clock    clock.Clock
+}
+
+func (env *Env) CreateStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req StandingOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+	if err := validateSchedule(req.Frequency, req.Day); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	today := truncateToDay(env.Clock.Now())
+	start := today
+	if req.StartDate != "" {
+		start, err = time.Parse(time.DateOnly, req.StartDate)
+		if err != nil || start.Before(today) {
+			auth.RespondWithError(w, http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD not in the past")
+			return
+		}
+	}
+
+	req.FromAccountNumber = account.NormalizeIBAN(req.FromAccountNumber)
+	req.ToAccountNumber = account.NormalizeIBAN(req.ToAccountNumber)
+	if status, message := env.validateAccounts(r.Context(), userID, req.FromAccountNumber, req.ToAccountNumber); status != 0 {
+		auth.RespondWithError(w, status, message)
+		return
+	}
+
+	scheduledFor := firstOccurrence(req.Frequency, req.Day, start)
+	order := &StandingOrder{
+		UserID:            userID,
+		FromAccountNumber: req.FromAccountNumber,
+		ToAccountNumber:   req.ToAccountNumber,
+		Amount:            req.Amount,
+		Frequency:         req.Frequency,
+		Day:               req.Day,
+		Status:            StatusActive,
+		ScheduledFor:      scheduledFor,
+		NextRunAt:         scheduledFor,
+	}
+
+	if err := env.Orders.CreateStandingOrder(r.Context(), order); err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to create standing order")
+		return
+	}
+
+	auth.JSON(w, http.StatusCreated, order)
+}
+
+func (env *Env) GetStandingOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	orders, err := env.Orders.GetStandingOrdersByUserID(r.Context(), userID)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get standing orders")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, orders)
+}
+
+func (env *Env) GetStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := env.loadOwnedOrder(w, r)
+	if !ok {
+		return
+	}
+	auth.JSON(w, http.StatusOK, order)
+}
+
+func (env *Env) UpdateStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := env.loadOwnedOrder(w, r)
+	if !ok {
+		return
+	}
+	if order.Status == StatusCancelled {
+		auth.RespondWithError(w, http.StatusConflict, ErrOrderCancelled.Error())
+		return
+	}
+
+	var req UpdateStandingOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount != nil {
+		if *req.Amount <= 0 {
+			auth.RespondWithError(w, http.StatusBadRequest, "Amount must be positive")
+			return
+		}
+		order.Amount = *req.Amount
+	}
+	if req.ToAccountNumber != nil {
+		to := account.NormalizeIBAN(*req.ToAccountNumber)
+		if status, message := env.validateAccounts(r.Context(), order.UserID, order.FromAccountNumber, to); status != 0 {
+			auth.RespondWithError(w, status, message)
+			return
+		}
+		order.ToAccountNumber = to
+	}
+	reschedule := req.Frequency != nil || req.Day != nil
+	if reschedule {
+		if req.Frequency != nil {
+			order.Frequency = *req.Frequency
+		}
+		if req.Day != nil {
+			order.Day = *req.Day
+		}
+		if err := validateSchedule(order.Frequency, order.Day); err != nil {
+			auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		order.ScheduledFor = firstOccurrence(order.Frequency, order.Day, env.Clock.Now())
+		order.NextRunAt = order.ScheduledFor
+		order.Attempts = 0
+	}
+
+	if err := env.Orders.UpdateStandingOrderTerms(r.Context(), order, reschedule); err != nil {
+		respondWithUpdateError(w, r, err)
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, order)
+}
+
+func (env *Env) PauseStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	env.setStatus(w, r, StatusPaused)
+}
+
+func (env *Env) ResumeStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	env.setStatus(w, r, StatusActive)
+}
+
+func (env *Env) CancelStandingOrderHandler(w http.ResponseWriter, r *http.Request) {
+	env.setStatus(w, r, StatusCancelled)
+}
+
+func (env *Env) setStatus(w http.ResponseWriter, r *http.Request, status string) {
+	order, ok := env.loadOwnedOrder(w, r)
+	if !ok {
+		return
+	}
+	if order.Status == StatusCancelled {
+		auth.RespondWithError(w, http.StatusConflict, ErrOrderCancelled.Error())
+		return
+	}
+
+	// Resuming skips the occurrences missed while paused
+	reschedule := false
+	if status == StatusActive && order.Status == StatusPaused {
+		today := env.Clock.Now()
+		if order.ScheduledFor.Before(truncateToDay(today)) {
+			order.ScheduledFor = firstOccurrence(order.Frequency, order.Day, today)
+			order.NextRunAt = order.ScheduledFor
+			order.Attempts = 0
+			reschedule = true
+		}
+	}
+	order.Status = status
+
+	if err := env.Orders.UpdateStandingOrderStatus(r.Context(), order, reschedule); err != nil {
+		respondWithUpdateError(w, r, err)
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, order)
+}
+
+func respondWithUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrStandingOrderChanged) {
+		auth.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	auth.LoggerFromContext(r.Context()).Error("could not update standing order", "error", err)
+	auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update standing order")
+}
+
+// loadOwnedOrder loads the {id} order of the authenticated user, writing the
+// error response itself when it cannot.
+func (env *Env) loadOwnedOrder(w http.ResponseWriter, r *http.Request) (*StandingOrder, bool) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	order, err := env.Orders.GetStandingOrder(r.Context(), r.PathValue("id"))
+	if err != nil || order == nil || order.UserID != userID {
+		auth.RespondWithError(w, http.StatusNotFound, ErrStandingOrderNotFound.Error())
+		return nil, false
+	}
+	return order, true
+}
+
+// validateAccounts checks both account numbers and that the source account
+// belongs to the user. It returns a zero status when everything is valid.
+func (env *Env) validateAccounts(ctx context.Context, userID, from, to string) (int, string) {
+	for _, accountNumber := range []string{from, to} {
+		if err := account.ValidateIBAN(accountNumber); err != nil {
+			return http.StatusBadRequest, "Invalid account number: " + err.Error()
+		}
+	}
+	if from == to {
+		return http.StatusBadRequest, transactions.ErrSameAccount.Error()
+	}
+
+	source, err := env.Accounts.GetAccountByAccountNumber(ctx, from)
+	if err != nil || source == nil {
+		return http.StatusNotFound, "Account not found"
+	}
+	if source.UserID != userID {
+		return http.StatusUnauthorized, "Account does not belong to the user"
+	}
+
+	destination, err := env.Accounts.GetAccountByAccountNumber(ctx, to)
+	if err != nil || destination == nil {
+		return http.StatusNotFound, "Destination account not found"
+	}
+
+	// Payees still cooling off are accepted; the scheduler retries until they are active
+	if destination.UserID != userID {
+		if env.Payees == nil {
+			return http.StatusForbidden, beneficiaries.ErrPayeeRequired.Error()
+		}
+		err := env.Payees.CheckPayee(ctx, userID, to, env.Clock.Now())
+		if errors.Is(err, beneficiaries.ErrPayeeRequired) {
+			return http.StatusForbidden, err.Error()
+		}
+		if err != nil && !errors.Is(err, beneficiaries.ErrPayeeNotActive) {
+			return http.StatusInternalServerError, "Failed to check beneficiary"
+		}
+	}
+	return 0, ""
+}
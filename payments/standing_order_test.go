@@ -0,0 +1,93 @@
+package payments
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMonthlyDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		year  int
+		month time.Month
+		day   int
+		want  time.Time
+	}{
+		{"day within the month", 2026, time.March, 15, date(2026, 3, 15)},
+		{"31st of a long month", 2026, time.January, 31, date(2026, 1, 31)},
+		{"31st in February", 2026, time.February, 31, date(2026, 2, 28)},
+		{"31st in a leap February", 2028, time.February, 31, date(2028, 2, 29)},
+		{"29th in February", 2026, time.February, 29, date(2026, 2, 28)},
+		{"31st in April", 2026, time.April, 31, date(2026, 4, 30)},
+		{"month 13 is next January", 2026, 13, 31, date(2027, 1, 31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := monthlyDate(tt.year, tt.month, tt.day); !got.Equal(tt.want) {
+				t.Errorf("monthlyDate(%d, %s, %d) = %s, want %s", tt.year, tt.month, tt.day, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestFirstOccurrence(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		day       int
+		from      time.Time
+		want      time.Time
+	}{
+		{"monthly later this month", FrequencyMonthly, 20, date(2026, 3, 10), date(2026, 3, 20)},
+		{"monthly today", FrequencyMonthly, 10, time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC), date(2026, 3, 10)},
+		{"monthly next month", FrequencyMonthly, 5, date(2026, 3, 10), date(2026, 4, 5)},
+		{"monthly 31st from February", FrequencyMonthly, 31, date(2026, 2, 10), date(2026, 2, 28)},
+		{"monthly 31st from the end of February", FrequencyMonthly, 31, date(2026, 2, 28), date(2026, 2, 28)},
+		{"monthly across the new year", FrequencyMonthly, 1, date(2026, 12, 15), date(2027, 1, 1)},
+		// 2026-03-10 is a Tuesday
+		{"weekly today", FrequencyWeekly, 2, date(2026, 3, 10), date(2026, 3, 10)},
+		{"weekly later this week", FrequencyWeekly, 5, date(2026, 3, 10), date(2026, 3, 13)},
+		{"weekly Sunday", FrequencyWeekly, 0, date(2026, 3, 10), date(2026, 3, 15)},
+		{"weekly earlier weekday", FrequencyWeekly, 1, date(2026, 3, 10), date(2026, 3, 16)},
+		{"weekly across the new year", FrequencyWeekly, 1, date(2026, 12, 30), date(2027, 1, 4)},
+		{"later time zone", FrequencyWeekly, 2, time.Date(2026, 3, 10, 1, 0, 0, 0, time.FixedZone("CET", 3600)), date(2026, 3, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstOccurrence(tt.frequency, tt.day, tt.from); !got.Equal(tt.want) {
+				t.Errorf("firstOccurrence(%s, %d, %s) = %s, want %s", tt.frequency, tt.day, tt.from, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	tests := []struct {
+		name       string
+		frequency  string
+		day        int
+		occurrence time.Time
+		want       time.Time
+	}{
+		{"monthly", FrequencyMonthly, 15, date(2026, 3, 15), date(2026, 4, 15)},
+		{"31st into February", FrequencyMonthly, 31, date(2026, 1, 31), date(2026, 2, 28)},
+		{"31st back from February", FrequencyMonthly, 31, date(2026, 2, 28), date(2026, 3, 31)},
+		{"31st into a leap February", FrequencyMonthly, 31, date(2028, 1, 31), date(2028, 2, 29)},
+		{"31st into April", FrequencyMonthly, 31, date(2026, 3, 31), date(2026, 4, 30)},
+		{"December into January", FrequencyMonthly, 31, date(2026, 12, 31), date(2027, 1, 31)},
+		{"weekly", FrequencyWeekly, 2, date(2026, 3, 10), date(2026, 3, 17)},
+		{"weekly across months", FrequencyWeekly, 2, date(2026, 3, 31), date(2026, 4, 7)},
+		{"weekly across the new year", FrequencyWeekly, 4, date(2026, 12, 31), date(2027, 1, 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextOccurrence(tt.frequency, tt.day, tt.occurrence); !got.Equal(tt.want) {
+				t.Errorf("nextOccurrence(%s, %d, %s) = %s, want %s", tt.frequency, tt.day, tt.occurrence.Format(time.DateOnly), got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/config"
+	"banking-backend/currency"
+	"banking-backend/health"
+	"banking-backend/interest"
+	"banking-backend/limits"
+	"banking-backend/metrics"
+	"banking-backend/notifications"
+	"banking-backend/payments"
+	"banking-backend/tracing"
+	"banking-backend/transactions"
+	"fmt"
+	"net/http"
+)
+
+// app bundles the handlers served by the API.
+type app struct {
+	Auth          *auth.Env
+	Accounts      *account.Env
+	Transactions  *transactions.Env
+	Limits        *limits.Engine
+	Currency      *currency.Env
+	Payments      *payments.Env
+	Beneficiaries *beneficiaries.Env // Nil without a database
+	Notifications *notifications.Env // Nil without a database
+	Health        *health.Checker
+	RateLimiter   *auth.RateLimiter
+	RateLimits    config.RateLimit
+
+	// Background jobs, started by main
+	Interest  *interest.Engine
+	Scheduler *payments.Scheduler
+}
+
+// routes returns the API handler: every route behind the logging, tracing,
+// global rate limiting and metrics middleware.
+func (a *app) routes() http.Handler {
+	// Rate limit policies per route
+	rateLimits := a.RateLimits
+	globalLimit := a.RateLimiter.Limit(auth.NewPolicy("global", rateLimits.Global, auth.KeyByIP))
+	loginLimit := a.RateLimiter.Limit(
+		auth.NewPolicy("login-ip", rateLimits.LoginIP, auth.KeyByIP),
+		auth.NewPolicy("login-dni", rateLimits.LoginDNI, auth.KeyByDNI),
+	)
+	signupLimit := a.RateLimiter.Limit(auth.NewPolicy("signup", rateLimits.Signup, auth.KeyByIP))
+	refreshLimit := a.RateLimiter.Limit(auth.NewPolicy("refresh", rateLimits.Refresh, auth.KeyByIP))
+	paymentLimit := a.RateLimiter.Limit(auth.NewPolicy("payments", rateLimits.Payments, auth.KeyByUser))
+
+	// Create a new ServeMux
+	mux := http.NewServeMux()
+
+	// Define handlers
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Welcome to the Banking System!")
+	})
+
+	// Auth routes
+	mux.Handle("/signup", signupLimit(auth.ValidateSignupRequest(http.HandlerFunc(a.Auth.SignupHandler))))
+	mux.Handle("/login", loginLimit(http.HandlerFunc(a.Auth.LoginHandler)))
+	mux.Handle("/change-password", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Auth.ChangePasswordHandler)))
+	mux.Handle("/refresh", refreshLimit(http.HandlerFunc(a.Auth.RefreshHandler)))
+	mux.Handle("/status", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Auth.StatusHandler)))
+	mux.Handle("/user", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Auth.GetUserHandler)))
+
+	// Account routes
+	mux.Handle("/accounts", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Accounts.GetAccountsHandler)))
+	mux.Handle("/create-account", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Accounts.CreateAccountHandler)))
+	mux.Handle("/account-products", http.HandlerFunc(a.Accounts.GetProductsHandler))
+
+	// Transactions routes
+	mux.Handle("/deposit", a.Auth.AuthenticationMiddleware(paymentLimit(http.HandlerFunc(a.Transactions.DepositHandler))))
+	mux.Handle("/withdraw", a.Auth.AuthenticationMiddleware(paymentLimit(http.HandlerFunc(a.Transactions.WithdrawHandler))))
+	mux.Handle("/transfer", a.Auth.AuthenticationMiddleware(paymentLimit(http.HandlerFunc(a.Transactions.TransferHandler))))
+	mux.Handle("/accounts/exchange", a.Auth.AuthenticationMiddleware(paymentLimit(http.HandlerFunc(a.Transactions.ExchangeHandler))))
+	mux.Handle("POST /fees/preview", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Transactions.PreviewFeesHandler)))
+	mux.Handle("GET /transactions", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Transactions.GetTransactionsHandler)))
+
+	// Back-office routes
+	staffOnly := a.Auth.RequireRole(auth.RoleSupport, auth.RoleAdmin)
+	mux.Handle("POST /transactions/{id}/reverse", a.Auth.AuthenticationMiddleware(staffOnly(http.HandlerFunc(a.Transactions.ReverseTransactionHandler))))
+
+	// Limit routes
+	mux.Handle("GET /limits", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Limits.GetLimitsHandler)))
+	mux.Handle("PUT /limits", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Limits.UpdateLimitsHandler)))
+
+	// Standing order routes
+	mux.Handle("POST /standing-orders", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.CreateStandingOrderHandler)))
+	mux.Handle("GET /standing-orders", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.GetStandingOrdersHandler)))
+	mux.Handle("GET /standing-orders/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.GetStandingOrderHandler)))
+	mux.Handle("PATCH /standing-orders/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.UpdateStandingOrderHandler)))
+	mux.Handle("DELETE /standing-orders/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.CancelStandingOrderHandler)))
+	mux.Handle("POST /standing-orders/{id}/pause", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.PauseStandingOrderHandler)))
+	mux.Handle("POST /standing-orders/{id}/resume", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Payments.ResumeStandingOrderHandler)))
+
+	// Beneficiary routes
+	if a.Beneficiaries != nil {
+		mux.Handle("POST /beneficiaries", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.CreateBeneficiaryHandler)))
+		mux.Handle("GET /beneficiaries", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.GetBeneficiariesHandler)))
+		mux.Handle("GET /beneficiaries/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.GetBeneficiaryHandler)))
+		mux.Handle("PATCH /beneficiaries/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.UpdateBeneficiaryHandler)))
+		mux.Handle("DELETE /beneficiaries/{id}", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.DeleteBeneficiaryHandler)))
+		mux.Handle("POST /beneficiaries/{id}/verify", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Beneficiaries.VerifyBeneficiaryHandler)))
+	} else {
+		notImplemented(mux, "/beneficiaries", "/beneficiaries/")
+	}
+
+	// Notification routes
+	if a.Notifications != nil {
+		mux.Handle("/notifications", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Notifications.GetNotificationsHandler)))
+	} else {
+		notImplemented(mux, "/notifications")
+	}
+
+	// FX routes; quotes are stored in Postgres
+	if a.Currency.DB != nil {
+		mux.Handle("/fx/quotes", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Currency.CreateQuoteHandler)))
+	} else {
+		notImplemented(mux, "/fx/quotes")
+	}
+	mux.Handle("/rates", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Currency.GetRatesHandler)))
+	mux.Handle("/rates/history", a.Auth.AuthenticationMiddleware(http.HandlerFunc(a.Currency.GetRateHistoryHandler)))
+
+	// Currency conversion route
+	mux.Handle("/convert", http.HandlerFunc(a.Currency.ConvertHandler))
+
+	// Health routes for the orchestrator, kept out of the global rate limit
+	// so that a flood of requests from its IP cannot fail the probes
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", a.Health.LivenessHandler)
+	root.HandleFunc("GET /readyz", a.Health.ReadinessHandler)
+	root.Handle("/", globalLimit(metrics.Instrument(mux)))
+
+	return auth.Logger(tracing.Middleware(root))
+}
+
+// notImplemented answers the patterns of features that need a database with
+// 501, rather than letting them fall through to the welcome route.
+func notImplemented(mux *http.ServeMux, patterns ...string) {
+	for _, pattern := range patterns {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			auth.RespondWithError(w, http.StatusNotImplemented, "Not available without a database")
+		})
+	}
+}
+
+// adminRoutes returns the handler of the admin listener, which serves the
+// Prometheus metrics away from the public API.
+func (a *app) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"banking-backend/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Server ---
+
+// New returns a server for handler with the timeouts of cfg.
+func New(cfg config.HTTP, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// Run serves srv until ctx is done, typically on SIGTERM. It then calls
+// onShutdown so readiness fails, waits DrainDelay for load balancers to
+// notice, and stops accepting connections and the workers. In-flight requests
+// and workers share one ShutdownTimeout, so the whole shutdown takes at most
+// DrainDelay plus ShutdownTimeout; requests still running past it are cut.
+func Run(ctx context.Context, srv *http.Server, cfg config.HTTP, workers *Workers, onShutdown func()) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("could not serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down: draining connections")
+	if onShutdown != nil {
+		onShutdown()
+	}
+	time.Sleep(cfg.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- workers.Stop(shutdownCtx)
+	}()
+
+	var drainErr error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		_ = srv.Close()
+		drainErr = fmt.Errorf("could not drain connections: %w", err)
+	} else if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		drainErr = err
+	}
+	return errors.Join(drainErr, <-stopped)
+}
+
+// --- Responses ---
+
+// StatusWriter records the status code and size of a response for the
+// middleware that log and measure requests.
+type StatusWriter struct {
+	http.ResponseWriter
+	Status int // 0 until the handler writes
+	Bytes  int
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	if w.Status == 0 {
+		w.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// StatusCode returns the status sent, which is 200 when the handler wrote
+// nothing.
+func (w *StatusWriter) StatusCode() int {
+	if w.Status == 0 {
+		return http.StatusOK
+	}
+	return w.Status
+}
+
+// --- Workers ---
+
+// Workers runs background jobs until they are stopped.
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWorkers(ctx context.Context) *Workers {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Go runs job in its own goroutine. job must return once ctx is cancelled.
+func (w *Workers) Go(job func(ctx context.Context)) {
+	w.wg.Go(func() { job(w.ctx) })
+}
+
+// Stop cancels the jobs and waits for them to return until ctx is done. Jobs
+// interrupted inside a database transaction roll it back. Stopping nil
+// workers does nothing.
+func (w *Workers) Stop(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("background workers did not stop in time")
+	}
+}
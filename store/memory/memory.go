@@ -0,0 +1,821 @@
+package memory
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/cards"
+	"banking-backend/clock"
+	"banking-backend/interest"
+	"banking-backend/limits"
+	"banking-backend/payments"
+	"banking-backend/store"
+	"banking-backend/transactions"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Store keeps users, accounts, the ledger, cards, spending limits, standing
+// orders and interest accruals in memory, for tests and local development. It
+// implements auth.UserRepository, account.Repository, transactions.Repository,
+// cards.Repository, limits.Repository, payments.Repository,
+// interest.Repository and store.Transactor.
+//
+// A unit of work holds the store exclusively until it ends, which also makes
+// the ForUpdate lookups safe, and is undone if it fails.
+type Store struct {
+	Clock clock.Clock // Stamps creations and updates, like NOW() in Postgres
+
+	mu   sync.Mutex
+	data *data
+}
+
+var (
+	_ store.Transactor        = (*Store)(nil)
+	_ auth.UserRepository     = (*Store)(nil)
+	_ account.Repository      = (*Store)(nil)
+	_ transactions.Repository = (*Store)(nil)
+	_ cards.Repository        = (*Store)(nil)
+	_ limits.Repository       = (*Store)(nil)
+	_ payments.Repository     = (*Store)(nil)
+	_ interest.Repository     = (*Store)(nil)
+)
+
+type data struct {
+	users        map[string]auth.User
+	accounts     map[string]account.Account
+	pockets      map[string]map[string]float64 // By account ID, then currency
+	transactions []transactions.Transaction    // Transaction i has ID i+1
+	cards        map[string]cards.Card
+	overrides    map[overrideKey]limits.Override
+	orders       map[string]payments.StandingOrder
+	accruals     []interest.Accrual
+	interestRuns map[string]bool // By accrual date
+}
+
+// overrideKey identifies the limits of a user (accountID empty) or account.
+type overrideKey struct {
+	userID, accountID string
+}
+
+func New() *Store {
+	return &Store{Clock: clock.System{}, data: &data{
+		users:        make(map[string]auth.User),
+		accounts:     make(map[string]account.Account),
+		pockets:      make(map[string]map[string]float64),
+		cards:        make(map[string]cards.Card),
+		overrides:    make(map[overrideKey]limits.Override),
+		orders:       make(map[string]payments.StandingOrder),
+		interestRuns: make(map[string]bool),
+	}}
+}
+
+func (d *data) clone() *data {
+	c := &data{
+		users:        maps.Clone(d.users),
+		accounts:     maps.Clone(d.accounts),
+		pockets:      make(map[string]map[string]float64, len(d.pockets)),
+		transactions: slices.Clone(d.transactions),
+		cards:        maps.Clone(d.cards),
+		overrides:    maps.Clone(d.overrides),
+		orders:       maps.Clone(d.orders),
+		accruals:     slices.Clone(d.accruals),
+		interestRuns: maps.Clone(d.interestRuns),
+	}
+	for id, balances := range d.pockets {
+		c.pockets[id] = maps.Clone(balances)
+	}
+	return c
+}
+
+func (s *Store) now() time.Time {
+	return s.Clock.Now()
+}
+
+// --- Transactions ---
+
+type txKey struct{}
+
+// WithinTx runs fn with exclusive access to the store, restoring its previous
+// state if fn fails. Nested calls join the enclosing unit of work.
+func (s *Store) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) == s {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := s.data.clone()
+	if err := fn(context.WithValue(ctx, txKey{}, s)); err != nil {
+		s.data = snapshot
+		return err
+	}
+	return nil
+}
+
+// lock takes the store unless ctx already belongs to one of its units of work.
+func (s *Store) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// --- Users ---
+
+func (s *Store) CreateUser(ctx context.Context, user *auth.User, pinHash string) (string, error) {
+	defer s.lock(ctx)()
+
+	for _, u := range s.data.users {
+		if u.DNI == user.DNI || u.Email == user.Email {
+			return "", auth.ErrUserExists
+		}
+	}
+	u := *user
+	u.ID = newID()
+	u.GeneratedPinHash = pinHash
+	u.Role = auth.RoleCustomer
+	u.UpdatedAt = s.now()
+	s.data.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (s *Store) GetUserByDNI(ctx context.Context, dni string) (*auth.User, error) {
+	defer s.lock(ctx)()
+
+	for _, u := range s.data.users {
+		if u.DNI == dni {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (*auth.User, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.data.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (s *Store) UpdatePinHash(ctx context.Context, userID, newPinHash string) error {
+	defer s.lock(ctx)()
+
+	if u, ok := s.data.users[userID]; ok {
+		u.GeneratedPinHash = newPinHash
+		u.UpdatedAt = s.now()
+		s.data.users[userID] = u
+	}
+	return nil
+}
+
+// SetRole changes the role of a user, which the API cannot do, so tests can
+// create staff users.
+func (s *Store) SetRole(userID, role string) {
+	defer s.lock(context.Background())()
+
+	if u, ok := s.data.users[userID]; ok {
+		u.Role = role
+		s.data.users[userID] = u
+	}
+}
+
+// --- Accounts ---
+
+func (s *Store) CreateAccount(ctx context.Context, acc *account.Account) (string, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.users[acc.UserID]; !ok {
+		return "", fmt.Errorf("could not create account: user %s does not exist", acc.UserID)
+	}
+	for _, a := range s.data.accounts {
+		if a.AccountNumber == acc.AccountNumber {
+			return "", account.ErrDuplicateAccountNumber
+		}
+	}
+	a := *acc
+	a.ID = newID()
+	a.Pockets = nil
+	a.CreatedAt = s.now()
+	a.UpdatedAt = a.CreatedAt
+	s.data.accounts[a.ID] = a
+	return a.ID, nil
+}
+
+func (s *Store) GetAccountsByUserID(ctx context.Context, userID string) ([]*account.Account, error) {
+	defer s.lock(ctx)()
+
+	var accounts []*account.Account
+	for _, a := range s.data.accounts {
+		if a.UserID == userID {
+			accounts = append(accounts, &a)
+		}
+	}
+	slices.SortFunc(accounts, func(a, b *account.Account) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return accounts, nil
+}
+
+func (s *Store) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*account.Account, error) {
+	defer s.lock(ctx)()
+	return s.accountByNumber(accountNumber), nil
+}
+
+func (s *Store) GetAccountForUpdate(ctx context.Context, accountNumber string) (*account.Account, error) {
+	defer s.lock(ctx)()
+	return s.accountByNumber(accountNumber), nil
+}
+
+func (s *Store) accountByNumber(accountNumber string) *account.Account {
+	for _, a := range s.data.accounts {
+		if a.AccountNumber == accountNumber {
+			return &a
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAccountByIDForUpdate(ctx context.Context, id string) (*account.Account, error) {
+	defer s.lock(ctx)()
+
+	a, ok := s.data.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (s *Store) UpdateAccountBalance(ctx context.Context, accountID string, newBalance float64) error {
+	defer s.lock(ctx)()
+
+	if a, ok := s.data.accounts[accountID]; ok {
+		a.Balance = newBalance
+		a.UpdatedAt = s.now()
+		s.data.accounts[accountID] = a
+	}
+	return nil
+}
+
+func (s *Store) GetPocketForUpdate(ctx context.Context, accountID, cur string) (float64, error) {
+	defer s.lock(ctx)()
+	return s.data.pockets[accountID][cur], nil
+}
+
+func (s *Store) SetPocket(ctx context.Context, accountID, cur string, balance float64) error {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.accounts[accountID]; !ok {
+		return fmt.Errorf("could not update pocket balance: account %s does not exist", accountID)
+	}
+	if s.data.pockets[accountID] == nil {
+		s.data.pockets[accountID] = make(map[string]float64)
+	}
+	s.data.pockets[accountID][cur] = balance
+	return nil
+}
+
+func (s *Store) GetPockets(ctx context.Context, accountIDs []string) (map[string]map[string]float64, error) {
+	defer s.lock(ctx)()
+
+	pockets := make(map[string]map[string]float64)
+	for _, id := range accountIDs {
+		if balances, ok := s.data.pockets[id]; ok {
+			pockets[id] = maps.Clone(balances)
+		}
+	}
+	return pockets, nil
+}
+
+// --- Ledger ---
+
+func (s *Store) CreateTransaction(ctx context.Context, transaction *transactions.Transaction) (*transactions.Transaction, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.accounts[transaction.AccountID]; !ok {
+		return nil, fmt.Errorf("could not create transaction: account %s does not exist", transaction.AccountID)
+	}
+	if transaction.ReversalOf != nil {
+		for _, t := range s.data.transactions {
+			if t.ReversalOf != nil && *t.ReversalOf == *transaction.ReversalOf {
+				return nil, transactions.ErrAlreadyReversed
+			}
+		}
+	}
+	if transaction.Status == "" {
+		transaction.Status = transactions.StatusPosted
+	}
+	transaction.ID = len(s.data.transactions) + 1
+	transaction.Timestamp = s.now()
+
+	t := *transaction
+	t.Fees = nil
+	s.data.transactions = append(s.data.transactions, t)
+	return transaction, nil
+}
+
+func (s *Store) LinkTransactions(ctx context.Context, a, b *transactions.Transaction) error {
+	defer s.lock(ctx)()
+
+	for _, pair := range [][2]*transactions.Transaction{{a, b}, {b, a}} {
+		t, ok := s.transaction(pair[0].ID)
+		if !ok {
+			return fmt.Errorf("could not link transactions: %w", transactions.ErrTransactionNotFound)
+		}
+		id := pair[1].ID
+		t.LinkedID = &id
+	}
+	a.LinkedID = &b.ID
+	b.LinkedID = &a.ID
+	return nil
+}
+
+// transaction returns the stored transaction id, which callers may modify.
+func (s *Store) transaction(id int) (*transactions.Transaction, bool) {
+	if id < 1 || id > len(s.data.transactions) {
+		return nil, false
+	}
+	return &s.data.transactions[id-1], true
+}
+
+func (s *Store) GetTransactionForUpdate(ctx context.Context, id int) (*transactions.Transaction, error) {
+	defer s.lock(ctx)()
+
+	t, ok := s.transaction(id)
+	if !ok {
+		return nil, transactions.ErrTransactionNotFound
+	}
+	found := *t
+	return &found, nil
+}
+
+func (s *Store) GetFeesForUpdate(ctx context.Context, ids []int) ([]*transactions.Transaction, error) {
+	defer s.lock(ctx)()
+
+	var fees []*transactions.Transaction
+	for _, t := range s.data.transactions {
+		if t.FeeFor != nil && slices.Contains(ids, *t.FeeFor) {
+			fees = append(fees, &t)
+		}
+	}
+	return fees, nil
+}
+
+func (s *Store) MarkTransactionReversed(ctx context.Context, id int) error {
+	defer s.lock(ctx)()
+
+	if t, ok := s.transaction(id); ok {
+		t.Status = transactions.StatusReversed
+	}
+	return nil
+}
+
+func (s *Store) CountDebitsSince(ctx context.Context, accountID string, since time.Time) (int, error) {
+	defer s.lock(ctx)()
+
+	count := 0
+	for _, t := range s.data.transactions {
+		if t.AccountID == accountID && !t.Timestamp.Before(since) &&
+			(t.TransactionType == transactions.TypeWithdrawal || t.TransactionType == transactions.TypeTransferOut) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) GetTransactionsByUserID(ctx context.Context, userID, accountNumber string, limit int) ([]*transactions.Transaction, error) {
+	defer s.lock(ctx)()
+
+	reversedBy := make(map[int]int)
+	for _, t := range s.data.transactions {
+		if t.ReversalOf != nil {
+			reversedBy[*t.ReversalOf] = t.ID
+		}
+	}
+
+	found := []*transactions.Transaction{}
+	for _, t := range s.data.transactions {
+		a := s.data.accounts[t.AccountID]
+		if a.UserID != userID || (accountNumber != "" && a.AccountNumber != accountNumber) {
+			continue
+		}
+		if id, ok := reversedBy[t.ID]; ok {
+			t.ReversedBy = &id
+		}
+		found = append(found, &t)
+	}
+	slices.SortFunc(found, func(a, b *transactions.Transaction) int {
+		return cmp.Or(b.Timestamp.Compare(a.Timestamp), cmp.Compare(b.ID, a.ID))
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (s *Store) GetDebitsSince(ctx context.Context, userID, accountID string, since time.Time) ([]*transactions.Transaction, error) {
+	defer s.lock(ctx)()
+
+	var debits []*transactions.Transaction
+	for _, t := range s.data.transactions {
+		a := s.data.accounts[t.AccountID]
+		if a.UserID != userID || (accountID != "" && a.ID != accountID) || t.Timestamp.Before(since) ||
+			(t.TransactionType != transactions.TypeWithdrawal && t.TransactionType != transactions.TypeTransferOut) {
+			continue
+		}
+		debits = append(debits, &t)
+	}
+	slices.SortStableFunc(debits, func(a, b *transactions.Transaction) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return debits, nil
+}
+
+// --- Cards ---
+
+func (s *Store) CreateCard(ctx context.Context, card *cards.Card) (string, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.accounts[card.AccountID]; !ok {
+		return "", fmt.Errorf("could not create card: account %s does not exist", card.AccountID)
+	}
+	for _, c := range s.data.cards {
+		if c.CardNumber == card.CardNumber {
+			return "", cards.ErrDuplicateCardNumber
+		}
+	}
+	if card.Status == "" {
+		card.Status = cards.StatusActive
+	}
+	c := *card
+	c.ID = newID()
+	c.CreatedAt = s.now()
+	c.UpdatedAt = c.CreatedAt
+	s.data.cards[c.ID] = c
+	return c.ID, nil
+}
+
+func (s *Store) GetCardByID(ctx context.Context, id string) (*cards.Card, error) {
+	defer s.lock(ctx)()
+
+	c, ok := s.data.cards[id]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (s *Store) GetCardsByAccountID(ctx context.Context, accountID string) ([]*cards.Card, error) {
+	defer s.lock(ctx)()
+
+	var found []*cards.Card
+	for _, c := range s.data.cards {
+		if c.AccountID == accountID {
+			found = append(found, &c)
+		}
+	}
+	slices.SortFunc(found, func(a, b *cards.Card) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return found, nil
+}
+
+func (s *Store) UpdateCardStatus(ctx context.Context, id, status string) error {
+	defer s.lock(ctx)()
+
+	if c, ok := s.data.cards[id]; ok {
+		c.Status = status
+		c.UpdatedAt = s.now()
+		s.data.cards[id] = c
+	}
+	return nil
+}
+
+// --- Limits ---
+
+// LockUser has nothing to do: units of work already hold the whole store.
+func (s *Store) LockUser(ctx context.Context, userID string) error {
+	return nil
+}
+
+func (s *Store) GetOverride(ctx context.Context, userID, accountID string) (*limits.Override, error) {
+	defer s.lock(ctx)()
+
+	o, ok := s.data.overrides[overrideKey{userID, accountID}]
+	if !ok {
+		return nil, nil
+	}
+	return copyOverride(o), nil
+}
+
+func (s *Store) SaveOverride(ctx context.Context, userID, accountID string, o *limits.Override) error {
+	defer s.lock(ctx)()
+
+	key := overrideKey{userID, accountID}
+	if o.IsEmpty() {
+		delete(s.data.overrides, key)
+		return nil
+	}
+	s.data.overrides[key] = *copyOverride(*o)
+	return nil
+}
+
+// copyOverride copies the fields of o, so that callers cannot change the
+// stored values through them.
+func copyOverride(o limits.Override) *limits.Override {
+	return &limits.Override{
+		PerTransaction: copyValue(o.PerTransaction),
+		Daily:          copyValue(o.Daily),
+		Monthly:        copyValue(o.Monthly),
+		HourlyCount:    copyValue(o.HourlyCount),
+	}
+}
+
+func copyValue[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+// --- Standing Orders ---
+
+func (s *Store) CreateStandingOrder(ctx context.Context, o *payments.StandingOrder) error {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.users[o.UserID]; !ok {
+		return fmt.Errorf("could not create standing order: user %s does not exist", o.UserID)
+	}
+	o.ID = newID()
+	o.CreatedAt = s.now()
+	o.UpdatedAt = o.CreatedAt
+	s.data.orders[o.ID] = *o
+	return nil
+}
+
+func (s *Store) GetStandingOrder(ctx context.Context, id string) (*payments.StandingOrder, error) {
+	defer s.lock(ctx)()
+
+	o, ok := s.data.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return &o, nil
+}
+
+func (s *Store) GetStandingOrdersByUserID(ctx context.Context, userID string) ([]*payments.StandingOrder, error) {
+	defer s.lock(ctx)()
+
+	orders := []*payments.StandingOrder{}
+	for _, o := range s.data.orders {
+		if o.UserID == userID {
+			orders = append(orders, &o)
+		}
+	}
+	slices.SortFunc(orders, func(a, b *payments.StandingOrder) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return orders, nil
+}
+
+func (s *Store) GetDueStandingOrders(ctx context.Context, now time.Time, limit int) ([]*payments.StandingOrder, error) {
+	defer s.lock(ctx)()
+
+	var orders []*payments.StandingOrder
+	for _, o := range s.data.orders {
+		if o.Status == payments.StatusActive && !o.NextRunAt.After(now) {
+			orders = append(orders, &o)
+		}
+	}
+	slices.SortFunc(orders, func(a, b *payments.StandingOrder) int {
+		return cmp.Or(a.NextRunAt.Compare(b.NextRunAt), cmp.Compare(a.ID, b.ID))
+	})
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (s *Store) GetStandingOrderForUpdate(ctx context.Context, id string) (*payments.StandingOrder, error) {
+	return s.GetStandingOrder(ctx, id)
+}
+
+func (s *Store) UpdateStandingOrderTerms(ctx context.Context, o *payments.StandingOrder, reschedule bool) error {
+	return s.updateStandingOrder(ctx, o, func(stored *payments.StandingOrder) {
+		stored.ToAccountNumber, stored.Amount, stored.Frequency, stored.Day = o.ToAccountNumber, o.Amount, o.Frequency, o.Day
+		if reschedule {
+			stored.ScheduledFor, stored.NextRunAt, stored.Attempts = o.ScheduledFor, o.NextRunAt, 0
+		}
+	})
+}
+
+func (s *Store) UpdateStandingOrderStatus(ctx context.Context, o *payments.StandingOrder, reschedule bool) error {
+	return s.updateStandingOrder(ctx, o, func(stored *payments.StandingOrder) {
+		stored.Status = o.Status
+		if reschedule {
+			stored.ScheduledFor, stored.NextRunAt, stored.Attempts = o.ScheduledFor, o.NextRunAt, 0
+		}
+	})
+}
+
+func (s *Store) RecordStandingOrderRun(ctx context.Context, o *payments.StandingOrder) error {
+	return s.updateStandingOrder(ctx, o, func(stored *payments.StandingOrder) {
+		stored.Status, stored.ScheduledFor, stored.NextRunAt = o.Status, o.ScheduledFor, o.NextRunAt
+		stored.Attempts, stored.LastError, stored.LastRunAt = o.Attempts, o.LastError, copyValue(o.LastRunAt)
+	})
+}
+
+// updateStandingOrder applies set to the stored order, like the Postgres
+// updates, only if it is unchanged since o was read.
+func (s *Store) updateStandingOrder(ctx context.Context, o *payments.StandingOrder, set func(stored *payments.StandingOrder)) error {
+	defer s.lock(ctx)()
+
+	stored, ok := s.data.orders[o.ID]
+	if !ok || !stored.UpdatedAt.Equal(o.UpdatedAt) {
+		return payments.ErrStandingOrderChanged
+	}
+	set(&stored)
+	stored.UpdatedAt = s.touch(stored.UpdatedAt)
+	s.data.orders[o.ID] = stored
+	o.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (s *Store) ClaimStandingOrder(ctx context.Context, o *payments.StandingOrder, lease time.Time) (bool, error) {
+	defer s.lock(ctx)()
+
+	stored, ok := s.data.orders[o.ID]
+	if !ok || stored.Status != payments.StatusActive || !stored.NextRunAt.Equal(o.NextRunAt) {
+		return false, nil
+	}
+	stored.NextRunAt = lease
+	stored.UpdatedAt = s.touch(stored.UpdatedAt)
+	s.data.orders[o.ID] = stored
+	o.NextRunAt, o.UpdatedAt = lease, stored.UpdatedAt
+	return true, nil
+}
+
+// touch returns the new update time of a row last updated at previous. It
+// always moves forward, even on a fixed clock, so that the optimistic checks
+// notice every update.
+func (s *Store) touch(previous time.Time) time.Time {
+	now := s.now()
+	if !now.After(previous) {
+		now = previous.Add(time.Microsecond)
+	}
+	return now
+}
+
+// --- Interest ---
+
+func (s *Store) GetEndOfDayBalances(ctx context.Context, accountTypes []string, day time.Time) ([]interest.Balance, error) {
+	defer s.lock(ctx)()
+
+	// Rebuild the end-of-day balance by removing everything posted afterwards
+	nextDay := day.AddDate(0, 0, 1)
+	var balances []interest.Balance
+	for _, a := range s.data.accounts {
+		if !slices.Contains(accountTypes, a.AccountType) || !a.CreatedAt.Before(nextDay) {
+			continue
+		}
+		balance := a.Balance
+		for _, t := range s.data.transactions {
+			if t.AccountID == a.ID && t.Currency == a.Currency && !t.Timestamp.Before(nextDay) {
+				balance -= t.Amount
+			}
+		}
+		balances = append(balances, interest.Balance{AccountID: a.ID, AccountType: a.AccountType, Amount: balance})
+	}
+	slices.SortFunc(balances, func(a, b interest.Balance) int {
+		return cmp.Compare(a.AccountID, b.AccountID)
+	})
+	return balances, nil
+}
+
+func (s *Store) RecordAccrual(ctx context.Context, accrual *interest.Accrual) error {
+	defer s.lock(ctx)()
+
+	if _, ok := s.data.accounts[accrual.AccountID]; !ok {
+		return fmt.Errorf("could not record accrual: account %s does not exist", accrual.AccountID)
+	}
+	for _, a := range s.data.accruals {
+		if a.AccountID == accrual.AccountID && a.AccrualDate.Equal(accrual.AccrualDate) {
+			return nil
+		}
+	}
+	a := *accrual
+	a.PostedAt, a.TransactionID = nil, nil
+	s.data.accruals = append(s.data.accruals, a)
+	return nil
+}
+
+func (s *Store) RecordRun(ctx context.Context, day time.Time) error {
+	defer s.lock(ctx)()
+
+	s.data.interestRuns[day.Format(time.DateOnly)] = true
+	return nil
+}
+
+func (s *Store) LastAccrualDate(ctx context.Context) (time.Time, error) {
+	defer s.lock(ctx)()
+
+	var last time.Time
+	for date := range s.data.interestRuns {
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not get last accrual date: %w", err)
+		}
+		if day.After(last) {
+			last = day
+		}
+	}
+	return last, nil
+}
+
+func (s *Store) GetPendingMonths(ctx context.Context, cutoff time.Time) ([]interest.PendingMonth, error) {
+	defer s.lock(ctx)()
+
+	var months []interest.PendingMonth
+	for _, a := range s.data.accruals {
+		if a.PostedAt != nil || !a.AccrualDate.Before(cutoff) {
+			continue
+		}
+		month := interest.PendingMonth{
+			AccountNumber: s.data.accounts[a.AccountID].AccountNumber,
+			Month:         time.Date(a.AccrualDate.Year(), a.AccrualDate.Month(), 1, 0, 0, 0, 0, time.UTC),
+		}
+		if !slices.Contains(months, month) {
+			months = append(months, month)
+		}
+	}
+	slices.SortFunc(months, func(a, b interest.PendingMonth) int {
+		return cmp.Or(a.Month.Compare(b.Month), cmp.Compare(a.AccountNumber, b.AccountNumber))
+	})
+	return months, nil
+}
+
+func (s *Store) SumUnposted(ctx context.Context, accountID string, start, end time.Time) (float64, error) {
+	defer s.lock(ctx)()
+
+	var total float64
+	for _, a := range s.unposted(accountID, start, end) {
+		total += s.data.accruals[a].Amount
+	}
+	return total, nil
+}
+
+func (s *Store) MarkPosted(ctx context.Context, accountID string, start, end, postedAt time.Time, transactionID *int) error {
+	defer s.lock(ctx)()
+
+	for _, a := range s.unposted(accountID, start, end) {
+		accrual := &s.data.accruals[a]
+		accrual.PostedAt, accrual.TransactionID = &postedAt, copyValue(transactionID)
+	}
+	return nil
+}
+
+// unposted returns the indexes of the unposted accruals of an account from
+// start until end.
+func (s *Store) unposted(accountID string, start, end time.Time) []int {
+	var indexes []int
+	for i, a := range s.data.accruals {
+		if a.AccountID == accountID && a.PostedAt == nil && !a.AccrualDate.Before(start) && a.AccrualDate.Before(end) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func (s *Store) GetAccruals(ctx context.Context, accountID string) ([]*interest.Accrual, error) {
+	defer s.lock(ctx)()
+
+	var accruals []*interest.Accrual
+	for _, a := range s.data.accruals {
+		if a.AccountID == accountID {
+			accruals = append(accruals, &a)
+		}
+	}
+	slices.SortFunc(accruals, func(a, b *interest.Accrual) int {
+		return a.AccrualDate.Compare(b.AccrualDate)
+	})
+	return accruals, nil
+}
+
+// newID returns a random version 4 UUID, like the IDs generated by Postgres.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// --- Transactions ---
+
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transactor runs a unit of work atomically. Repository calls made with the
+// context passed to fn take part in it, and are rolled back if fn fails.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// Postgres is the Transactor of the repositories backed by database/sql.
+type Postgres struct {
+	DB *sql.DB
+}
+
+// WithinTx runs fn in a database transaction carried by its context. Nested
+// calls join the enclosing transaction.
+func (p Postgres) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if TxFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx) // Rollback in case of an error
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return nil
+}
+
+// TxFromContext returns the transaction started by Postgres.WithinTx, or nil
+// outside of one.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx
+}
+
+// Conn returns the transaction carried by ctx, if any, or db.
+func Conn(ctx context.Context, db *sql.DB) Querier {
+	if tx := TxFromContext(ctx); tx != nil {
+		return tx
+	}
+	return db
+}
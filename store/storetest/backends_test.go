@@ -0,0 +1,68 @@
+package storetest
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/cards"
+	"banking-backend/db/migrations"
+	"banking-backend/interest"
+	"banking-backend/limits"
+	"banking-backend/payments"
+	"banking-backend/store"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func TestMemoryStore(t *testing.T) {
+	Run(t, func(t *testing.T) Stores {
+		s := memory.New()
+		return Stores{Tx: s, Users: s, Accounts: s, Transactions: s, Cards: s, Overrides: s, Orders: s, Accruals: s}
+	})
+}
+
+// TestPostgresStore runs against the database in TEST_DATABASE_URL, which it
+// migrates and empties before every test.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	Run(t, func(t *testing.T) Stores {
+		_, err := db.Exec(`TRUNCATE users, accounts, account_balances, cards, transactions,
+			spending_limits, standing_orders, interest_accruals, interest_runs RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatalf("could not empty the database: %v", err)
+		}
+		return Stores{
+			Tx:           store.Postgres{DB: db},
+			Users:        &auth.DB{DB: db},
+			Accounts:     &account.DB{DB: db},
+			Transactions: &transactions.DB{DB: db},
+			Cards:        &cards.DB{DB: db},
+			Overrides:    &limits.DB{DB: db},
+			Orders:       &payments.DB{DB: db},
+			Accruals:     &interest.DB{DB: db},
+		}
+	})
+}
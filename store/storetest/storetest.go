@@ -0,0 +1,806 @@
+// Package storetest is the contract every repository backend must pass.
+package storetest
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/cards"
+	"banking-backend/interest"
+	"banking-backend/limits"
+	"banking-backend/payments"
+	"banking-backend/store"
+	"banking-backend/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Stores are the repositories of one backend, sharing its data.
+type Stores struct {
+	Tx           store.Transactor
+	Users        auth.UserRepository
+	Accounts     account.Repository
+	Transactions transactions.Repository
+	Cards        cards.Repository
+	Overrides    limits.Repository
+	Orders       payments.Repository
+	Accruals     interest.Repository
+}
+
+// Run runs the contract against the backend returned by open, which must be
+// empty every time it is called.
+func Run(t *testing.T, open func(t *testing.T) Stores) {
+	for _, test := range []struct {
+		name string
+		fn   func(t *testing.T, s Stores)
+	}{
+		{"Users", testUsers},
+		{"DuplicateUsers", testDuplicateUsers},
+		{"Accounts", testAccounts},
+		{"Pockets", testPockets},
+		{"Transactions", testTransactions},
+		{"Reversals", testReversals},
+		{"History", testHistory},
+		{"Debits", testDebits},
+		{"Cards", testCards},
+		{"Overrides", testOverrides},
+		{"StandingOrders", testStandingOrders},
+		{"Accruals", testAccruals},
+		{"Rollback", testRollback},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, open(t))
+		})
+	}
+}
+
+// --- Fixtures ---
+
+var sequence atomic.Int64
+
+// unique returns a value no other call in this process returns.
+func unique(prefix string) string {
+	return fmt.Sprintf("%s%06d", prefix, sequence.Add(1))
+}
+
+func createUser(t *testing.T, s Stores) *auth.User {
+	t.Helper()
+	user := &auth.User{DNI: unique("D"), FullName: "Ada Lovelace", Email: unique("ada") + "@example.com"}
+	id, err := s.Users.CreateUser(context.Background(), user, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user.ID = id
+	return user
+}
+
+func createAccount(t *testing.T, s Stores, userID, accountType, cur string) *account.Account {
+	t.Helper()
+	acc := &account.Account{UserID: userID, AccountNumber: unique("ES00TEST"), Currency: cur, AccountType: accountType}
+	id, err := s.Accounts.CreateAccount(context.Background(), acc)
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	acc.ID = id
+	return acc
+}
+
+func createTransaction(t *testing.T, s Stores, tr *transactions.Transaction) *transactions.Transaction {
+	t.Helper()
+	created, err := s.Transactions.CreateTransaction(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	return created
+}
+
+// --- Users ---
+
+func testUsers(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+
+	byID, err := s.Users.GetUserByID(ctx, user.ID)
+	if err != nil || byID == nil {
+		t.Fatalf("GetUserByID = %v, %v", byID, err)
+	}
+	if byID.DNI != user.DNI || byID.Email != user.Email || byID.FullName != user.FullName {
+		t.Errorf("GetUserByID = %+v, want %+v", byID, user)
+	}
+	if byID.GeneratedPinHash != "hash" || byID.Role != auth.RoleCustomer {
+		t.Errorf("new user has pin hash %q and role %q", byID.GeneratedPinHash, byID.Role)
+	}
+
+	byDNI, err := s.Users.GetUserByDNI(ctx, user.DNI)
+	if err != nil || byDNI == nil || byDNI.ID != user.ID {
+		t.Fatalf("GetUserByDNI = %v, %v", byDNI, err)
+	}
+
+	if err := s.Users.UpdatePinHash(ctx, user.ID, "new-hash"); err != nil {
+		t.Fatalf("UpdatePinHash: %v", err)
+	}
+	updated, err := s.Users.GetUserByID(ctx, user.ID)
+	if err != nil || updated.GeneratedPinHash != "new-hash" {
+		t.Errorf("pin hash after update = %q, %v", updated.GeneratedPinHash, err)
+	}
+
+	missing, err := s.Users.GetUserByDNI(ctx, "missing")
+	if missing != nil || err != nil {
+		t.Errorf("GetUserByDNI(missing) = %v, %v, want nil, nil", missing, err)
+	}
+	missing, err = s.Users.GetUserByID(ctx, "00000000-0000-4000-8000-000000000000")
+	if missing != nil || err != nil {
+		t.Errorf("GetUserByID(missing) = %v, %v, want nil, nil", missing, err)
+	}
+}
+
+func testDuplicateUsers(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+
+	sameDNI := &auth.User{DNI: user.DNI, FullName: "Other", Email: unique("other") + "@example.com"}
+	if _, err := s.Users.CreateUser(ctx, sameDNI, "hash"); !errors.Is(err, auth.ErrUserExists) {
+		t.Errorf("CreateUser with a taken DNI = %v, want ErrUserExists", err)
+	}
+	sameEmail := &auth.User{DNI: unique("D"), FullName: "Other", Email: user.Email}
+	if _, err := s.Users.CreateUser(ctx, sameEmail, "hash"); !errors.Is(err, auth.ErrUserExists) {
+		t.Errorf("CreateUser with a taken email = %v, want ErrUserExists", err)
+	}
+}
+
+// --- Accounts ---
+
+func testAccounts(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	first := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	second := createAccount(t, s, user.ID, account.TypeSavings, "USD")
+	createAccount(t, s, createUser(t, s).ID, account.TypeChecking, "EUR")
+
+	accounts, err := s.Accounts.GetAccountsByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetAccountsByUserID: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].ID != first.ID || accounts[1].ID != second.ID {
+		t.Fatalf("GetAccountsByUserID = %+v, want the two accounts of the user in creation order", accounts)
+	}
+	if got := accounts[1]; got.AccountNumber != second.AccountNumber || got.Currency != "USD" ||
+		got.AccountType != account.TypeSavings || got.Balance != 0 || got.CreatedAt.IsZero() {
+		t.Errorf("stored account = %+v", got)
+	}
+
+	duplicate := &account.Account{UserID: user.ID, AccountNumber: first.AccountNumber, Currency: "EUR", AccountType: account.TypeChecking}
+	if _, err := s.Accounts.CreateAccount(ctx, duplicate); !errors.Is(err, account.ErrDuplicateAccountNumber) {
+		t.Errorf("CreateAccount with a taken number = %v, want ErrDuplicateAccountNumber", err)
+	}
+
+	if err := s.Accounts.UpdateAccountBalance(ctx, first.ID, 125.5); err != nil {
+		t.Fatalf("UpdateAccountBalance: %v", err)
+	}
+	byNumber, err := s.Accounts.GetAccountByAccountNumber(ctx, first.AccountNumber)
+	if err != nil || byNumber == nil || byNumber.ID != first.ID || byNumber.Balance != 125.5 {
+		t.Errorf("GetAccountByAccountNumber = %+v, %v, want balance 125.5", byNumber, err)
+	}
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		locked, err := s.Accounts.GetAccountForUpdate(ctx, first.AccountNumber)
+		if err != nil || locked == nil || locked.ID != first.ID {
+			t.Errorf("GetAccountForUpdate = %+v, %v", locked, err)
+		}
+		locked, err = s.Accounts.GetAccountByIDForUpdate(ctx, second.ID)
+		if err != nil || locked == nil || locked.AccountNumber != second.AccountNumber {
+			t.Errorf("GetAccountByIDForUpdate = %+v, %v", locked, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+
+	missing, err := s.Accounts.GetAccountByAccountNumber(ctx, "missing")
+	if missing != nil || err != nil {
+		t.Errorf("GetAccountByAccountNumber(missing) = %v, %v, want nil, nil", missing, err)
+	}
+	missing, err = s.Accounts.GetAccountByIDForUpdate(ctx, "00000000-0000-4000-8000-000000000000")
+	if missing != nil || err != nil {
+		t.Errorf("GetAccountByIDForUpdate(missing) = %v, %v, want nil, nil", missing, err)
+	}
+	none, err := s.Accounts.GetAccountsByUserID(ctx, createUser(t, s).ID)
+	if len(none) != 0 || err != nil {
+		t.Errorf("GetAccountsByUserID of a user without accounts = %v, %v", none, err)
+	}
+}
+
+func testPockets(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	wallet := createAccount(t, s, user.ID, account.TypeMultiCurrency, "EUR")
+
+	balance, err := s.Accounts.GetPocketForUpdate(ctx, wallet.ID, "USD")
+	if balance != 0 || err != nil {
+		t.Errorf("unfunded pocket = %v, %v, want 0", balance, err)
+	}
+
+	if err := s.Accounts.SetPocket(ctx, wallet.ID, "USD", 10); err != nil {
+		t.Fatalf("SetPocket: %v", err)
+	}
+	if err := s.Accounts.SetPocket(ctx, wallet.ID, "USD", 42.5); err != nil {
+		t.Fatalf("SetPocket over an existing pocket: %v", err)
+	}
+	if err := s.Accounts.SetPocket(ctx, wallet.ID, "GBP", 7); err != nil {
+		t.Fatalf("SetPocket: %v", err)
+	}
+	balance, err = s.Accounts.GetPocketForUpdate(ctx, wallet.ID, "USD")
+	if balance != 42.5 || err != nil {
+		t.Errorf("USD pocket = %v, %v, want 42.5", balance, err)
+	}
+
+	pockets, err := s.Accounts.GetPockets(ctx, []string{wallet.ID})
+	if err != nil {
+		t.Fatalf("GetPockets: %v", err)
+	}
+	if len(pockets) != 1 || len(pockets[wallet.ID]) != 2 || pockets[wallet.ID]["USD"] != 42.5 || pockets[wallet.ID]["GBP"] != 7 {
+		t.Errorf("GetPockets = %v", pockets)
+	}
+
+	// The base currency lives in the account balance, not in a pocket
+	if err := account.SetPocketBalance(ctx, s.Accounts, wallet, "EUR", 3); err != nil {
+		t.Fatalf("SetPocketBalance: %v", err)
+	}
+	accounts, err := s.Accounts.GetAccountsByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetAccountsByUserID: %v", err)
+	}
+	if err := account.LoadPockets(ctx, s.Accounts, accounts); err != nil {
+		t.Fatalf("LoadPockets: %v", err)
+	}
+	want := map[string]float64{"EUR": 3, "USD": 42.5, "GBP": 7}
+	if got := accounts[0].Pockets; len(got) != len(want) || got["EUR"] != 3 || got["USD"] != 42.5 || got["GBP"] != 7 {
+		t.Errorf("LoadPockets = %v, want %v", got, want)
+	}
+}
+
+// --- Ledger ---
+
+func testTransactions(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	checking := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	savings := createAccount(t, s, user.ID, account.TypeChecking, "USD")
+
+	balance, rate := 90.0, 1.1
+	out := createTransaction(t, s, &transactions.Transaction{
+		AccountID: checking.ID, TransactionType: transactions.TypeTransferOut, Amount: -10, Currency: "EUR",
+		BalanceAfter: &balance, Description: "Rent", Reference: "INV-1", CounterpartyAccount: savings.AccountNumber,
+	})
+	if out.ID == 0 || out.Timestamp.IsZero() || out.Status != transactions.StatusPosted {
+		t.Fatalf("created transaction has ID %d, timestamp %v and status %q", out.ID, out.Timestamp, out.Status)
+	}
+	original := 10.0
+	in := createTransaction(t, s, &transactions.Transaction{
+		AccountID: savings.ID, TransactionType: transactions.TypeTransferIn, Amount: 11, Currency: "USD",
+		OriginalAmount: &original, OriginalCurrency: "EUR", FXRate: &rate,
+	})
+	if in.ID == out.ID {
+		t.Fatalf("transactions share ID %d", in.ID)
+	}
+
+	if err := s.Transactions.LinkTransactions(ctx, out, in); err != nil {
+		t.Fatalf("LinkTransactions: %v", err)
+	}
+	if out.LinkedID == nil || *out.LinkedID != in.ID || in.LinkedID == nil || *in.LinkedID != out.ID {
+		t.Errorf("LinkTransactions did not link the arguments")
+	}
+
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		got, err := s.Transactions.GetTransactionForUpdate(ctx, out.ID)
+		if err != nil {
+			return err
+		}
+		if got.LinkedID == nil || *got.LinkedID != in.ID || got.Description != "Rent" || got.Reference != "INV-1" ||
+			got.CounterpartyAccount != savings.AccountNumber || got.BalanceAfter == nil || *got.BalanceAfter != 90 {
+			t.Errorf("GetTransactionForUpdate = %+v", got)
+		}
+		got, err = s.Transactions.GetTransactionForUpdate(ctx, in.ID)
+		if err != nil {
+			return err
+		}
+		if got.OriginalAmount == nil || *got.OriginalAmount != 10 || got.OriginalCurrency != "EUR" || got.FXRate == nil || *got.FXRate != 1.1 {
+			t.Errorf("conversion of GetTransactionForUpdate = %+v", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+
+	if _, err := s.Transactions.GetTransactionForUpdate(ctx, out.ID+1000); !errors.Is(err, transactions.ErrTransactionNotFound) {
+		t.Errorf("GetTransactionForUpdate(missing) = %v, want ErrTransactionNotFound", err)
+	}
+
+	fee := createTransaction(t, s, &transactions.Transaction{
+		AccountID: checking.ID, TransactionType: transactions.TypeFee, Amount: -1, Currency: "EUR", FeeFor: &out.ID,
+	})
+	fees, err := s.Transactions.GetFeesForUpdate(ctx, []int{out.ID, in.ID})
+	if err != nil || len(fees) != 1 || fees[0].ID != fee.ID {
+		t.Errorf("GetFeesForUpdate = %v, %v, want the fee %d", fees, err, fee.ID)
+	}
+
+	createTransaction(t, s, &transactions.Transaction{AccountID: checking.ID, TransactionType: transactions.TypeWithdrawal, Amount: -5, Currency: "EUR"})
+	createTransaction(t, s, &transactions.Transaction{AccountID: checking.ID, TransactionType: transactions.TypeDeposit, Amount: 5, Currency: "EUR"})
+	count, err := s.Transactions.CountDebitsSince(ctx, checking.ID, time.Now().Add(-time.Hour))
+	if count != 2 || err != nil {
+		t.Errorf("CountDebitsSince = %d, %v, want the transfer and the withdrawal", count, err)
+	}
+	count, err = s.Transactions.CountDebitsSince(ctx, checking.ID, time.Now().Add(time.Hour))
+	if count != 0 || err != nil {
+		t.Errorf("CountDebitsSince(future) = %d, %v, want 0", count, err)
+	}
+}
+
+func testReversals(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	acc := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	deposit := createTransaction(t, s, &transactions.Transaction{AccountID: acc.ID, TransactionType: transactions.TypeDeposit, Amount: 20, Currency: "EUR"})
+
+	createTransaction(t, s, &transactions.Transaction{
+		AccountID: acc.ID, TransactionType: transactions.TypeReversal, Amount: -20, Currency: "EUR", ReversalOf: &deposit.ID,
+	})
+	if err := s.Transactions.MarkTransactionReversed(ctx, deposit.ID); err != nil {
+		t.Fatalf("MarkTransactionReversed: %v", err)
+	}
+	got, err := s.Transactions.GetTransactionForUpdate(ctx, deposit.ID)
+	if err != nil || got.Status != transactions.StatusReversed {
+		t.Errorf("status after MarkTransactionReversed = %q, %v", got.Status, err)
+	}
+
+	_, err = s.Transactions.CreateTransaction(ctx, &transactions.Transaction{
+		AccountID: acc.ID, TransactionType: transactions.TypeReversal, Amount: -20, Currency: "EUR", ReversalOf: &deposit.ID,
+	})
+	if !errors.Is(err, transactions.ErrAlreadyReversed) {
+		t.Errorf("second reversal = %v, want ErrAlreadyReversed", err)
+	}
+}
+
+func testHistory(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	first := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	second := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	other := createAccount(t, s, createUser(t, s).ID, account.TypeChecking, "EUR")
+
+	var ids []int
+	for _, acc := range []*account.Account{first, second, first, other} {
+		tr := createTransaction(t, s, &transactions.Transaction{AccountID: acc.ID, TransactionType: transactions.TypeDeposit, Amount: 1, Currency: "EUR"})
+		ids = append(ids, tr.ID)
+	}
+	reversal := createTransaction(t, s, &transactions.Transaction{
+		AccountID: first.ID, TransactionType: transactions.TypeReversal, Amount: -1, Currency: "EUR", ReversalOf: &ids[0],
+	})
+
+	history, err := s.Transactions.GetTransactionsByUserID(ctx, user.ID, "", 10)
+	if err != nil {
+		t.Fatalf("GetTransactionsByUserID: %v", err)
+	}
+	want := []int{reversal.ID, ids[2], ids[1], ids[0]}
+	if len(history) != len(want) {
+		t.Fatalf("GetTransactionsByUserID returned %d transactions, want %d", len(history), len(want))
+	}
+	for i, tr := range history {
+		if tr.ID != want[i] {
+			t.Errorf("history[%d] = %d, want %d (newest first)", i, tr.ID, want[i])
+		}
+	}
+	if last := history[3]; last.ReversedBy == nil || *last.ReversedBy != reversal.ID {
+		t.Errorf("reversed transaction has ReversedBy %v, want %d", last.ReversedBy, reversal.ID)
+	}
+
+	history, err = s.Transactions.GetTransactionsByUserID(ctx, user.ID, second.AccountNumber, 10)
+	if err != nil || len(history) != 1 || history[0].ID != ids[1] {
+		t.Errorf("history of one account = %v, %v", history, err)
+	}
+	history, err = s.Transactions.GetTransactionsByUserID(ctx, user.ID, "", 2)
+	if err != nil || len(history) != 2 {
+		t.Errorf("history with limit 2 has %d transactions, %v", len(history), err)
+	}
+	history, err = s.Transactions.GetTransactionsByUserID(ctx, createUser(t, s).ID, "", 10)
+	if err != nil || history == nil || len(history) != 0 {
+		t.Errorf("history of a user without transactions = %#v, %v, want an empty slice", history, err)
+	}
+}
+
+func testDebits(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	first := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	second := createAccount(t, s, user.ID, account.TypeChecking, "USD")
+	other := createAccount(t, s, createUser(t, s).ID, account.TypeChecking, "EUR")
+
+	withdrawal := createTransaction(t, s, &transactions.Transaction{AccountID: first.ID, TransactionType: transactions.TypeWithdrawal, Amount: -5, Currency: "EUR"})
+	createTransaction(t, s, &transactions.Transaction{AccountID: first.ID, TransactionType: transactions.TypeDeposit, Amount: 5, Currency: "EUR"})
+	createTransaction(t, s, &transactions.Transaction{AccountID: first.ID, TransactionType: transactions.TypeFee, Amount: -1, Currency: "EUR"})
+	transfer := createTransaction(t, s, &transactions.Transaction{AccountID: second.ID, TransactionType: transactions.TypeTransferOut, Amount: -7, Currency: "USD"})
+	createTransaction(t, s, &transactions.Transaction{AccountID: other.ID, TransactionType: transactions.TypeWithdrawal, Amount: -9, Currency: "EUR"})
+
+	tests := []struct {
+		name      string
+		accountID string
+		since     time.Time
+		want      []int
+	}{
+		{"every account", "", time.Now().Add(-time.Hour), []int{withdrawal.ID, transfer.ID}},
+		{"one account", second.ID, time.Now().Add(-time.Hour), []int{transfer.ID}},
+		{"future", "", time.Now().Add(time.Hour), nil},
+	}
+	for _, tt := range tests {
+		debits, err := s.Transactions.GetDebitsSince(ctx, user.ID, tt.accountID, tt.since)
+		if err != nil {
+			t.Fatalf("%s: GetDebitsSince: %v", tt.name, err)
+		}
+		var ids []int
+		for _, debit := range debits {
+			ids = append(ids, debit.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: GetDebitsSince = %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+	debits, err := s.Transactions.GetDebitsSince(ctx, user.ID, second.ID, time.Now().Add(-time.Hour))
+	if err != nil || len(debits) != 1 || debits[0].Amount != -7 || debits[0].Currency != "USD" || debits[0].Timestamp.IsZero() {
+		t.Errorf("GetDebitsSince = %+v, %v, want the transfer of -7 USD", debits, err)
+	}
+}
+
+// --- Cards ---
+
+func testCards(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	acc := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+
+	expiry := time.Date(2030, time.June, 30, 0, 0, 0, 0, time.UTC)
+	card := &cards.Card{AccountID: acc.ID, CardNumber: unique("tok_"), CardType: cards.TypeDebit, ExpiryDate: expiry, CVVHash: "cvv-hash"}
+	id, err := s.Cards.CreateCard(ctx, card)
+	if err != nil {
+		t.Fatalf("CreateCard: %v", err)
+	}
+	second := &cards.Card{AccountID: acc.ID, CardNumber: unique("tok_"), CardType: cards.TypeCredit, ExpiryDate: expiry, CVVHash: "cvv-hash"}
+	if _, err := s.Cards.CreateCard(ctx, second); err != nil {
+		t.Fatalf("CreateCard: %v", err)
+	}
+
+	got, err := s.Cards.GetCardByID(ctx, id)
+	if err != nil || got == nil {
+		t.Fatalf("GetCardByID = %v, %v", got, err)
+	}
+	if got.CardNumber != card.CardNumber || got.CardType != cards.TypeDebit || got.CVVHash != "cvv-hash" ||
+		got.Status != cards.StatusActive || !got.ExpiryDate.Equal(expiry) {
+		t.Errorf("GetCardByID = %+v", got)
+	}
+
+	duplicate := &cards.Card{AccountID: acc.ID, CardNumber: card.CardNumber, CardType: cards.TypeDebit, ExpiryDate: expiry, CVVHash: "cvv-hash"}
+	if _, err := s.Cards.CreateCard(ctx, duplicate); !errors.Is(err, cards.ErrDuplicateCardNumber) {
+		t.Errorf("CreateCard with a taken number = %v, want ErrDuplicateCardNumber", err)
+	}
+
+	if err := s.Cards.UpdateCardStatus(ctx, id, cards.StatusBlocked); err != nil {
+		t.Fatalf("UpdateCardStatus: %v", err)
+	}
+	list, err := s.Cards.GetCardsByAccountID(ctx, acc.ID)
+	if err != nil || len(list) != 2 || list[0].ID != id || list[0].Status != cards.StatusBlocked {
+		t.Errorf("GetCardsByAccountID = %+v, %v, want the blocked card first", list, err)
+	}
+
+	missing, err := s.Cards.GetCardByID(ctx, "00000000-0000-4000-8000-000000000000")
+	if missing != nil || err != nil {
+		t.Errorf("GetCardByID(missing) = %v, %v, want nil, nil", missing, err)
+	}
+}
+
+// --- Units of Work ---
+
+func testRollback(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	acc := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+
+	failure := errors.New("failure")
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.Accounts.UpdateAccountBalance(ctx, acc.ID, 50); err != nil {
+			return err
+		}
+		if _, err := s.Transactions.CreateTransaction(ctx, &transactions.Transaction{
+			AccountID: acc.ID, TransactionType: transactions.TypeDeposit, Amount: 50, Currency: "EUR",
+		}); err != nil {
+			return err
+		}
+		// Nested units of work join the enclosing one
+		return s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := s.Accounts.SetPocket(ctx, acc.ID, "USD", 5); err != nil {
+				return err
+			}
+			return failure
+		})
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithinTx = %v, want the error of fn", err)
+	}
+
+	got, err := s.Accounts.GetAccountByAccountNumber(ctx, acc.AccountNumber)
+	if err != nil || got.Balance != 0 {
+		t.Errorf("balance after rollback = %v, %v, want 0", got.Balance, err)
+	}
+	history, err := s.Transactions.GetTransactionsByUserID(ctx, user.ID, "", 10)
+	if err != nil || len(history) != 0 {
+		t.Errorf("history after rollback = %v, %v, want none", history, err)
+	}
+	pocket, err := s.Accounts.GetPocketForUpdate(ctx, acc.ID, "USD")
+	if err != nil || pocket != 0 {
+		t.Errorf("pocket after rollback = %v, %v, want 0", pocket, err)
+	}
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		return s.Accounts.UpdateAccountBalance(ctx, acc.ID, 75)
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+	got, err = s.Accounts.GetAccountByAccountNumber(ctx, acc.AccountNumber)
+	if err != nil || got.Balance != 75 {
+		t.Errorf("balance after commit = %v, %v, want 75", got.Balance, err)
+	}
+}
+
+// --- Limits ---
+
+func testOverrides(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	acc := createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+
+	missing, err := s.Overrides.GetOverride(ctx, user.ID, "")
+	if missing != nil || err != nil {
+		t.Errorf("GetOverride(none) = %v, %v, want nil, nil", missing, err)
+	}
+
+	daily, hourly, perTransaction := 300.0, 4, 50.0
+	save := func(accountID string, o *limits.Override) {
+		t.Helper()
+		err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := s.Overrides.LockUser(ctx, user.ID); err != nil {
+				return err
+			}
+			return s.Overrides.SaveOverride(ctx, user.ID, accountID, o)
+		})
+		if err != nil {
+			t.Fatalf("SaveOverride: %v", err)
+		}
+	}
+	save("", &limits.Override{Daily: &daily, HourlyCount: &hourly})
+	save(acc.ID, &limits.Override{PerTransaction: &perTransaction})
+	daily = 1 // Callers keep ownership of the override
+
+	got, err := s.Overrides.GetOverride(ctx, user.ID, "")
+	if err != nil || got == nil || got.Daily == nil || *got.Daily != 300 || got.HourlyCount == nil || *got.HourlyCount != 4 ||
+		got.PerTransaction != nil || got.Monthly != nil {
+		t.Errorf("user override = %+v, %v, want daily 300 and 4 debits an hour", got, err)
+	}
+	got, err = s.Overrides.GetOverride(ctx, user.ID, acc.ID)
+	if err != nil || got == nil || got.PerTransaction == nil || *got.PerTransaction != 50 || got.Daily != nil {
+		t.Errorf("account override = %+v, %v, want 50 per transaction", got, err)
+	}
+
+	// Saving again replaces the override, and an empty one removes it
+	monthly := 900.0
+	save("", &limits.Override{Monthly: &monthly})
+	got, err = s.Overrides.GetOverride(ctx, user.ID, "")
+	if err != nil || got == nil || got.Daily != nil || got.Monthly == nil || *got.Monthly != 900 {
+		t.Errorf("replaced override = %+v, %v, want only monthly 900", got, err)
+	}
+	save(acc.ID, &limits.Override{})
+	got, err = s.Overrides.GetOverride(ctx, user.ID, acc.ID)
+	if got != nil || err != nil {
+		t.Errorf("removed override = %+v, %v, want nil, nil", got, err)
+	}
+}
+
+// --- Standing Orders ---
+
+func testStandingOrders(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	due := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+
+	var created []*payments.StandingOrder
+	for i, nextRunAt := range []time.Time{due, due.Add(-time.Hour), due.Add(24 * time.Hour)} {
+		o := &payments.StandingOrder{
+			UserID: user.ID, FromAccountNumber: "ES00FROM", ToAccountNumber: "ES00TO", Amount: float64(10 * (i + 1)),
+			Frequency: payments.FrequencyMonthly, Day: 15, Status: payments.StatusActive, ScheduledFor: nextRunAt, NextRunAt: nextRunAt,
+		}
+		if err := s.Orders.CreateStandingOrder(ctx, o); err != nil {
+			t.Fatalf("CreateStandingOrder: %v", err)
+		}
+		if o.ID == "" || o.CreatedAt.IsZero() || o.UpdatedAt.IsZero() {
+			t.Fatalf("created order has ID %q, created at %v and updated at %v", o.ID, o.CreatedAt, o.UpdatedAt)
+		}
+		created = append(created, o)
+	}
+
+	got, err := s.Orders.GetStandingOrder(ctx, created[0].ID)
+	if err != nil || got == nil || got.Amount != 10 || got.Frequency != payments.FrequencyMonthly || got.Day != 15 ||
+		!got.NextRunAt.Equal(due) || got.UserID != user.ID {
+		t.Fatalf("GetStandingOrder = %+v, %v", got, err)
+	}
+	missing, err := s.Orders.GetStandingOrder(ctx, "00000000-0000-4000-8000-000000000000")
+	if missing != nil || err != nil {
+		t.Errorf("GetStandingOrder(missing) = %v, %v, want nil, nil", missing, err)
+	}
+
+	list, err := s.Orders.GetStandingOrdersByUserID(ctx, user.ID)
+	if err != nil || len(list) != 3 || list[0].ID != created[0].ID {
+		t.Errorf("GetStandingOrdersByUserID = %v, %v, want the three orders oldest first", list, err)
+	}
+	list, err = s.Orders.GetStandingOrdersByUserID(ctx, createUser(t, s).ID)
+	if err != nil || list == nil || len(list) != 0 {
+		t.Errorf("orders of a user without any = %#v, %v, want an empty slice", list, err)
+	}
+
+	dueOrders, err := s.Orders.GetDueStandingOrders(ctx, time.Now(), 10)
+	if err != nil || len(dueOrders) != 2 || dueOrders[0].ID != created[1].ID || dueOrders[1].ID != created[0].ID {
+		t.Fatalf("GetDueStandingOrders = %v, %v, want the two due orders, earliest first", dueOrders, err)
+	}
+	if limited, err := s.Orders.GetDueStandingOrders(ctx, time.Now(), 1); err != nil || len(limited) != 1 {
+		t.Errorf("GetDueStandingOrders with limit 1 = %v, %v", limited, err)
+	}
+
+	// Only the first of two workers claims the attempt
+	order, rival := dueOrders[1], *dueOrders[1]
+	lease := due.Add(time.Hour)
+	if claimed, err := s.Orders.ClaimStandingOrder(ctx, order, lease); !claimed || err != nil {
+		t.Fatalf("ClaimStandingOrder = %v, %v, want claimed", claimed, err)
+	}
+	if !order.NextRunAt.Equal(lease) || !order.UpdatedAt.After(rival.UpdatedAt) {
+		t.Errorf("claimed order runs next at %v and was updated at %v", order.NextRunAt, order.UpdatedAt)
+	}
+	if claimed, err := s.Orders.ClaimStandingOrder(ctx, &rival, lease); claimed || err != nil {
+		t.Errorf("second ClaimStandingOrder = %v, %v, want not claimed", claimed, err)
+	}
+
+	// Updates made from a stale copy are refused
+	rival.Amount = 99
+	if err := s.Orders.UpdateStandingOrderTerms(ctx, &rival, false); !errors.Is(err, payments.ErrStandingOrderChanged) {
+		t.Errorf("UpdateStandingOrderTerms of a stale order = %v, want ErrStandingOrderChanged", err)
+	}
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		locked, err := s.Orders.GetStandingOrderForUpdate(ctx, order.ID)
+		if err != nil {
+			return err
+		}
+		if locked == nil || !locked.UpdatedAt.Equal(order.UpdatedAt) {
+			t.Errorf("GetStandingOrderForUpdate = %+v, want the claimed order", locked)
+		}
+		lastRun := due
+		order.Attempts, order.LastError, order.LastRunAt = 1, "insufficient funds", &lastRun
+		return s.Orders.RecordStandingOrderRun(ctx, order)
+	})
+	if err != nil {
+		t.Fatalf("RecordStandingOrderRun: %v", err)
+	}
+
+	order.Amount, order.Day = 25, 20
+	order.ScheduledFor, order.NextRunAt = due.Add(48*time.Hour), due.Add(48*time.Hour)
+	if err := s.Orders.UpdateStandingOrderTerms(ctx, order, false); err != nil {
+		t.Fatalf("UpdateStandingOrderTerms: %v", err)
+	}
+	order.Status = payments.StatusPaused
+	if err := s.Orders.UpdateStandingOrderStatus(ctx, order, false); err != nil {
+		t.Fatalf("UpdateStandingOrderStatus: %v", err)
+	}
+
+	got, err = s.Orders.GetStandingOrder(ctx, order.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetStandingOrder = %v, %v", got, err)
+	}
+	if got.Amount != 25 || got.Day != 20 || got.Status != payments.StatusPaused || got.Attempts != 1 ||
+		got.LastError != "insufficient funds" || got.LastRunAt == nil || !got.LastRunAt.Equal(due) {
+		t.Errorf("updated order = %+v", got)
+	}
+	if !got.NextRunAt.Equal(lease) {
+		t.Errorf("order runs next at %v, want the lease %v kept without rescheduling", got.NextRunAt, lease)
+	}
+	if !got.UpdatedAt.Equal(order.UpdatedAt) {
+		t.Errorf("stored order was updated at %v, want %v as returned by the last update", got.UpdatedAt, order.UpdatedAt)
+	}
+}
+
+// --- Interest ---
+
+func testAccruals(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s)
+	savings := createAccount(t, s, user.ID, account.TypeSavings, "EUR")
+	createAccount(t, s, user.ID, account.TypeChecking, "EUR")
+	if err := s.Accounts.UpdateAccountBalance(ctx, savings.ID, 1000); err != nil {
+		t.Fatalf("UpdateAccountBalance: %v", err)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	yesterday := today.AddDate(0, 0, -1)
+	balances, err := s.Accruals.GetEndOfDayBalances(ctx, []string{account.TypeSavings}, today)
+	if err != nil || len(balances) != 1 || balances[0].AccountID != savings.ID || balances[0].Amount != 1000 ||
+		balances[0].AccountType != account.TypeSavings {
+		t.Errorf("GetEndOfDayBalances = %+v, %v, want the savings account with 1000", balances, err)
+	}
+	balances, err = s.Accruals.GetEndOfDayBalances(ctx, []string{account.TypeSavings}, yesterday)
+	if err != nil || len(balances) != 0 {
+		t.Errorf("GetEndOfDayBalances before the opening = %+v, %v, want none", balances, err)
+	}
+
+	last, err := s.Accruals.LastAccrualDate(ctx)
+	if err != nil || !last.IsZero() {
+		t.Errorf("LastAccrualDate without runs = %v, %v, want the zero time", last, err)
+	}
+	for _, day := range []time.Time{yesterday, today, yesterday} {
+		if err := s.Accruals.RecordRun(ctx, day); err != nil {
+			t.Fatalf("RecordRun: %v", err)
+		}
+	}
+	last, err = s.Accruals.LastAccrualDate(ctx)
+	if err != nil || !last.Equal(today) {
+		t.Errorf("LastAccrualDate = %v, %v, want %v", last, err, today)
+	}
+
+	// A second accrual of the same day is ignored
+	lastMonth := time.Date(today.Year(), today.Month()-1, 10, 0, 0, 0, 0, time.UTC)
+	for _, accrual := range []*interest.Accrual{
+		{AccountID: savings.ID, AccrualDate: lastMonth, Balance: 1000, AnnualRate: 0.015, DayCount: "ACT/365", Amount: 0.25},
+		{AccountID: savings.ID, AccrualDate: lastMonth.AddDate(0, 0, 1), Balance: 1000, AnnualRate: 0.015, DayCount: "ACT/365", Amount: 0.5},
+		{AccountID: savings.ID, AccrualDate: lastMonth, Balance: 1000, AnnualRate: 0.015, DayCount: "ACT/365", Amount: 7},
+		{AccountID: savings.ID, AccrualDate: yesterday.AddDate(0, 1, 0), Balance: 1000, AnnualRate: 0.015, DayCount: "ACT/365", Amount: 1},
+	} {
+		if err := s.Accruals.RecordAccrual(ctx, accrual); err != nil {
+			t.Fatalf("RecordAccrual: %v", err)
+		}
+	}
+
+	monthStart := time.Date(lastMonth.Year(), lastMonth.Month(), 1, 0, 0, 0, 0, time.UTC)
+	months, err := s.Accruals.GetPendingMonths(ctx, today)
+	if err != nil || len(months) != 1 || months[0].AccountNumber != savings.AccountNumber || !months[0].Month.Equal(monthStart) {
+		t.Fatalf("GetPendingMonths = %+v, %v, want last month of the savings account", months, err)
+	}
+	total, err := s.Accruals.SumUnposted(ctx, savings.ID, monthStart, monthStart.AddDate(0, 1, 0))
+	if err != nil || math.Abs(total-0.75) > 1e-9 {
+		t.Errorf("SumUnposted = %v, %v, want 0.75", total, err)
+	}
+
+	posting := createTransaction(t, s, &transactions.Transaction{AccountID: savings.ID, TransactionType: transactions.TypeInterest, Amount: 0.75, Currency: "EUR"})
+	postedAt := time.Now().UTC().Truncate(time.Second)
+	if err := s.Accruals.MarkPosted(ctx, savings.ID, monthStart, monthStart.AddDate(0, 1, 0), postedAt, &posting.ID); err != nil {
+		t.Fatalf("MarkPosted: %v", err)
+	}
+	total, err = s.Accruals.SumUnposted(ctx, savings.ID, monthStart, monthStart.AddDate(0, 1, 0))
+	if err != nil || total != 0 {
+		t.Errorf("SumUnposted after posting = %v, %v, want 0", total, err)
+	}
+	if months, err := s.Accruals.GetPendingMonths(ctx, today); err != nil || len(months) != 0 {
+		t.Errorf("GetPendingMonths after posting = %+v, %v, want none", months, err)
+	}
+
+	accruals, err := s.Accruals.GetAccruals(ctx, savings.ID)
+	if err != nil || len(accruals) != 3 {
+		t.Fatalf("GetAccruals = %v, %v, want three accruals", accruals, err)
+	}
+	if first := accruals[0]; first.Amount != 0.25 || first.DayCount != "ACT/365" || first.PostedAt == nil ||
+		!first.PostedAt.Equal(postedAt) || first.TransactionID == nil || *first.TransactionID != posting.ID {
+		t.Errorf("posted accrual = %+v", first)
+	}
+	if pending := accruals[2]; pending.PostedAt != nil || pending.TransactionID != nil {
+		t.Errorf("accrual after the posted month = %+v, want it unposted", pending)
+	}
+}
@@ -3,11 +3,15 @@ package transactions
 import (
 	"banking-backend/account"
 	"banking-backend/auth"
+	"banking-backend/clock"
 	"banking-backend/currency"
-	"database/sql"
+	"banking-backend/fees"
+	"banking-backend/metrics"
+	"banking-backend/store"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 )
 
 // --- Models ---
@@ -16,12 +20,111 @@ type DepositRequest struct {
 	AccountNumber string  `json:"account_number"`
 	Amount        float64 `json:"amount"`
 	Currency      string  `json:"currency"`
+	QuoteID       string  `json:"quote_id,omitempty"` // Locks the FX rate when Currency differs from the account's
+	Description   string  `json:"description,omitempty"`
+	Reference     string  `json:"reference,omitempty"`
+}
+
+// --- Ledger ---
+
+func (env *Env) Deposit(ctx context.Context, userID string, req DepositRequest) (*Transaction, error) {
+	// Price the deposit before locking the account
+	acc, err := env.ownedAccount(ctx, userID, req.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	if req.Currency == "" {
+		req.Currency = acc.Currency
+	}
+	var rate *currency.Rate
+	if !acc.IsMultiCurrency() || req.Currency == acc.Currency {
+		if rate, err = env.marketRate(ctx, req.QuoteID, req.Currency, acc.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	var transaction *Transaction
+	err = env.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		// Lock the account until the deposit is posted
+		acc, err := env.lockOwnedAccount(ctx, userID, req.AccountNumber)
+		if err != nil {
+			return err
+		}
+
+		amount := currency.Round(req.Amount, req.Currency)
+		details := Details{Description: req.Description, Reference: req.Reference}
+
+		// Multi-currency accounts keep foreign deposits in the matching pocket
+		if acc.IsMultiCurrency() && req.Currency != acc.Currency {
+			if req.QuoteID != "" {
+				return currency.ErrQuoteMismatch
+			}
+			transaction, err = env.creditPocket(ctx, acc, req.Currency, amount, TypeDeposit, nil, details)
+			return err
+		}
+
+		depositedAmount, conversion, err := env.convert(ctx, userID, req.QuoteID, amount, req.Currency, acc.Currency, rate)
+		if err != nil {
+			return err
+		}
+		if currency.Round(depositedAmount, acc.Currency) <= 0 {
+			return ErrAmountTooSmall
+		}
+
+		transaction, err = env.credit(ctx, acc, depositedAmount, TypeDeposit, conversion, details)
+		if err != nil {
+			return err
+		}
+		if conversion != nil {
+			return env.chargeFee(ctx, acc, acc.Currency, fees.OpFX, transaction.Amount, transaction)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// FundNewAccount posts the opening deposit of acc. It implements
+// account.Funder and runs inside the unit of work that creates the account.
+func (env *Env) FundNewAccount(ctx context.Context, acc *account.Account, amount float64) error {
+	_, err := env.credit(ctx, acc, amount, TypeDeposit, nil, Details{Description: "Opening deposit"})
+	return err
 }
 
 // --- Handlers ---
 
+// Env holds the ledger dependencies.
 type Env struct {
-	DB *sql.DB
+	Tx           store.Transactor
+	Clock        clock.Clock
+	Accounts     account.Repository
+	Transactions Repository
+	Rates        currency.RateProvider
+	Quotes       QuoteRedeemer  // Optional; quote IDs are reported as not found when nil
+	Payees       PayeeChecker   // Optional; only own accounts can be paid when nil
+	Limits       LimitChecker   // Optional; no limits are enforced when nil
+	Fees         *fees.Schedule // Optional; nothing is charged when nil
+}
+
+// LimitChecker is consulted before every outgoing debit, inside the unit of
+// work that posts it. It returns an error wrapping ErrLimitExceeded to reject
+// the debit.
+type LimitChecker interface {
+	CheckDebit(ctx context.Context, acc *account.Account, amount float64) error
+}
+
+// QuoteRedeemer marks an FX quote as used by an operation, inside the unit
+// of work that posts it.
+type QuoteRedeemer interface {
+	UseQuote(ctx context.Context, quoteID, userID, from, to string, amount float64) (*currency.Quote, error)
+}
+
+// PayeeChecker resolves and checks the saved beneficiaries of a user.
+type PayeeChecker interface {
+	GetAccountNumber(ctx context.Context, userID, id string) (string, error)
+	CheckPayee(ctx context.Context, userID, accountNumber string, now time.Time) error
 }
 
 func (env *Env) DepositHandler(w http.ResponseWriter, r *http.Request) {
@@ -42,59 +145,37 @@ func (env *Env) DepositHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the account from the database
-	db := &account.DB{env.DB}
-	acc, err := db.GetAccountByAccountNumber(req.AccountNumber)
-	if err != nil || acc == nil {
-		auth.RespondWithError(w, http.StatusNotFound, "Account not found")
+	if err := validateDetails(req.Description, req.Reference); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Check if the account belongs to the user
-	if acc.UserID != userID {
-		auth.RespondWithError(w, http.StatusUnauthorized, "Account does not belong to the user")
+	req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+	if err := account.ValidateIBAN(req.AccountNumber); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
 		return
 	}
 
-	depositedAmount := req.Amount
-	// Convert currency if necessary
-	if req.Currency != acc.Currency {
-		rate, err := currency.GetRate(req.Currency, acc.Currency)
+	// An empty currency means the deposit is made in the account currency
+	if req.Currency != "" {
+		cur, err := currency.LookupSupported(req.Currency)
 		if err != nil {
-			auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get exchange rate")
+			auth.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		depositedAmount = req.Amount * rate
-	}
-
-	// Update the account balance
-	newBalance := acc.Balance + depositedAmount
-	if err := db.UpdateAccountBalance(acc.ID, newBalance); err != nil {
-		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to update account balance")
-		return
+		req.Currency = cur.Code
 	}
 
-	// Create a transaction record
-	transaction, err := CreateTransaction(env.DB, &Transaction{
-		AccountID:       acc.ID,
-		TransactionType: "deposit",
-		Amount:          depositedAmount,
-		Currency:        req.Currency,
-	})
+	transaction, err := env.Deposit(r.Context(), userID, req)
 	if err != nil {
-		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to create transaction")
+		respondWithLedgerError(w, r, err, "Failed to deposit")
 		return
 	}
+	depositCurrency := req.Currency
+	if depositCurrency == "" {
+		depositCurrency = transaction.Currency
+	}
+	metrics.ObserveDeposit(depositCurrency, req.Amount)
 
 	auth.JSON(w, http.StatusOK, transaction)
 }
-
-func CreateTransaction(db *sql.DB, transaction *Transaction) (*Transaction, error) {
-	query := `INSERT INTO transactions (account_id, transaction_type, amount, currency)
-			  VALUES ($1, $2, $3, $4) RETURNING id, timestamp`
-	err := db.QueryRow(query, transaction.AccountID, transaction.TransactionType, transaction.Amount, transaction.Currency).Scan(&transaction.ID, &transaction.Timestamp)
-	if err != nil {
-		return nil, fmt.Errorf("could not create transaction: %w", err)
-	}
-	return transaction, nil
-}
@@ -0,0 +1,193 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/currency"
+	"banking-backend/fees"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// --- Models ---
+
+const (
+	TypeExchangeOut = "exchange_out"
+	TypeExchangeIn  = "exchange_in"
+)
+
+var ErrNotMultiCurrency = errors.New("account does not hold multiple currencies")
+
+// ExchangeRequest converts Amount of From into To between the pockets of a
+// multi-currency account.
+type ExchangeRequest struct {
+	AccountNumber string  `json:"account_number"`
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Amount        float64 `json:"amount"`
+	QuoteID       string  `json:"quote_id,omitempty"`
+}
+
+type ExchangeResult struct {
+	Debit  *Transaction `json:"debit"`
+	Credit *Transaction `json:"credit"`
+}
+
+// --- Ledger ---
+
+// creditPocket credits amount to the cur pocket of acc inside the unit of
+// work of ctx.
+func (env *Env) creditPocket(ctx context.Context, acc *account.Account, cur string, amount float64, transactionType string, conversion *Conversion, details Details) (*Transaction, error) {
+	amount = currency.Round(amount, cur)
+	balance, err := account.GetPocketBalanceForUpdate(ctx, env.Accounts, acc, cur)
+	if err != nil {
+		return nil, err
+	}
+	balance += amount
+	if err := account.SetPocketBalance(ctx, env.Accounts, acc, cur, balance); err != nil {
+		return nil, err
+	}
+
+	transaction := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: transactionType,
+		Amount:          amount,
+		Currency:        cur,
+		BalanceAfter:    &balance,
+	}
+	transaction.applyDetails(details)
+	transaction.applyConversion(conversion)
+	return env.Transactions.CreateTransaction(ctx, transaction)
+}
+
+// debitPocket debits amount from the cur pocket of acc inside the unit of
+// work of ctx. Pockets cannot be overdrawn.
+func (env *Env) debitPocket(ctx context.Context, acc *account.Account, cur string, amount float64, transactionType string, details Details) (*Transaction, error) {
+	amount = currency.Round(amount, cur)
+	balance, err := account.GetPocketBalanceForUpdate(ctx, env.Accounts, acc, cur)
+	if err != nil {
+		return nil, err
+	}
+	if balance < amount {
+		return nil, account.ErrInsufficientFunds
+	}
+	balance -= amount
+	if err := account.SetPocketBalance(ctx, env.Accounts, acc, cur, balance); err != nil {
+		return nil, err
+	}
+
+	transaction := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: transactionType,
+		Amount:          -amount,
+		Currency:        cur,
+		BalanceAfter:    &balance,
+	}
+	transaction.applyDetails(details)
+	return env.Transactions.CreateTransaction(ctx, transaction)
+}
+
+func (env *Env) Exchange(ctx context.Context, userID string, req ExchangeRequest) (*ExchangeResult, error) {
+	// Price the exchange before locking the account
+	rate, err := env.marketRate(ctx, req.QuoteID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *ExchangeResult
+	err = env.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		acc, err := env.lockOwnedAccount(ctx, userID, req.AccountNumber)
+		if err != nil {
+			return err
+		}
+		if !acc.IsMultiCurrency() {
+			return ErrNotMultiCurrency
+		}
+
+		amount := currency.Round(req.Amount, req.From)
+		converted, conversion, err := env.convert(ctx, userID, req.QuoteID, amount, req.From, req.To, rate)
+		if err != nil {
+			return err
+		}
+		if currency.Round(converted, req.To) <= 0 {
+			return ErrAmountTooSmall
+		}
+
+		debitTransaction, err := env.debitPocket(ctx, acc, req.From, amount, TypeExchangeOut, Details{})
+		if err != nil {
+			return err
+		}
+
+		creditTransaction, err := env.creditPocket(ctx, acc, req.To, converted, TypeExchangeIn, conversion, Details{})
+		if err != nil {
+			return err
+		}
+
+		if err := env.Transactions.LinkTransactions(ctx, debitTransaction, creditTransaction); err != nil {
+			return err
+		}
+
+		if err := env.chargeFee(ctx, acc, req.From, fees.OpFX, amount, debitTransaction); err != nil {
+			return err
+		}
+		result = &ExchangeResult{Debit: debitTransaction, Credit: creditTransaction}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// --- Handlers ---
+
+func (env *Env) ExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req ExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Exchange amount must be positive")
+		return
+	}
+
+	req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+	if err := account.ValidateIBAN(req.AccountNumber); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
+		return
+	}
+
+	from, err := currency.LookupSupported(req.From)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := currency.LookupSupported(req.To)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if from.Code == to.Code {
+		auth.RespondWithError(w, http.StatusBadRequest, "Currencies must differ")
+		return
+	}
+	req.From, req.To = from.Code, to.Code
+
+	result, err := env.Exchange(r.Context(), userID, req)
+	if err != nil {
+		respondWithLedgerError(w, r, err, "Failed to exchange currency")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,242 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/currency"
+	"banking-backend/fees"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// --- Models ---
+
+const TypeFee = "fee"
+
+// Operations accepted by the fee preview. Deposits and exchanges are only
+// charged for the currency conversion.
+const (
+	PreviewWithdrawal = "withdrawal"
+	PreviewTransfer   = "transfer"
+	PreviewDeposit    = "deposit"
+	PreviewExchange   = "exchange"
+)
+
+var ErrUnknownOperation = errors.New("unknown operation")
+
+var feeDescriptions = map[string]string{
+	fees.OpWithdrawal: "Withdrawal fee",
+	fees.OpTransfer:   "Transfer fee",
+	fees.OpFX:         "Currency conversion fee",
+}
+
+// FeePreviewRequest describes an operation as it would be sent to /withdraw,
+// /transfer, /deposit or /accounts/exchange.
+type FeePreviewRequest struct {
+	TransactionType string  `json:"transaction_type"`
+	AccountNumber   string  `json:"account_number"`
+	ToAccountNumber string  `json:"to_account_number,omitempty"`
+	BeneficiaryID   string  `json:"beneficiary_id,omitempty"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency,omitempty"` // Deposits: currency of the amount
+	From            string  `json:"from,omitempty"`     // Exchanges: pocket debited
+	To              string  `json:"to,omitempty"`       // Exchanges: pocket credited
+}
+
+// FeePreview lists the fees an operation would be charged. Conversion fees
+// of deposits are estimated at the current mid-market rate.
+type FeePreview struct {
+	Fees     []*fees.Fee `json:"fees"`
+	Total    float64     `json:"total"`
+	Currency string      `json:"currency"`
+}
+
+// --- Ledger ---
+
+// chargeFee posts the fee of op, if any, on the cur pocket of acc inside the
+// unit of work of ctx and attaches it to charged. amount is the base the fee is priced on, in cur.
+// Fees do not count as withdrawals but cannot exceed the available funds.
+func (env *Env) chargeFee(ctx context.Context, acc *account.Account, cur, op string, amount float64, charged *Transaction) error {
+	fee := env.Fees.Quote(op, acc.AccountType, cur, amount)
+	if fee == nil {
+		return nil
+	}
+
+	balance, err := account.GetPocketBalanceForUpdate(ctx, env.Accounts, acc, cur)
+	if err != nil {
+		return err
+	}
+	if cur == acc.Currency {
+		product, err := account.GetProduct(acc.AccountType)
+		if err != nil {
+			return err
+		}
+		if err := product.CheckFee(balance, fee.Amount); err != nil {
+			return err
+		}
+	} else if balance < fee.Amount {
+		return account.ErrInsufficientFunds
+	}
+
+	balance -= fee.Amount
+	if err := account.SetPocketBalance(ctx, env.Accounts, acc, cur, balance); err != nil {
+		return err
+	}
+
+	transaction := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: TypeFee,
+		Amount:          -fee.Amount,
+		Currency:        cur,
+		BalanceAfter:    &balance,
+		FeeFor:          &charged.ID,
+	}
+	transaction.applyDetails(Details{Description: feeDescriptions[op]})
+	transaction, err = env.Transactions.CreateTransaction(ctx, transaction)
+	if err != nil {
+		return err
+	}
+	charged.Fees = append(charged.Fees, transaction)
+	return nil
+}
+
+// PreviewFees prices an operation without posting anything.
+func (env *Env) PreviewFees(ctx context.Context, userID string, req FeePreviewRequest) (*FeePreview, error) {
+	acc, err := env.Accounts.GetAccountByAccountNumber(ctx, req.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if acc.UserID != userID {
+		return nil, ErrAccountNotOwned
+	}
+
+	preview := &FeePreview{Fees: []*fees.Fee{}, Currency: acc.Currency}
+	add := func(op, cur string, amount float64) {
+		if fee := env.Fees.Quote(op, acc.AccountType, cur, amount); fee != nil {
+			preview.Fees = append(preview.Fees, fee)
+			preview.Total += fee.Amount
+		}
+	}
+
+	switch req.TransactionType {
+	case PreviewWithdrawal:
+		add(fees.OpWithdrawal, acc.Currency, currency.Round(req.Amount, acc.Currency))
+
+	case PreviewTransfer:
+		if req.BeneficiaryID != "" {
+			if req.ToAccountNumber, err = env.payeeAccountNumber(ctx, userID, req.BeneficiaryID); err != nil {
+				return nil, err
+			}
+		}
+		destination, err := env.Accounts.GetAccountByAccountNumber(ctx, req.ToAccountNumber)
+		if err != nil {
+			return nil, err
+		}
+		if destination == nil {
+			return nil, ErrAccountNotFound
+		}
+		amount := currency.Round(req.Amount, acc.Currency)
+		add(fees.OpTransfer, acc.Currency, amount)
+		if destination.Currency != acc.Currency {
+			add(fees.OpFX, acc.Currency, amount)
+		}
+
+	case PreviewDeposit:
+		if req.Currency == "" || req.Currency == acc.Currency || acc.IsMultiCurrency() {
+			break // Deposits are only charged when converted
+		}
+		rate, err := env.Rates.GetRate(ctx, req.Currency, acc.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+		}
+		add(fees.OpFX, acc.Currency, currency.Round(req.Amount*rate.Rate, acc.Currency))
+
+	case PreviewExchange:
+		if !acc.IsMultiCurrency() {
+			return nil, ErrNotMultiCurrency
+		}
+		preview.Currency = req.From
+		add(fees.OpFX, req.From, currency.Round(req.Amount, req.From))
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOperation, req.TransactionType)
+	}
+
+	preview.Total = currency.Round(preview.Total, preview.Currency)
+	return preview, nil
+}
+
+// --- Handlers ---
+
+// PreviewFeesHandler serves POST /fees/preview, a dry run of the fees an
+// operation would be charged.
+func (env *Env) PreviewFeesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req FeePreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+
+	req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+	if err := account.ValidateIBAN(req.AccountNumber); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
+		return
+	}
+	if req.ToAccountNumber != "" {
+		req.ToAccountNumber = account.NormalizeIBAN(req.ToAccountNumber)
+	}
+
+	for _, code := range []*string{&req.Currency, &req.From, &req.To} {
+		if *code == "" {
+			continue
+		}
+		cur, err := currency.LookupSupported(*code)
+		if err != nil {
+			auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		*code = cur.Code
+	}
+
+	switch req.TransactionType {
+	case PreviewTransfer:
+		if (req.ToAccountNumber == "") == (req.BeneficiaryID == "") {
+			auth.RespondWithError(w, http.StatusBadRequest, "Exactly one of to_account_number or beneficiary_id is required")
+			return
+		}
+	case PreviewExchange:
+		if req.From == "" || req.To == "" || req.From == req.To {
+			auth.RespondWithError(w, http.StatusBadRequest, "Exchanges require two different currencies")
+			return
+		}
+	}
+
+	preview, err := env.PreviewFees(r.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, ErrUnknownOperation) {
+			auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithLedgerError(w, r, err, "Failed to preview fees")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, preview)
+}
@@ -0,0 +1,93 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/store"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// --- Models ---
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// --- Database ---
+
+// GetTransactionsByUserID returns the latest transactions of the user's
+// accounts, optionally restricted to one account, with their metadata and
+// reversal links.
+func (db *DB) GetTransactionsByUserID(ctx context.Context, userID, accountNumber string, limit int) ([]*Transaction, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `
+		SELECT `+transactionColumns+`, (SELECT r.id FROM transactions r WHERE r.reversal_of = transactions.id)
+		FROM transactions
+		WHERE account_id IN (SELECT id FROM accounts WHERE user_id = $1 AND ($2 = '' OR account_number = $2))
+		ORDER BY timestamp DESC, id DESC
+		LIMIT $3`, userID, accountNumber, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []*Transaction{}
+	for rows.Next() {
+		var reversedBy *int
+		t, err := scanTransaction(rows, &reversedBy)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan transaction: %w", err)
+		}
+		t.ReversedBy = reversedBy
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// --- Handlers ---
+
+// GetTransactionsHandler serves GET /transactions?account_number=&limit=.
+func (env *Env) GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountNumber := r.URL.Query().Get("account_number")
+	if accountNumber != "" {
+		accountNumber = account.NormalizeIBAN(accountNumber)
+		acc, err := env.Accounts.GetAccountByAccountNumber(r.Context(), accountNumber)
+		if err != nil || acc == nil {
+			auth.RespondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		if acc.UserID != userID {
+			auth.RespondWithError(w, http.StatusUnauthorized, "Account does not belong to the user")
+			return
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			auth.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+	}
+
+	transactions, err := env.Transactions.GetTransactionsByUserID(r.Context(), userID, accountNumber, limit)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusInternalServerError, "Failed to get transactions")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, transactions)
+}
@@ -0,0 +1,250 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/store"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// --- Models ---
+
+const TypeReversal = "reversal"
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrAlreadyReversed     = errors.New("transaction has already been reversed")
+	ErrNotReversible       = errors.New("reversals cannot be reversed")
+)
+
+type ReverseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReversalResult holds one compensating transaction per reversed leg.
+type ReversalResult struct {
+	Reversals []*Transaction `json:"reversals"`
+}
+
+// --- Database ---
+
+// GetTransactionForUpdate loads a transaction and locks its row until the
+// transaction carried by ctx ends.
+func (db *DB) GetTransactionForUpdate(ctx context.Context, id int) (*Transaction, error) {
+	t, err := scanTransaction(store.Conn(ctx, db.DB).QueryRowContext(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, fmt.Errorf("could not get transaction: %w", err)
+	}
+	return t, nil
+}
+
+// GetFeesForUpdate loads and locks the fees charged for the given transactions.
+func (db *DB) GetFeesForUpdate(ctx context.Context, ids []int) ([]*Transaction, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE fee_for = ANY($1) ORDER BY id FOR UPDATE`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("could not get fees: %w", err)
+	}
+	defer rows.Close()
+
+	var fees []*Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan fee: %w", err)
+		}
+		fees = append(fees, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fees: %w", err)
+	}
+	return fees, nil
+}
+
+func (db *DB) MarkTransactionReversed(ctx context.Context, id int) error {
+	if _, err := store.Conn(ctx, db.DB).ExecContext(ctx, `UPDATE transactions SET status = $1 WHERE id = $2`, StatusReversed, id); err != nil {
+		return fmt.Errorf("could not mark transaction as reversed: %w", err)
+	}
+	return nil
+}
+
+// --- Ledger ---
+
+// Reverse posts a compensating transaction for the transaction id and, for
+// transfers and exchanges, for its other leg. The fees charged for them are
+// refunded as well. Each leg is reversed at its original amounts, so
+// converted legs keep the rate they were booked at.
+// Reversals bypass product rules and spending limits and may leave a balance
+// negative.
+func (env *Env) Reverse(ctx context.Context, id int, reason string) (*ReversalResult, error) {
+	result := &ReversalResult{}
+	err := env.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		original, err := env.Transactions.GetTransactionForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		legs := []*Transaction{original}
+		if original.LinkedID != nil {
+			linked, err := env.Transactions.GetTransactionForUpdate(ctx, *original.LinkedID)
+			if err != nil {
+				return err
+			}
+			legs = append(legs, linked)
+		}
+
+		for _, leg := range legs {
+			if leg.TransactionType == TypeReversal {
+				return ErrNotReversible
+			}
+			if leg.Status == StatusReversed {
+				return ErrAlreadyReversed
+			}
+		}
+
+		ids := make([]int, len(legs))
+		for i, leg := range legs {
+			ids[i] = leg.ID
+		}
+		charged, err := env.Transactions.GetFeesForUpdate(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, fee := range charged {
+			if fee.Status != StatusReversed { // Fees may have been refunded on their own
+				legs = append(legs, fee)
+			}
+		}
+
+		// Lock the accounts in a fixed order so concurrent reversals cannot deadlock
+		var accountIDs []string
+		accounts := make(map[string]*account.Account)
+		for _, leg := range legs {
+			if _, ok := accounts[leg.AccountID]; !ok {
+				accounts[leg.AccountID] = nil
+				accountIDs = append(accountIDs, leg.AccountID)
+			}
+		}
+		sort.Strings(accountIDs)
+		for _, id := range accountIDs {
+			acc, err := env.Accounts.GetAccountByIDForUpdate(ctx, id)
+			if err != nil {
+				return err
+			}
+			if acc == nil {
+				return ErrAccountNotFound
+			}
+			accounts[id] = acc
+		}
+
+		for _, leg := range legs {
+			reversal, err := env.reverseLeg(ctx, accounts[leg.AccountID], leg, reason)
+			if err != nil {
+				return err
+			}
+			result.Reversals = append(result.Reversals, reversal)
+		}
+		if len(ids) == 2 {
+			return env.Transactions.LinkTransactions(ctx, result.Reversals[0], result.Reversals[1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// reverseLeg undoes the balance change of leg on acc and records it as a
+// reversal of leg.
+func (env *Env) reverseLeg(ctx context.Context, acc *account.Account, leg *Transaction, reason string) (*Transaction, error) {
+	balance, err := account.GetPocketBalanceForUpdate(ctx, env.Accounts, acc, leg.Currency)
+	if err != nil {
+		return nil, err
+	}
+	balance -= leg.Amount
+	if err := account.SetPocketBalance(ctx, env.Accounts, acc, leg.Currency, balance); err != nil {
+		return nil, err
+	}
+
+	reversal := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: TypeReversal,
+		Amount:          -leg.Amount,
+		Currency:        leg.Currency,
+		BalanceAfter:    &balance,
+		ReversalOf:      &leg.ID,
+	}
+	reversal.applyDetails(Details{
+		Description:         reason,
+		Reference:           leg.Reference,
+		CounterpartyAccount: leg.CounterpartyAccount,
+	})
+	if leg.OriginalAmount != nil {
+		originalAmount := -*leg.OriginalAmount
+		reversal.OriginalAmount = &originalAmount
+		reversal.OriginalCurrency = leg.OriginalCurrency
+		reversal.FXRate = leg.FXRate
+		reversal.FXSpread = leg.FXSpread
+	}
+
+	reversal, err = env.Transactions.CreateTransaction(ctx, reversal)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.Transactions.MarkTransactionReversed(ctx, leg.ID); err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// --- Handlers ---
+
+// ReverseTransactionHandler serves POST /transactions/{id}/reverse. It is
+// restricted to support and admin users.
+func (env *Env) ReverseTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.GetUserIDFromContext(r); err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	var req ReverseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Reason) < 3 {
+		auth.RespondWithError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+	if err := validateDetails(req.Reason, ""); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := env.Reverse(r.Context(), id, req.Reason)
+	if err != nil {
+		respondWithLedgerError(w, r, err, "Failed to reverse transaction")
+		return
+	}
+
+	auth.LoggerFromContext(r.Context()).Info("transaction reversed", "transaction_id", id, "reason", req.Reason)
+	auth.JSON(w, http.StatusOK, result)
+}
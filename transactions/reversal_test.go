@@ -0,0 +1,126 @@
+package transactions_test
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/clock"
+	"banking-backend/fees"
+	"banking-backend/store/memory"
+	"banking-backend/transactions"
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// schedule charges 2 EUR on savings withdrawals and 1 EUR on transfers
+// between 1000 and 10000 EUR.
+var schedule = &fees.Schedule{Rules: []fees.Rule{
+	{TransactionType: fees.OpWithdrawal, Product: account.TypeSavings, Currency: "EUR", Kind: fees.KindFlat, Amount: 2},
+	{TransactionType: fees.OpTransfer, Currency: "EUR", Kind: fees.KindTiered, Tiers: []fees.Tier{
+		{UpTo: 1000}, {UpTo: 10000, Amount: 1}, {Amount: 5, Rate: 0.0005},
+	}},
+}}
+
+// newLedger returns a ledger charging schedule, backed by the memory store,
+// with one user holding a checking and a savings account in EUR.
+func newLedger(t *testing.T) (env *transactions.Env, userID, checking, savings string) {
+	t.Helper()
+	s := memory.New()
+	ctx := context.Background()
+
+	userID, err := s.CreateUser(ctx, &auth.User{DNI: "12345678Z", FullName: "Ada Lovelace", Email: "ada@example.com"}, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, acc := range []*account.Account{
+		{UserID: userID, AccountNumber: "ES0000000000000000000001", Currency: "EUR", AccountType: account.TypeChecking},
+		{UserID: userID, AccountNumber: "ES0000000000000000000002", Currency: "EUR", AccountType: account.TypeSavings},
+	} {
+		if _, err := s.CreateAccount(ctx, acc); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+
+	env = &transactions.Env{
+		Tx:           s,
+		Clock:        clock.NewFixed(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)),
+		Accounts:     s,
+		Transactions: s,
+		Fees:         schedule,
+	}
+	return env, userID, "ES0000000000000000000001", "ES0000000000000000000002"
+}
+
+func wantBalance(t *testing.T, env *transactions.Env, accountNumber string, want float64) {
+	t.Helper()
+	acc, err := env.Accounts.GetAccountByAccountNumber(context.Background(), accountNumber)
+	if err != nil {
+		t.Fatalf("GetAccountByAccountNumber: %v", err)
+	}
+	if math.Abs(acc.Balance-want) > 1e-9 {
+		t.Errorf("balance of %s = %.2f, want %.2f", accountNumber, acc.Balance, want)
+	}
+}
+
+func TestReverseRefundsFees(t *testing.T) {
+	env, userID, checking, savings := newLedger(t)
+	ctx := context.Background()
+
+	if _, err := env.Deposit(ctx, userID, transactions.DepositRequest{AccountNumber: savings, Amount: 5000}); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+
+	// Savings withdrawals pay a flat fee
+	withdrawal, err := env.Withdraw(ctx, userID, transactions.WithdrawRequest{AccountNumber: savings, Amount: 100})
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if len(withdrawal.Fees) != 1 || withdrawal.Fees[0].Amount != -2 {
+		t.Fatalf("withdrawal fees = %+v, want one fee of 2", withdrawal.Fees)
+	}
+	wantBalance(t, env, savings, 4898)
+
+	// The second tier applies to transfers above 1000
+	transfer, err := env.Transfer(ctx, userID, transactions.TransferRequest{
+		FromAccountNumber: savings, ToAccountNumber: checking, Amount: 2000,
+	})
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if len(transfer.Debit.Fees) != 1 || transfer.Debit.Fees[0].Amount != -1 {
+		t.Fatalf("transfer fees = %+v, want one fee of 1", transfer.Debit.Fees)
+	}
+	wantBalance(t, env, savings, 2897)
+	wantBalance(t, env, checking, 2000)
+
+	// Reversing the transfer refunds both legs and the fee
+	result, err := env.Reverse(ctx, transfer.Debit.ID, "sent by mistake")
+	if err != nil {
+		t.Fatalf("Reverse transfer: %v", err)
+	}
+	if len(result.Reversals) != 3 {
+		t.Errorf("transfer reversals = %d, want the two legs and the fee", len(result.Reversals))
+	}
+	wantBalance(t, env, savings, 4898)
+	wantBalance(t, env, checking, 0)
+
+	// A fee refunded on its own is not refunded again with its withdrawal
+	if _, err := env.Reverse(ctx, withdrawal.Fees[0].ID, "goodwill"); err != nil {
+		t.Fatalf("Reverse fee: %v", err)
+	}
+	wantBalance(t, env, savings, 4900)
+	result, err = env.Reverse(ctx, withdrawal.ID, "cash not dispensed")
+	if err != nil {
+		t.Fatalf("Reverse withdrawal: %v", err)
+	}
+	if len(result.Reversals) != 1 {
+		t.Errorf("withdrawal reversals = %d, want only the withdrawal", len(result.Reversals))
+	}
+	wantBalance(t, env, savings, 5000)
+
+	if _, err := env.Reverse(ctx, withdrawal.ID, "again"); !errors.Is(err, transactions.ErrAlreadyReversed) {
+		t.Errorf("Reverse twice = %v, want ErrAlreadyReversed", err)
+	}
+}
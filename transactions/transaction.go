@@ -1,14 +1,241 @@
 package transactions
 
-import "time"
+import (
+	"banking-backend/store"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 // --- Models ---
 
+const (
+	TypeDeposit     = "deposit"
+	TypeWithdrawal  = "withdrawal"
+	TypeTransferIn  = "transfer_in"
+	TypeTransferOut = "transfer_out"
+	TypeInterest    = "interest"
+)
+
+// Transaction statuses. Ledger postings are booked as posted; a posted
+// transaction becomes reversed once a reversal compensates it.
+const (
+	StatusPending  = "pending"
+	StatusPosted   = "posted"
+	StatusFailed   = "failed"
+	StatusReversed = "reversed"
+)
+
+// Maximum lengths of the free-text fields, following SEPA remittance limits.
+const (
+	maxDescriptionLength = 140
+	maxReferenceLength   = 35
+)
+
+// Transaction amounts are signed: credits are positive and debits negative,
+// always in the account (or pocket) currency. Converted transactions also keep
+// the original amount and currency, and the rate and spread applied.
 type Transaction struct {
-	ID              int       `json:"id"`
-	AccountID       string    `json:"account_id"`
-	TransactionType string    `json:"transaction_type"`
-	Amount          float64   `json:"amount"`
-	Currency        string    `json:"currency"`
-	Timestamp       time.Time `json:"timestamp"`
+	ID                  int            `json:"id"`
+	AccountID           string         `json:"account_id"`
+	TransactionType     string         `json:"transaction_type"`
+	Status              string         `json:"status"`
+	Amount              float64        `json:"amount"`
+	Currency            string         `json:"currency"`
+	BalanceAfter        *float64       `json:"balance_after,omitempty"` // Balance of the account (or pocket) once posted
+	Description         string         `json:"description,omitempty"`
+	Reference           string         `json:"reference,omitempty"` // External reference, e.g. an invoice number
+	CounterpartyAccount string         `json:"counterparty_account,omitempty"`
+	OriginalAmount      *float64       `json:"original_amount,omitempty"`
+	OriginalCurrency    string         `json:"original_currency,omitempty"`
+	FXRate              *float64       `json:"fx_rate,omitempty"`
+	FXSpread            *float64       `json:"fx_spread,omitempty"`
+	FXQuoteID           string         `json:"fx_quote_id,omitempty"`
+	ReversalOf          *int           `json:"reversal_of,omitempty"`           // Transaction compensated by this one
+	ReversedBy          *int           `json:"reversed_by,omitempty"`           // Reversal of this transaction, if any
+	LinkedID            *int           `json:"linked_transaction_id,omitempty"` // Other leg of a transfer or exchange
+	FeeFor              *int           `json:"fee_for,omitempty"`               // Transaction this fee was charged for
+	Fees                []*Transaction `json:"fees,omitempty"`                  // Fees charged with this transaction, when just posted
+	Timestamp           time.Time      `json:"timestamp"`
+}
+
+// Details are the descriptive fields of a posting.
+type Details struct {
+	Description         string
+	Reference           string
+	CounterpartyAccount string
+}
+
+func (t *Transaction) applyDetails(d Details) {
+	t.Description = d.Description
+	t.Reference = d.Reference
+	t.CounterpartyAccount = d.CounterpartyAccount
+}
+
+// validateDetails checks the user-supplied description and reference.
+func validateDetails(description, reference string) error {
+	if len(description) > maxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters long", maxDescriptionLength)
+	}
+	if len(reference) > maxReferenceLength {
+		return fmt.Errorf("reference must be at most %d characters long", maxReferenceLength)
+	}
+	return nil
+}
+
+// Conversion describes the FX applied to a transaction.
+type Conversion struct {
+	OriginalAmount   float64
+	OriginalCurrency string
+	Rate             float64
+	Spread           float64
+	QuoteID          string
+}
+
+func (t *Transaction) applyConversion(c *Conversion) {
+	if c == nil {
+		return
+	}
+	t.OriginalAmount = &c.OriginalAmount
+	t.OriginalCurrency = c.OriginalCurrency
+	t.FXRate = &c.Rate
+	t.FXSpread = &c.Spread
+	t.FXQuoteID = c.QuoteID
+}
+
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountNotOwned = errors.New("account does not belong to the user")
+	ErrSameAccount     = errors.New("source and destination accounts must differ")
+	ErrRateUnavailable = errors.New("exchange rate unavailable")
+	ErrAmountTooSmall  = errors.New("amount is too small")
+	ErrLimitExceeded   = errors.New("spending limit exceeded")
+)
+
+// --- Database ---
+
+// Repository stores the ledger. The ForUpdate variants lock what they return
+// until the enclosing unit of work ends.
+type Repository interface {
+	// CreateTransaction assigns the ID and timestamp of transaction. It
+	// returns ErrAlreadyReversed when the transaction it reverses already has
+	// a reversal.
+	CreateTransaction(ctx context.Context, transaction *Transaction) (*Transaction, error)
+	LinkTransactions(ctx context.Context, a, b *Transaction) error
+	GetTransactionForUpdate(ctx context.Context, id int) (*Transaction, error) // ErrTransactionNotFound when missing
+	GetFeesForUpdate(ctx context.Context, ids []int) ([]*Transaction, error)
+	MarkTransactionReversed(ctx context.Context, id int) error
+	CountDebitsSince(ctx context.Context, accountID string, since time.Time) (int, error)
+	// GetDebitsSince returns the withdrawals and outgoing transfers posted
+	// since the given time on the accounts of a user, or only on accountID
+	// when it is set, oldest first.
+	GetDebitsSince(ctx context.Context, userID, accountID string, since time.Time) ([]*Transaction, error)
+	GetTransactionsByUserID(ctx context.Context, userID, accountNumber string, limit int) ([]*Transaction, error)
+}
+
+// DB is the Repository backed by Postgres.
+type DB struct {
+	*sql.DB
+}
+
+const transactionColumns = `id, account_id, transaction_type, status, amount, currency, balance_after,
+	COALESCE(description, ''), COALESCE(reference, ''), COALESCE(counterparty_account, ''),
+	original_amount, COALESCE(original_currency, ''), fx_rate, fx_spread, COALESCE(fx_quote_id::text, ''),
+	reversal_of, linked_transaction_id, fee_for, timestamp`
+
+func scanTransaction(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Transaction, error) {
+	t := &Transaction{}
+	dest := append([]interface{}{&t.ID, &t.AccountID, &t.TransactionType, &t.Status, &t.Amount, &t.Currency, &t.BalanceAfter,
+		&t.Description, &t.Reference, &t.CounterpartyAccount, &t.OriginalAmount, &t.OriginalCurrency, &t.FXRate, &t.FXSpread,
+		&t.FXQuoteID, &t.ReversalOf, &t.LinkedID, &t.FeeFor, &t.Timestamp}, extra...)
+	err := row.Scan(dest...)
+	return t, err
+}
+
+func (db *DB) CreateTransaction(ctx context.Context, transaction *Transaction) (*Transaction, error) {
+	if transaction.Status == "" {
+		transaction.Status = StatusPosted
+	}
+	query := `INSERT INTO transactions (account_id, transaction_type, status, amount, currency, balance_after,
+			  description, reference, counterparty_account,
+			  original_amount, original_currency, fx_rate, fx_spread, fx_quote_id, reversal_of, linked_transaction_id, fee_for)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id, timestamp`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, transaction.AccountID, transaction.TransactionType, transaction.Status, transaction.Amount,
+		transaction.Currency, transaction.BalanceAfter, nullIfEmpty(transaction.Description), nullIfEmpty(transaction.Reference),
+		nullIfEmpty(transaction.CounterpartyAccount), transaction.OriginalAmount, nullIfEmpty(transaction.OriginalCurrency),
+		transaction.FXRate, transaction.FXSpread, nullIfEmpty(transaction.FXQuoteID), transaction.ReversalOf,
+		transaction.LinkedID, transaction.FeeFor).Scan(&transaction.ID, &transaction.Timestamp)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "idx_transactions_reversal_of" {
+			return nil, ErrAlreadyReversed
+		}
+		return nil, fmt.Errorf("could not create transaction: %w", err)
+	}
+	return transaction, nil
+}
+
+// LinkTransactions records a and b as the two legs of the same operation.
+func (db *DB) LinkTransactions(ctx context.Context, a, b *Transaction) error {
+	conn := store.Conn(ctx, db.DB)
+	query := `UPDATE transactions SET linked_transaction_id = $2 WHERE id = $1`
+	if _, err := conn.ExecContext(ctx, query, a.ID, b.ID); err != nil {
+		return fmt.Errorf("could not link transactions: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, query, b.ID, a.ID); err != nil {
+		return fmt.Errorf("could not link transactions: %w", err)
+	}
+	a.LinkedID = &b.ID
+	b.LinkedID = &a.ID
+	return nil
+}
+
+// CountDebitsSince counts the withdrawals and outgoing transfers posted on an
+// account since the given time.
+func (db *DB) CountDebitsSince(ctx context.Context, accountID string, since time.Time) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM transactions
+			  WHERE account_id = $1 AND transaction_type IN ($2, $3) AND timestamp >= $4`
+	err := store.Conn(ctx, db.DB).QueryRowContext(ctx, query, accountID, TypeWithdrawal, TypeTransferOut, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("could not count debits: %w", err)
+	}
+	return count, nil
+}
+
+func (db *DB) GetDebitsSince(ctx context.Context, userID, accountID string, since time.Time) ([]*Transaction, error) {
+	rows, err := store.Conn(ctx, db.DB).QueryContext(ctx, `SELECT `+transactionColumns+` FROM transactions
+		WHERE account_id IN (SELECT id FROM accounts WHERE user_id = $1 AND ($2::uuid IS NULL OR id = $2))
+		AND transaction_type IN ($3, $4) AND timestamp >= $5
+		ORDER BY timestamp, id`,
+		userID, nullIfEmpty(accountID), TypeWithdrawal, TypeTransferOut, since)
+	if err != nil {
+		return nil, fmt.Errorf("could not get debits: %w", err)
+	}
+	defer rows.Close()
+
+	var debits []*Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan debit: %w", err)
+		}
+		debits = append(debits, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating debits: %w", err)
+	}
+	return debits, nil
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
 }
@@ -0,0 +1,204 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/currency"
+	"banking-backend/fees"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// --- Models ---
+
+// TransferRequest moves Amount, expressed in the source account currency,
+// between two accounts. The destination is either ToAccountNumber or the
+// account of a saved beneficiary; accounts of other users must be saved
+// beneficiaries.
+type TransferRequest struct {
+	FromAccountNumber string  `json:"from_account_number"`
+	ToAccountNumber   string  `json:"to_account_number,omitempty"`
+	BeneficiaryID     string  `json:"beneficiary_id,omitempty"`
+	Description       string  `json:"description,omitempty"`
+	Reference         string  `json:"reference,omitempty"`
+	Amount            float64 `json:"amount"`
+	QuoteID           string  `json:"quote_id,omitempty"` // Locks the FX rate for cross-currency transfers
+}
+
+type TransferResult struct {
+	Debit  *Transaction `json:"debit"`
+	Credit *Transaction `json:"credit"`
+}
+
+// --- Ledger ---
+
+func (env *Env) Transfer(ctx context.Context, userID string, req TransferRequest) (*TransferResult, error) {
+	var err error
+	if req.BeneficiaryID != "" {
+		if req.ToAccountNumber, err = env.payeeAccountNumber(ctx, userID, req.BeneficiaryID); err != nil {
+			return nil, err
+		}
+	}
+	if req.FromAccountNumber == req.ToAccountNumber {
+		return nil, ErrSameAccount
+	}
+
+	// Price the transfer before locking the accounts
+	source, err := env.ownedAccount(ctx, userID, req.FromAccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := env.Accounts.GetAccountByAccountNumber(ctx, req.ToAccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	if destination == nil {
+		return nil, ErrAccountNotFound
+	}
+	rate, err := env.marketRate(ctx, req.QuoteID, source.Currency, destination.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *TransferResult
+	err = env.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		// Always lock in the same order so concurrent opposite transfers cannot deadlock
+		var source, destination *account.Account
+		if req.FromAccountNumber < req.ToAccountNumber {
+			if source, err = env.lockOwnedAccount(ctx, userID, req.FromAccountNumber); err != nil {
+				return err
+			}
+			if destination, err = env.Accounts.GetAccountForUpdate(ctx, req.ToAccountNumber); err != nil {
+				return err
+			}
+		} else {
+			if destination, err = env.Accounts.GetAccountForUpdate(ctx, req.ToAccountNumber); err != nil {
+				return err
+			}
+			if source, err = env.lockOwnedAccount(ctx, userID, req.FromAccountNumber); err != nil {
+				return err
+			}
+		}
+		if destination == nil {
+			return ErrAccountNotFound
+		}
+
+		// Funds can only leave the user's own accounts towards saved payees
+		if destination.UserID != userID {
+			if env.Payees == nil {
+				return beneficiaries.ErrPayeeRequired
+			}
+			if err := env.Payees.CheckPayee(ctx, userID, destination.AccountNumber, env.Clock.Now()); err != nil {
+				return err
+			}
+		}
+
+		amount := currency.Round(req.Amount, source.Currency)
+		creditedAmount, conversion, err := env.convert(ctx, userID, req.QuoteID, amount, source.Currency, destination.Currency, rate)
+		if err != nil {
+			return err
+		}
+
+		debitTransaction, err := env.debit(ctx, source, amount, TypeTransferOut, Details{
+			Description:         req.Description,
+			Reference:           req.Reference,
+			CounterpartyAccount: destination.AccountNumber,
+		})
+		if err != nil {
+			return err
+		}
+
+		creditTransaction, err := env.credit(ctx, destination, creditedAmount, TypeTransferIn, conversion, Details{
+			Description:         req.Description,
+			Reference:           req.Reference,
+			CounterpartyAccount: source.AccountNumber,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := env.Transactions.LinkTransactions(ctx, debitTransaction, creditTransaction); err != nil {
+			return err
+		}
+
+		if err := env.chargeFee(ctx, source, source.Currency, fees.OpTransfer, amount, debitTransaction); err != nil {
+			return err
+		}
+		if conversion != nil {
+			if err := env.chargeFee(ctx, source, source.Currency, fees.OpFX, amount, debitTransaction); err != nil {
+				return err
+			}
+		}
+
+		result = &TransferResult{Debit: debitTransaction, Credit: creditTransaction}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// payeeAccountNumber resolves the account number of a saved beneficiary.
+func (env *Env) payeeAccountNumber(ctx context.Context, userID, beneficiaryID string) (string, error) {
+	if env.Payees == nil {
+		return "", beneficiaries.ErrBeneficiaryNotFound
+	}
+	return env.Payees.GetAccountNumber(ctx, userID, beneficiaryID)
+}
+
+// --- Handlers ---
+
+func (env *Env) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Transfer amount must be positive")
+		return
+	}
+
+	if err := validateDetails(req.Description, req.Reference); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if (req.ToAccountNumber == "") == (req.BeneficiaryID == "") {
+		auth.RespondWithError(w, http.StatusBadRequest, "Exactly one of to_account_number or beneficiary_id is required")
+		return
+	}
+
+	req.FromAccountNumber = account.NormalizeIBAN(req.FromAccountNumber)
+	accountNumbers := []string{req.FromAccountNumber}
+	if req.ToAccountNumber != "" {
+		req.ToAccountNumber = account.NormalizeIBAN(req.ToAccountNumber)
+		accountNumbers = append(accountNumbers, req.ToAccountNumber)
+	}
+	for _, accountNumber := range accountNumbers {
+		if err := account.ValidateIBAN(accountNumber); err != nil {
+			auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
+			return
+		}
+	}
+
+	result, err := env.Transfer(r.Context(), userID, req)
+	if err != nil {
+		respondWithLedgerError(w, r, err, "Failed to transfer")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,271 @@
+package transactions
+
+import (
+	"banking-backend/account"
+	"banking-backend/auth"
+	"banking-backend/beneficiaries"
+	"banking-backend/currency"
+	"banking-backend/fees"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// --- Models ---
+
+type WithdrawRequest struct {
+	AccountNumber string  `json:"account_number"`
+	Amount        float64 `json:"amount"`
+	Description   string  `json:"description,omitempty"`
+	Reference     string  `json:"reference,omitempty"`
+}
+
+// --- Ledger ---
+
+// debit checks the account product rules and spending limits and posts a
+// debit of amount (in the account currency) inside the unit of work of ctx.
+func (env *Env) debit(ctx context.Context, acc *account.Account, amount float64, transactionType string, details Details) (*Transaction, error) {
+	amount = currency.Round(amount, acc.Currency)
+	product, err := account.GetProduct(acc.AccountType)
+	if err != nil {
+		return nil, err
+	}
+
+	debits, err := env.Transactions.CountDebitsSince(ctx, acc.ID, startOfMonth(env.Clock.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := product.CheckDebit(acc.Balance, amount, debits); err != nil {
+		return nil, err
+	}
+
+	if env.Limits != nil {
+		if err := env.Limits.CheckDebit(ctx, acc, amount); err != nil {
+			return nil, err
+		}
+	}
+
+	acc.Balance -= amount
+	if err := env.Accounts.UpdateAccountBalance(ctx, acc.ID, acc.Balance); err != nil {
+		return nil, err
+	}
+	balanceAfter := acc.Balance
+
+	transaction := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: transactionType,
+		Amount:          -amount,
+		Currency:        acc.Currency,
+		BalanceAfter:    &balanceAfter,
+	}
+	transaction.applyDetails(details)
+	return env.Transactions.CreateTransaction(ctx, transaction)
+}
+
+// credit posts a credit of amount (in the account currency) inside the unit
+// of work of ctx. conversion is nil unless the funds were converted from
+// another currency.
+func (env *Env) credit(ctx context.Context, acc *account.Account, amount float64, transactionType string, conversion *Conversion, details Details) (*Transaction, error) {
+	amount = currency.Round(amount, acc.Currency)
+	acc.Balance += amount
+	if err := env.Accounts.UpdateAccountBalance(ctx, acc.ID, acc.Balance); err != nil {
+		return nil, err
+	}
+	balanceAfter := acc.Balance
+
+	transaction := &Transaction{
+		AccountID:       acc.ID,
+		TransactionType: transactionType,
+		Amount:          amount,
+		Currency:        acc.Currency,
+		BalanceAfter:    &balanceAfter,
+	}
+	transaction.applyDetails(details)
+	transaction.applyConversion(conversion)
+	return env.Transactions.CreateTransaction(ctx, transaction)
+}
+
+// marketRate fetches the mid-market rate of a conversion that is not covered
+// by a quote. It is called before any account is locked, so a slow FX
+// provider never holds the locks, and returns nil when there is nothing to
+// fetch.
+func (env *Env) marketRate(ctx context.Context, quoteID, from, to string) (*currency.Rate, error) {
+	if quoteID != "" || from == to {
+		return nil, nil
+	}
+	rate, err := env.Rates.GetRate(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+	}
+	return rate, nil
+}
+
+// convert prices amount from one currency into another, either at the rate
+// locked by quoteID or at rate, fetched beforehand by marketRate.
+func (env *Env) convert(ctx context.Context, userID, quoteID string, amount float64, from, to string, rate *currency.Rate) (float64, *Conversion, error) {
+	if from == to {
+		if quoteID != "" {
+			return 0, nil, currency.ErrQuoteMismatch
+		}
+		return amount, nil, nil
+	}
+
+	conversion := &Conversion{OriginalAmount: amount, OriginalCurrency: from}
+	if quoteID != "" {
+		if env.Quotes == nil {
+			return 0, nil, currency.ErrQuoteNotFound
+		}
+		quote, err := env.Quotes.UseQuote(ctx, quoteID, userID, from, to, amount)
+		if err != nil {
+			return 0, nil, err
+		}
+		conversion.Rate = quote.Rate
+		conversion.Spread = quote.Spread
+		conversion.QuoteID = quote.ID
+	} else {
+		if rate == nil || rate.From != from || rate.To != to {
+			return 0, nil, fmt.Errorf("%w: no rate from %s to %s", ErrRateUnavailable, from, to)
+		}
+		conversion.Rate = rate.Rate
+	}
+
+	return amount * conversion.Rate, conversion, nil
+}
+
+// ownedAccount reads, without locking, an account that must belong to userID.
+func (env *Env) ownedAccount(ctx context.Context, userID, accountNumber string) (*account.Account, error) {
+	acc, err := env.Accounts.GetAccountByAccountNumber(ctx, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if acc.UserID != userID {
+		return nil, ErrAccountNotOwned
+	}
+	return acc, nil
+}
+
+// lockOwnedAccount validates and locks an account that must belong to userID.
+func (env *Env) lockOwnedAccount(ctx context.Context, userID, accountNumber string) (*account.Account, error) {
+	acc, err := env.Accounts.GetAccountForUpdate(ctx, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if acc.UserID != userID {
+		return nil, ErrAccountNotOwned
+	}
+	return acc, nil
+}
+
+func (env *Env) Withdraw(ctx context.Context, userID string, req WithdrawRequest) (*Transaction, error) {
+	var transaction *Transaction
+	err := env.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		acc, err := env.lockOwnedAccount(ctx, userID, req.AccountNumber)
+		if err != nil {
+			return err
+		}
+
+		transaction, err = env.debit(ctx, acc, req.Amount, TypeWithdrawal, Details{
+			Description: req.Description,
+			Reference:   req.Reference,
+		})
+		if err != nil {
+			return err
+		}
+		return env.chargeFee(ctx, acc, acc.Currency, fees.OpWithdrawal, -transaction.Amount, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// --- Handlers ---
+
+func (env *Env) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r)
+	if err != nil {
+		auth.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req WithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Amount <= 0 {
+		auth.RespondWithError(w, http.StatusBadRequest, "Withdrawal amount must be positive")
+		return
+	}
+
+	if err := validateDetails(req.Description, req.Reference); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req.AccountNumber = account.NormalizeIBAN(req.AccountNumber)
+	if err := account.ValidateIBAN(req.AccountNumber); err != nil {
+		auth.RespondWithError(w, http.StatusBadRequest, "Invalid account number: "+err.Error())
+		return
+	}
+
+	transaction, err := env.Withdraw(r.Context(), userID, req)
+	if err != nil {
+		respondWithLedgerError(w, r, err, "Failed to withdraw")
+		return
+	}
+
+	auth.JSON(w, http.StatusOK, transaction)
+}
+
+// respondWithLedgerError maps ledger errors to HTTP responses, hiding
+// unexpected errors behind fallback.
+func respondWithLedgerError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		auth.RespondWithError(w, http.StatusNotFound, "Account not found")
+	case errors.Is(err, ErrTransactionNotFound):
+		auth.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrAlreadyReversed):
+		auth.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrAccountNotOwned):
+		auth.RespondWithError(w, http.StatusUnauthorized, "Account does not belong to the user")
+	case errors.Is(err, ErrSameAccount),
+		errors.Is(err, ErrAmountTooSmall),
+		errors.Is(err, ErrNotMultiCurrency),
+		errors.Is(err, ErrNotReversible),
+		errors.Is(err, account.ErrUnknownProduct):
+		auth.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, beneficiaries.ErrBeneficiaryNotFound):
+		auth.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, beneficiaries.ErrPayeeRequired),
+		errors.Is(err, beneficiaries.ErrPayeeNotActive):
+		auth.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, currency.ErrQuoteNotFound):
+		auth.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, currency.ErrQuoteExpired),
+		errors.Is(err, currency.ErrQuoteUsed),
+		errors.Is(err, currency.ErrQuoteMismatch):
+		auth.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrRateUnavailable):
+		auth.RespondWithError(w, http.StatusBadGateway, "Failed to get exchange rate")
+	case errors.Is(err, account.ErrInsufficientFunds),
+		errors.Is(err, account.ErrWithdrawalsNotAllowed),
+		errors.Is(err, account.ErrWithdrawalLimitExceeded),
+		errors.Is(err, ErrLimitExceeded):
+		auth.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		auth.LoggerFromContext(r.Context()).Error(fallback, "error", err)
+		auth.RespondWithError(w, http.StatusInternalServerError, fallback)
+	}
+}